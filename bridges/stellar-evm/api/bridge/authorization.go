@@ -0,0 +1,57 @@
+package bridge
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+// readOnlyMethods are the methods of the SignerService the read-only peers can call
+var readOnlyMethods = map[string]bool{
+	"Status":       true,
+	"Capabilities": true,
+}
+
+// signerAuthorizer decides which peers can call the SignerService
+// Only the masters can ask for signatures, read-only peers can only call the readOnlyMethods.
+type signerAuthorizer struct {
+	masters  map[peer.ID]bool
+	readOnly map[peer.ID]bool
+	// rejected is the number of rejected calls
+	rejected atomic.Uint64
+}
+
+// newSignerAuthorizer creates a signerAuthorizer for the masters and read-only peers with the given Stellar addresses
+func newSignerAuthorizer(masters []string, readOnly []string) (*signerAuthorizer, error) {
+	a := &signerAuthorizer{
+		masters:  make(map[peer.ID]bool, len(masters)),
+		readOnly: make(map[peer.ID]bool, len(readOnly)),
+	}
+	ids, err := p2p.GetPeerIDsFromStellarAddresses(masters)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		a.masters[id] = true
+	}
+	ids, err = p2p.GetPeerIDsFromStellarAddresses(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		a.readOnly[id] = true
+	}
+	return a, nil
+}
+
+// authorize is called by the RPC server for every call
+func (a *signerAuthorizer) authorize(pid peer.ID, service string, method string) bool {
+	if a.masters[pid] || (a.readOnly[pid] && readOnlyMethods[method]) {
+		return true
+	}
+	rejected := a.rejected.Add(1)
+	log.Warn("Rejected RPC call from an unauthorized peer", "peerID", pid, "service", service, "method", method, "rejected", rejected)
+	return false
+}
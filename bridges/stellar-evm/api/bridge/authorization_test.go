@@ -0,0 +1,33 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+func TestSignerAuthorizer(t *testing.T) {
+	master := keypair.MustRandom().Address()
+	monitor := keypair.MustRandom().Address()
+	a, err := newSignerAuthorizer([]string{master}, []string{monitor})
+	assert.NoError(t, err)
+
+	masterID, err := p2p.GetPeerIDFromStellarAddress(master)
+	assert.NoError(t, err)
+	monitorID, err := p2p.GetPeerIDFromStellarAddress(monitor)
+	assert.NoError(t, err)
+	otherID, err := p2p.GetPeerIDFromStellarAddress(keypair.MustRandom().Address())
+	assert.NoError(t, err)
+
+	assert.True(t, a.authorize(masterID, "SignerService", "Sign"))
+	assert.True(t, a.authorize(masterID, "SignerService", "Status"))
+	assert.True(t, a.authorize(monitorID, "SignerService", "Status"))
+	assert.False(t, a.authorize(monitorID, "SignerService", "SignMint"))
+	assert.False(t, a.authorize(otherID, "SignerService", "Status"))
+	assert.Equal(t, uint64(2), a.rejected.Load())
+
+	_, err = newSignerAuthorizer([]string{"invalid"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+)
+
+// maxReservedAddress is the highest address reserved for the zero address and precompiled contracts
+var maxReservedAddress = big.NewInt(0xff)
+
+// addressBlocklist refuses mints to reserved addresses and to the addresses in the blocklist file
+// The blocklist file is a json array of addresses. It is read on every check so addresses can be added
+// without restarting the bridge.
+type addressBlocklist struct {
+	// file is empty if only the reserved addresses are blocked
+	file string
+	// tokenContract is reserved as tokens minted to it are lost
+	tokenContract common.Address
+}
+
+func newAddressBlocklist(file string, tokenContract common.Address) *addressBlocklist {
+	return &addressBlocklist{
+		file:          file,
+		tokenContract: tokenContract,
+	}
+}
+
+// Check returns faults.ErrBlockedAddress if tokens can not be minted to the address
+func (b *addressBlocklist) Check(address common.Address) error {
+	if address == b.tokenContract || new(big.Int).SetBytes(address[:]).Cmp(maxReservedAddress) <= 0 {
+		return faults.ErrBlockedAddress
+	}
+	if b.file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(b.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var blocked []string
+	if err = json.Unmarshal(content, &blocked); err != nil {
+		return fmt.Errorf("failed to decode the blocked addresses in %s: %w", b.file, err)
+	}
+	for _, blockedAddress := range blocked {
+		if common.HexToAddress(blockedAddress) == address {
+			return faults.ErrBlockedAddress
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+)
+
+func TestAddressBlocklist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocked.json")
+	contract := common.HexToAddress("0x4DFe8A53cD9dbA17038cAaDB4cd6743160dAf049")
+	b := newAddressBlocklist(file, contract)
+
+	assert.Equal(t, faults.ErrBlockedAddress, b.Check(common.Address{}))
+	assert.Equal(t, faults.ErrBlockedAddress, b.Check(common.HexToAddress("0x0000000000000000000000000000000000000001")))
+	assert.Equal(t, faults.ErrBlockedAddress, b.Check(contract))
+
+	address := common.HexToAddress("0x65e491D7b985f77e60c85105834A0332fF3002CE")
+	assert.NoError(t, b.Check(address))
+
+	assert.NoError(t, os.WriteFile(file, []byte(`["0x65e491d7b985f77e60c85105834a0332ff3002ce"]`), 0644))
+	assert.Equal(t, faults.ErrBlockedAddress, b.Check(address))
+}
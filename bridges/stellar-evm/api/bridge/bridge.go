@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
@@ -14,10 +15,10 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/contracts/tokenv1"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
-	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
 )
@@ -26,10 +27,13 @@ const (
 	// EthBlockDelay is the amount of blocks to wait before
 	// pushing eth transaction to the stellar network
 	EthBlockDelay = 3
-	// Withdrawing from smartchain to Stellar fee
-	WithdrawFee      = int64(1 * stellar.Precision) //WithdrawFeeof 1 TFT in Stroops
-	BridgeNetwork    = "stellar"
-	EthMessagePrefix = "\x19Ethereum Signed Message:\n32"
+	// DefaultWithdrawFee is the fee for withdrawing from smartchain to Stellar
+	// if the token contract does not support a withdraw fee
+	DefaultWithdrawFee = int64(1 * stellar.Precision) //DefaultWithdrawFee of 1 TFT in Stroops
+	BridgeNetwork      = "stellar"
+	EthMessagePrefix   = "\x19Ethereum Signed Message:\n32"
+	// approvalQueueInterval is the interval at which the approval queue is checked for approved or rejected transfers
+	approvalQueueInterval = 30 * time.Second
 )
 
 // Bridge is a high lvl structure which listens on contract events and bridge-related
@@ -42,6 +46,18 @@ type Bridge struct {
 	config           *BridgeConfig
 	synced           bool
 	signersClient    *SignersClient
+	pauseSwitch      *PauseSwitch
+	mintGuard        *transferGuard
+	withdrawGuard    *transferGuard
+	approvalQueue    *approvals.Queue
+	blocklist        *addressBlocklist
+	// failedWithdrawals are the withdrawals that could not be paid out on Stellar
+	failedWithdrawals *state.FailedWithdrawals
+	// signerSets describes the last loaded signers, to only log changes
+	signerSets string
+	signersMut sync.Mutex
+	// election decides if the bridge acts as the master, nil if there is no leader election
+	election *Election
 }
 
 type BridgeConfig struct {
@@ -51,40 +67,101 @@ type BridgeConfig struct {
 	Follower            bool
 	Relay               string
 	Psk                 string
+	// Direct makes the bridges connect to each other directly instead of through the relay
+	Direct bool
+	// ListenAddresses are the multiaddrs a bridge without a relay listens on
+	ListenAddresses []string
+	// Peers are the multiaddrs of the other bridges a bridge without a relay connects to
+	Peers []string
 	// deposit fee in TFT units
 	DepositFee int64
+	// TransferLimits are applied to mints and withdrawals separately
+	TransferLimits TransferLimits
+	// MaxSupplyDivergence is the amount in TFT units the token supply is allowed to exceed the vault balance
+	// before the circuit breaker pauses the bridge, 0 disables the check
+	MaxSupplyDivergence int64
+	// Approver is the Stellar address of the operator that approves transfers, empty disables approvals
+	Approver string
+	// ApprovalThreshold in TFT units, transfers above it need an operator approval, 0 disables the threshold
+	ApprovalThreshold int64
+	// ApprovalQueueFile is where the transfers awaiting an operator approval are stored
+	ApprovalQueueFile string
+	// PauseFile pauses the bridge while it exists, empty disables the pause switch
+	PauseFile string
+	// PauseHistoryFile stores the periods the bridge was paused, so deposits made while paused are refunded after a restart
+	PauseHistoryFile string
+	// BlockedAddressesFile contains the EVM addresses deposits are refunded for instead of minted
+	BlockedAddressesFile string
+	// FailedWithdrawalsFile is where the withdrawals that could not be paid out are stored
+	FailedWithdrawalsFile string
+	// ReturnFailedWithdrawalsAfter is how long failed withdrawals are retried before they are minted back
+	// to the receiver on the EVM chain, 0 means they are retried forever
+	ReturnFailedWithdrawalsAfter time.Duration
+	// AuthorizedMasters are the Stellar addresses of the masters, besides the vault address,
+	// a cosigner accepts signing requests from
+	AuthorizedMasters []string
+	// ReadOnlyPeers are the Stellar addresses of the peers that can only call the read-only methods of a cosigner
+	ReadOnlyPeers []string
+	// RequireSignedRequests makes a cosigner refuse the unsigned requests of the version 1 signer protocol
+	RequireSignedRequests bool
+	// Watchdog makes a follower watch the vault and the token contract to check the master
+	Watchdog bool
+	// MasterSilenceTimeout is how long the master can leave a deposit or withdrawal unhandled before the watchdog alerts
+	MasterSilenceTimeout time.Duration
+	// LeaderCandidates are the Stellar addresses of the bridges that can act as the master, in order of priority
+	// If set, the candidates elect the master among themselves.
+	LeaderCandidates []string
+	// SignTimeout is how long the master waits for the signatures of the cosigners
+	SignTimeout time.Duration
+	// CosignerTimeout is how long the master waits for a single cosigner to answer before asking it again
+	CosignerTimeout time.Duration
 }
 
 // NewBridge creates a new Bridge.
 // TODO: context is not used
-func NewBridge(ctx context.Context, wallet *stellar.Wallet, contract *BridgeContract, config *BridgeConfig, host host.Host, router routing.PeerRouting) (bridge *Bridge, err error) {
+func NewBridge(ctx context.Context, wallet *stellar.Wallet, contract *BridgeContract, config *BridgeConfig, host host.Host, router routing.PeerRouting, pauseSwitch *PauseSwitch, circuitBreaker *CircuitBreaker) (bridge *Bridge, err error) {
 	blockPersistency := state.NewChainPersistency(config.PersistencyFile)
 
 	bridge = &Bridge{
-		bridgeContract:   contract,
-		blockPersistency: blockPersistency,
-		wallet:           wallet,
-		config:           config,
-	}
-	// Only create the signer client if the bridge is running in master mode
-	if !config.Follower {
-		relayAddrInfo, addrErr := peer.AddrInfoFromString(config.Relay)
-		if err != nil {
-			return nil, addrErr
-		}
-		cosigners, requiredSignatures, err := wallet.GetSigningRequirements()
-		if err != nil {
+		bridgeContract:    contract,
+		blockPersistency:  blockPersistency,
+		wallet:            wallet,
+		config:            config,
+		pauseSwitch:       pauseSwitch,
+		mintGuard:         newTransferGuard(config, pauseSwitch, circuitBreaker),
+		withdrawGuard:     newTransferGuard(config, pauseSwitch, circuitBreaker),
+		approvalQueue:     approvals.NewQueue(config.ApprovalQueueFile),
+		blocklist:         newAddressBlocklist(config.BlockedAddressesFile, contract.GetContractAdress()),
+		failedWithdrawals: state.NewFailedWithdrawals(config.FailedWithdrawalsFile),
+	}
+	// Bridges that connect to each other directly have no relay
+	var relayAddrInfo *peer.AddrInfo
+	if !config.Direct {
+		if relayAddrInfo, err = peer.AddrInfoFromString(config.Relay); err != nil {
 			return nil, err
 		}
-		log.Info("required Stellar signature count", "signatures", requiredSignatures)
-		wallet.SetRequiredSignatures(requiredSignatures)
-		cosignerPeerIDs, err := p2p.GetPeerIDsFromStellarAddresses(cosigners)
+	}
+	if len(config.LeaderCandidates) > 0 {
+		bridge.election, err = NewElection(host, router, relayAddrInfo, wallet.GetAddress(), config.LeaderCandidates, blockPersistency)
 		if err != nil {
 			return nil, err
 		}
-		bridge.signersClient = NewSignersClient(host, router, cosignerPeerIDs, relayAddrInfo)
+	}
+
+	// Only create the signer client if the bridge can act as the master
+	if !config.Follower || bridge.election != nil {
+		bridge.signersClient = NewSignersClient(host, router, relayAddrInfo, wallet)
+		bridge.signersClient.SetTimeouts(config.SignTimeout, config.CosignerTimeout)
 
 		wallet.SetSignerClient(bridge.signersClient)
+		if err = bridge.reloadSigners(); err != nil {
+			return nil, err
+		}
+		wallet.SetSignersChangedHandler(func() {
+			if err := bridge.reloadSigners(); err != nil {
+				log.Error("Failed to reload the cosigners", "err", err)
+			}
+		})
 	}
 
 	if config.RescanBridgeAccount {
@@ -126,6 +203,10 @@ func (bridge *Bridge) mint(receiver eth.ERC20Address, depositedAmount *big.Int,
 		return
 	}
 
+	if err = bridge.blocklist.Check(common.Address(receiver)); err != nil {
+		return
+	}
+
 	depositFeeBigInt := big.NewInt(stellar.IntToStroops(bridge.config.DepositFee))
 
 	if depositedAmount.Cmp(depositFeeBigInt) <= 0 {
@@ -135,6 +216,23 @@ func (bridge *Bridge) mint(receiver eth.ERC20Address, depositedAmount *big.Int,
 	amount := &big.Int{}
 	amount = amount.Sub(depositedAmount, depositFeeBigInt)
 
+	approval, err := bridge.checkTransfer(bridge.mintGuard, approvals.Entry{
+		Transfer: approvals.Transfer{
+			Kind:        approvals.KindMint,
+			ID:          txID,
+			Destination: common.Address(receiver).Hex(),
+			Amount:      amount.Int64(),
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	return bridge.mintWithSignatures(receiver, amount, txID, approval)
+}
+
+// mintWithSignatures collects the signatures of the cosigners and mints amount tokens to receiver
+func (bridge *Bridge) mintWithSignatures(receiver eth.ERC20Address, amount *big.Int, txID string, approval string) error {
 	requiredSignatureCount, err := bridge.bridgeContract.GetRequiresSignatureCount()
 	if err != nil {
 		return err
@@ -147,6 +245,7 @@ func (bridge *Bridge) mint(receiver eth.ERC20Address, depositedAmount *big.Int,
 		TxId:     txID,
 		// subtract 1 from the required signature count, because the master signature is already included
 		RequiredSignatures: requiredSignatureCount.Sub(requiredSignatureCount, big.NewInt(1)).Int64(),
+		Approval:           approval,
 	})
 	if err != nil {
 		return err
@@ -180,6 +279,140 @@ func (bridge *Bridge) mint(receiver eth.ERC20Address, depositedAmount *big.Int,
 	return bridge.bridgeContract.Mint(receiver, amount, txID, orderderedSignatures)
 }
 
+// checkTransfer checks if a mint or a withdrawal can be executed
+// If it needs an operator approval, it is added to the approval queue and faults.ErrAwaitingApproval is returned.
+// If it exceeds the transfer limits, it is deferred in the approval queue and faults.ErrTransferDeferred is returned
+// so it does not hold up the transfers after it.
+// The returned approval needs to be passed to the cosigners.
+func (bridge *Bridge) checkTransfer(guard *transferGuard, entry approvals.Entry) (approval string, err error) {
+	queued, err := bridge.approvalQueue.Get(entry.ID)
+	if err == nil {
+		switch queued.Status {
+		case approvals.StatusApproved:
+			return queued.Approval, guard.check(entry.Transfer, queued.Approval)
+		case approvals.StatusRejected:
+			return "", faults.ErrTransferRejected
+		case approvals.StatusRefunded:
+			return "", faults.ErrTransferHandled
+		case approvals.StatusDeferred:
+			err = guard.check(entry.Transfer, "")
+			if errors.Is(err, ErrTransferLimitExceeded) {
+				return "", faults.ErrTransferDeferred
+			}
+			return "", err
+		default:
+			return "", faults.ErrAwaitingApproval
+		}
+	}
+	if err != approvals.ErrEntryNotFound {
+		return "", err
+	}
+
+	err = guard.check(entry.Transfer, "")
+	if errors.Is(err, ErrApprovalRequired) {
+		log.Warn("Transfer needs an operator approval, adding it to the approval queue", "kind", entry.Kind, "id", entry.ID, "amount", stellar.StroopsToDecimal(entry.Amount), "reason", err)
+		entry.Reason = err.Error()
+		entry.Created = time.Now()
+		if err = bridge.approvalQueue.Add(entry); err != nil {
+			return "", err
+		}
+		return "", faults.ErrAwaitingApproval
+	}
+	if errors.Is(err, ErrTransferLimitExceeded) {
+		log.Warn("Transfer exceeds the transfer limits, deferring it", "kind", entry.Kind, "id", entry.ID, "amount", stellar.StroopsToDecimal(entry.Amount), "reason", err)
+		entry.Reason = err.Error()
+		entry.Created = time.Now()
+		if err = bridge.approvalQueue.Defer(entry); err != nil {
+			return "", err
+		}
+		return "", faults.ErrTransferDeferred
+	}
+	return "", err
+}
+
+// processApprovalQueue executes the approved transfers in the approval queue,
+// refunds the rejected deposits and returns the rejected withdrawals
+// Deferred transfers are executed once they fit in the transfer limits.
+// This call blocks until the context is cancelled.
+func (bridge *Bridge) processApprovalQueue(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(approvalQueueInterval):
+		}
+		if bridge.pauseSwitch.Check() != nil {
+			continue
+		}
+
+		entries, err := bridge.approvalQueue.List()
+		if err != nil {
+			log.Error("Failed to read the approval queue", "err", err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Status == approvals.StatusPending || entry.Status == approvals.StatusRefunded {
+				continue
+			}
+			if entry.Status == approvals.StatusDeferred && !bridge.fitsTransferLimits(entry) {
+				continue
+			}
+			log.Info("Processing transfer from the approval queue", "kind", entry.Kind, "id", entry.ID, "status", entry.Status)
+			switch entry.Kind {
+			case approvals.KindMint:
+				// The mint function refunds the deposit if it is rejected
+				err = bridge.wallet.ProcessDeposit(ctx, entry.ID, bridge.mint)
+				if ctx.Err() != nil {
+					return
+				}
+				if err == nil && entry.Status == approvals.StatusRejected {
+					// The entry is kept so processing the deposit again does not refund it twice
+					if err = bridge.approvalQueue.MarkRefunded(entry.ID); err != nil {
+						log.Error("Failed to mark rejected deposit as refunded", "id", entry.ID, "err", err)
+					}
+					continue
+				}
+			case approvals.KindWithdraw:
+				if entry.Status == approvals.StatusRejected {
+					// The tokens are burned already, the failed withdrawals return them to the receiver
+					log.Warn("Returning rejected withdrawal", "ethTx", entry.ID, "receiver", entry.Receiver, "amount", stellar.StroopsToDecimal(entry.Amount))
+					err = bridge.recordRejectedWithdrawal(entry)
+					break
+				}
+				bridge.mut.Lock()
+				err = bridge.withdraw(ctx, WithdrawEvent{
+					receiver:           common.HexToAddress(entry.Receiver),
+					amount:             big.NewInt(entry.Amount),
+					blockchain_address: entry.Destination,
+					network:            BridgeNetwork,
+					txHash:             common.HexToHash(entry.ID),
+					blockHeight:        entry.BlockHeight,
+					logIndex:           entry.LogIndex,
+				})
+				bridge.mut.Unlock()
+			}
+			// An unpayable withdrawal is taken over by the failed withdrawals
+			if err != nil && err != faults.ErrUnclaimablePayment {
+				log.Error("Failed to process transfer from the approval queue", "id", entry.ID, "err", err)
+				continue
+			}
+			if err = bridge.approvalQueue.Remove(entry.ID); err != nil {
+				log.Error("Failed to remove transfer from the approval queue", "id", entry.ID, "err", err)
+			}
+		}
+	}
+}
+
+// fitsTransferLimits checks if a deferred transfer fits in the transfer limits now
+// The limiter remembers the transfer when it fits, so it is not refused again when it is executed.
+func (bridge *Bridge) fitsTransferLimits(entry approvals.Entry) bool {
+	guard := bridge.mintGuard
+	if entry.Kind == approvals.KindWithdraw {
+		guard = bridge.withdrawGuard
+	}
+	return guard.limiter.Allow(entry.ID, entry.Destination, entry.Amount, time.Now()) == nil
+}
+
 // GetClient returns bridgecontract lightclient
 func (bridge *Bridge) GetClient() *EthClient {
 	return bridge.bridgeContract.EthClient()
@@ -210,67 +443,32 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 	// Should only be read from by the master bridge
 	withdrawChan := make(chan WithdrawEvent)
 
-	// Only the bridge running as the master bridge should do the following things:
+	// Only the bridge acting as the master bridge should do the following things:
 	// - Monitor the Bridge Stellar account and initiate Minting transactions accordingly
 	// - Monitor the Contract for Withdrawal events and initiate a Withdrawal transaction accordingly
-	if !bridge.config.Follower {
-		// Scan bridge account for outgoing transactions to avoid double withdraws or refunds
-		if err := bridge.wallet.ScanBridgeAccount(); err != nil {
-			panic(err)
-		}
-
-		// Monitor the bridge wallet for incoming transactions
-		// mint transactions on ERC20 if possible
-		go func() {
-			if err := bridge.wallet.MonitorBridgeAccountAndMint(ctx, bridge.mint, bridge.blockPersistency); err != nil {
-				panic(err)
-			}
-		}()
-
-		// Sync up any withdrawals made if the blockheight is manually set
-		// to a previous value
+	// With a leader election, the candidates watch for withdrawals but only the leader handles them.
+	if !bridge.config.Follower || bridge.election != nil {
 		currentBlock, err := bridge.bridgeContract.ethc.BlockNumber(ctx)
 		if err != nil {
 			return err
 		}
-
-		var lastHeight uint64
-		// If the user provides a height to rescan from, use that
-		// Otherwise use the saved height in the persistency file
-		if bridge.config.RescanFromHeight > 0 {
-			lastHeight = uint64(bridge.config.RescanFromHeight) - EthBlockDelay
-		} else {
-			height, err := bridge.blockPersistency.GetHeight()
-			if err != nil {
-				return err
-			}
-			// if the saved height is 0, just use current block
-			if height.LastHeight == 0 {
-				lastHeight = currentBlock
-			}
-			if height.LastHeight > EthBlockDelay {
-				lastHeight = height.LastHeight - EthBlockDelay
-			}
-		}
-
-		if lastHeight < currentBlock {
-			// todo filter logs
-			go func() {
-				if err := bridge.bridgeContract.FilterWithdraw(withdrawChan, lastHeight, currentBlock); err != nil {
-					panic(err)
-				}
-			}()
-		}
 		// TODO bug: currentblock is not taken into account and if it would be passed,
 		// blocks in past don't work anyway so if the chain progressed between getting the current block
 		// and the start of the watching, events are lost if there are any.
 		go func() {
-			err := bridge.bridgeContract.SubscribeWithdraw(withdrawChan, currentBlock)
+			err := bridge.bridgeContract.SubscribeWithdraw(ctx, withdrawChan, currentBlock)
 			if err != nil {
 				panic(err)
 			}
 		}()
 
+		if bridge.election != nil {
+			go bridge.election.Run(ctx, func(ctx context.Context) error {
+				return bridge.lead(ctx, withdrawChan)
+			})
+		} else if err = bridge.lead(ctx, withdrawChan); err != nil {
+			return err
+		}
 	}
 
 	go func() {
@@ -280,6 +478,10 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 			// Remember new withdraws
 			// Never happens for cosigners, only for the master since the cosugners are not subscribed to withdraw events
 			case we := <-withdrawChan:
+				if !bridge.leading() {
+					// The next leader finds the withdrawal again from where the master resumes from
+					continue
+				}
 				if we.network == BridgeNetwork {
 					log.Info("Remembering withdraw event", "txHash", we.TxHash(), "height", we.BlockHeight(), "network", we.network)
 					txMap[we.txHash.String()] = we
@@ -299,7 +501,18 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 
 				log.Info("found new head", "head", head.Number, "synced", bridge.synced)
 
-				if bridge.synced {
+				paused := bridge.pauseSwitch.Check() != nil
+				if paused && len(txMap) > 0 {
+					log.Warn("Bridge is paused, keeping withdrawals queued", "queued", len(txMap))
+				}
+
+				leading := bridge.leading()
+				if !leading && len(txMap) > 0 {
+					log.Warn("No longer acting as the master, forgetting queued withdrawals", "queued", len(txMap))
+					txMap = make(map[string]WithdrawEvent)
+				}
+
+				if bridge.synced && !paused && leading {
 					ids := make([]string, 0, len(txMap))
 					for id := range txMap {
 						ids = append(ids, id)
@@ -310,6 +523,11 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 						if head.Number.Uint64() >= we.blockHeight+EthBlockDelay {
 							log.Info("Starting withdrawal", "txHash", we.TxHash())
 							err := bridge.withdraw(ctx, we)
+							if err == faults.ErrAwaitingApproval || err == faults.ErrTransferDeferred || err == faults.ErrTransferRejected || err == faults.ErrUnclaimablePayment {
+								// The approval queue or the failed withdrawals take over
+								delete(txMap, id)
+								continue
+							}
 							if err != nil {
 								log.Error(fmt.Sprintf("failed to create payment for withdrawal to %s, %s", we.blockchain_address, err.Error()))
 								continue
@@ -322,9 +540,12 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 
 				}
 
-				err = bridge.blockPersistency.SaveHeight(head.Number.Uint64())
-				if err != nil {
-					log.Error("error occured saving blockheight", "error", err)
+				// A candidate that does not lead keeps the height the leader resumes from
+				if bridge.election == nil || leading {
+					err = bridge.blockPersistency.SaveHeight(resumeHeight(head.Number.Uint64(), txMap))
+					if err != nil {
+						log.Error("error occured saving blockheight", "error", err)
+					}
 				}
 				bridge.mut.Unlock()
 			case <-ctx.Done():
@@ -336,10 +557,89 @@ func (bridge *Bridge) Start(ctx context.Context) error {
 	return nil
 }
 
+// lead starts the duties of the master, they stop when the context is canceled
+func (bridge *Bridge) lead(ctx context.Context, withdrawChan chan<- WithdrawEvent) error {
+	// Scan bridge account for outgoing transactions to avoid double withdraws or refunds
+	if err := bridge.wallet.ScanBridgeAccount(); err != nil {
+		return err
+	}
+
+	// Monitor the bridge wallet for incoming transactions
+	// mint transactions on ERC20 if possible
+	go func() {
+		if err := bridge.wallet.MonitorBridgeAccountAndMint(ctx, bridge.mint, bridge.blockPersistency); err != nil {
+			panic(err)
+		}
+	}()
+
+	go bridge.processApprovalQueue(ctx)
+	go bridge.processFailedWithdrawals(ctx)
+	go bridge.monitorSigners(ctx)
+	go bridge.signersClient.MonitorPeers(ctx)
+
+	// Sync up any withdrawals made if the blockheight is manually set
+	// to a previous value
+	currentBlock, err := bridge.bridgeContract.ethc.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	var lastHeight uint64
+	// If the user provides a height to rescan from, use that
+	// Otherwise use the saved height in the persistency file
+	if bridge.config.RescanFromHeight > 0 {
+		lastHeight = uint64(bridge.config.RescanFromHeight) - EthBlockDelay
+	} else {
+		height, err := bridge.blockPersistency.GetHeight()
+		if err != nil {
+			return err
+		}
+		// if the saved height is 0, just use current block
+		if height.LastHeight == 0 {
+			lastHeight = currentBlock
+		}
+		if height.LastHeight > EthBlockDelay {
+			lastHeight = height.LastHeight - EthBlockDelay
+		}
+	}
+
+	if lastHeight < currentBlock {
+		// todo filter logs
+		go func() {
+			if err := bridge.bridgeContract.FilterWithdraw(withdrawChan, lastHeight, currentBlock); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	return nil
+}
+
+// leading returns true if the bridge acts as the master
+func (bridge *Bridge) leading() bool {
+	if bridge.election != nil {
+		return bridge.election.Leading()
+	}
+	return !bridge.config.Follower
+}
+
+// resumeHeight returns the height to resume from after a restart or a change of master,
+// the height of the oldest withdrawal that is not paid out yet or else the head
+// Withdrawals that are already paid out are skipped by their memo.
+func resumeHeight(head uint64, txMap map[string]WithdrawEvent) uint64 {
+	height := head
+	for _, we := range txMap {
+		if we.blockHeight < height {
+			height = we.blockHeight
+		}
+	}
+	return height
+}
+
 func (bridge *Bridge) withdraw(ctx context.Context, we WithdrawEvent) (err error) {
 	// if a withdraw was made to the bridge fee wallet or the bridge address, soak the funds and return
 	//TODO: Should these adresses be fetched through the wallet?
-	if we.blockchain_address == bridge.wallet.Config.StellarFeeWallet || we.blockchain_address == bridge.wallet.GetAddress() {
+	_, account, parseErr := stellar.ParseWithdrawalDestination(we.blockchain_address)
+	if parseErr == nil && (account == bridge.wallet.Config.StellarFeeWallet || account == bridge.wallet.GetVaultAddress()) {
 		log.Warn("Received a withdrawal with destination which is either the fee wallet or the bridge wallet, skipping...")
 		return nil
 	}
@@ -352,17 +652,47 @@ func (bridge *Bridge) withdraw(ctx context.Context, we WithdrawEvent) (err error
 		return
 	}
 
-	if amount <= uint64(WithdrawFee) {
-		log.Warn("Withdrawn amount is less than the withdraw fee, skip it", "amount", stellar.StroopsToDecimal(int64(amount)), "ethTx", hash)
+	withdrawFee, err := bridge.bridgeContract.GetWithdrawFee(new(big.Int).SetUint64(we.blockHeight))
+	if err != nil {
+		return fmt.Errorf("failed to get the withdraw fee: %w", err)
+	}
+
+	if amount <= uint64(withdrawFee) {
+		log.Warn("Withdrawn amount is less than the withdraw fee, skip it", "amount", stellar.StroopsToDecimal(int64(amount)), "fee", stellar.StroopsToDecimal(withdrawFee), "ethTx", hash)
 		return
 	}
 
 	log.Info("Creating a withdraw tx", "ethTx", hash, "destination", we.blockchain_address, "amount", stellar.StroopsToDecimal(int64(amount)))
 
-	amount -= uint64(WithdrawFee)
+	approval, err := bridge.checkTransfer(bridge.withdrawGuard, approvals.Entry{
+		Transfer: approvals.Transfer{
+			Kind:        approvals.KindWithdraw,
+			ID:          hex.EncodeToString(hash[:]),
+			Destination: we.blockchain_address,
+			Amount:      we.amount.Int64(),
+		},
+		Receiver:    we.receiver.Hex(),
+		BlockHeight: we.blockHeight,
+		LogIndex:    we.logIndex,
+	})
+	if err != nil {
+		return
+	}
+
+	amount -= uint64(withdrawFee)
 	//TODO: Should this adress be fetched through the wallet?
-	includeWithdrawFee := bridge.wallet.Config.StellarFeeWallet != ""
-	err = bridge.wallet.CreateAndSubmitPayment(ctx, we.blockchain_address, amount, we.receiver, we.blockHeight, hash, "", includeWithdrawFee)
+	// Only pay the withdraw fee to the fee wallet if there is one
+	if bridge.wallet.Config.StellarFeeWallet == "" {
+		withdrawFee = 0
+	}
+	err = bridge.wallet.CreateAndSubmitPayment(ctx, we.blockchain_address, amount, we.receiver, we.blockHeight, hash, we.logIndex, withdrawFee, approval)
+	if err == faults.ErrUnclaimablePayment {
+		log.Warn("Withdrawal can not be paid out, recording it as failed", "ethTx", hash, "destination", we.blockchain_address)
+		if recordErr := bridge.recordFailedWithdrawal(we); recordErr != nil {
+			return recordErr
+		}
+		return faults.ErrUnclaimablePayment
+	}
 	if err != nil {
 		log.Error(fmt.Sprintf("failed to create payment for withdrawal to %s, %s", we.blockchain_address, err.Error()))
 	}
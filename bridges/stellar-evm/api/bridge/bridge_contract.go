@@ -1,8 +1,10 @@
 package bridge
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 	"sync"
@@ -261,6 +263,7 @@ type WithdrawEvent struct {
 	txHash             common.Hash
 	blockHash          common.Hash
 	blockHeight        uint64
+	logIndex           uint
 	raw                []byte
 }
 
@@ -299,13 +302,18 @@ func (w WithdrawEvent) BlockHeight() uint64 {
 	return w.blockHeight
 }
 
+// LogIndex is the index of the Withdraw log in the containing block
+func (w WithdrawEvent) LogIndex() uint {
+	return w.logIndex
+}
+
 // SubscribeWithdraw subscribes to new Withdraw events on the given contract. This call blocks
 // and prints out info about any withdraw as it happened
-func (bridge *BridgeContract) SubscribeWithdraw(wc chan<- WithdrawEvent, startHeight uint64) error {
+func (bridge *BridgeContract) SubscribeWithdraw(ctx context.Context, wc chan<- WithdrawEvent, startHeight uint64) error {
 	log.Info("Subscribing to withdraw events", "start height", startHeight)
 	sink := make(chan *tokenv1.TokenWithdraw)
 	//TODO: bug: startHeight is not taken into account but a test in another program shows it does not work anyway
-	watchOpts := &bind.WatchOpts{Context: context.TODO(), Start: nil}
+	watchOpts := &bind.WatchOpts{Context: ctx, Start: nil}
 
 	sub := event.Resubscribe(backOffMax, func(ctx context.Context) (event.Subscription, error) {
 		sub, err := bridge.WatchWithdraw(watchOpts, sink, nil)
@@ -319,6 +327,8 @@ func (bridge *BridgeContract) SubscribeWithdraw(wc chan<- WithdrawEvent, startHe
 	defer sub.Unsubscribe()
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
 		case err := <-sub.Err():
 			return err
 		case withdraw := <-sink:
@@ -327,16 +337,22 @@ func (bridge *BridgeContract) SubscribeWithdraw(wc chan<- WithdrawEvent, startHe
 				continue
 			}
 			log.Debug("Noticed withdraw event", "receiver", withdraw.Receiver, "amount", withdraw.Tokens)
-			wc <- WithdrawEvent{
+			we := WithdrawEvent{
 				receiver:           withdraw.Receiver,
 				amount:             withdraw.Tokens,
 				txHash:             withdraw.Raw.TxHash,
 				blockHash:          withdraw.Raw.BlockHash,
 				blockHeight:        withdraw.Raw.BlockNumber,
+				logIndex:           withdraw.Raw.Index,
 				blockchain_address: withdraw.BlockchainAddress,
 				network:            withdraw.Network,
 				raw:                withdraw.Raw.Data,
 			}
+			select {
+			case wc <- we:
+			case <-ctx.Done():
+				return nil
+			}
 		}
 	}
 }
@@ -412,6 +428,7 @@ func (bridge *BridgeContract) FilterWithdraw(wc chan<- WithdrawEvent, startHeigh
 			txHash:             withdrawEvent.Event.Raw.TxHash,
 			blockHash:          withdrawEvent.Event.Raw.BlockHash,
 			blockHeight:        withdrawEvent.Event.Raw.BlockNumber,
+			logIndex:           withdrawEvent.Event.Raw.Index,
 			blockchain_address: withdrawEvent.Event.BlockchainAddress,
 			network:            withdrawEvent.Event.Network,
 			raw:                withdrawEvent.Event.Raw.Data,
@@ -420,6 +437,65 @@ func (bridge *BridgeContract) FilterWithdraw(wc chan<- WithdrawEvent, startHeigh
 	return nil
 }
 
+// GetWithdrawEvent returns the withdraw event emitted by the token contract in the transaction with the given hash
+func (bridge *BridgeContract) GetWithdrawEvent(txHash common.Hash) (WithdrawEvent, error) {
+	events, err := bridge.GetWithdrawEvents(txHash)
+	if err != nil {
+		return WithdrawEvent{}, err
+	}
+	if len(events) == 0 {
+		return WithdrawEvent{}, fmt.Errorf("no withdraw event found in transaction %s", txHash.Hex())
+	}
+	return events[0], nil
+}
+
+// GetWithdrawEvents returns the withdraw events emitted by the token contract in the transaction with the given hash
+// The events are taken from the receipt of the transaction, a failed transaction has none.
+func (bridge *BridgeContract) GetWithdrawEvents(txHash common.Hash) (events []WithdrawEvent, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	receipt, err := bridge.ethc.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return
+	}
+	for _, l := range receipt.Logs {
+		if l.Address != bridge.networkConfig.ContractAddress || l.Removed {
+			continue
+		}
+		event, err := bridge.tftContract.filter.ParseWithdraw(*l)
+		if err != nil {
+			// not a withdraw event
+			continue
+		}
+		events = append(events, WithdrawEvent{
+			receiver:           event.Receiver,
+			amount:             event.Tokens,
+			txHash:             event.Raw.TxHash,
+			blockHash:          event.Raw.BlockHash,
+			blockHeight:        event.Raw.BlockNumber,
+			logIndex:           event.Raw.Index,
+			blockchain_address: event.BlockchainAddress,
+			network:            event.Network,
+			raw:                event.Raw.Data,
+		})
+	}
+	return
+}
+
+// IsConfirmed checks if the block at the given height has at least confirmations blocks on top of it
+func (bridge *BridgeContract) IsConfirmed(height uint64, confirmations uint64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	head, err := bridge.ethc.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	return head >= height+confirmations, nil
+}
+
 func (bridge *BridgeContract) Mint(receiver tfeth.ERC20Address, amount *big.Int, txID string, signatures []tokenv1.Signature) error {
 	err := bridge.mint(receiver, amount, txID, signatures)
 	for IsNoPeerErr(err) {
@@ -489,6 +565,81 @@ func (bridge *BridgeContract) GetRequiresSignatureCount() (*big.Int, error) {
 	return bridge.tftContract.caller.GetSignaturesRequired(opts)
 }
 
+// GetWithdrawFee returns the withdraw fee in stroops as configured in the token contract at blockNumber,
+// or at the latest block if blockNumber is nil.
+// The contract is the single source of truth for the fee and withdrawals read it at the block of their Withdraw event,
+// so the master and the cosigners agree on it even if the fee changes in the meantime.
+// It fails if the node no longer has the state of blockNumber, a node that keeps the state of old blocks is needed then.
+// If the contract does not support the withdraw fee or the fee was never set, DefaultWithdrawFee is returned.
+func (bridge *BridgeContract) GetWithdrawFee(blockNumber *big.Int) (int64, error) {
+	log.Debug("Calling GetWithdrawFee", "block", blockNumber)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: blockNumber}
+	supported, err := bridge.supportsWithdrawFee(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if the token contract supports a withdraw fee: %w", err)
+	}
+	if !supported {
+		log.Debug("The token contract does not support a withdraw fee, using the default fee", "block", blockNumber)
+		return DefaultWithdrawFee, nil
+	}
+	set, err := bridge.tftContract.caller.IsWithdrawFeeSet(opts)
+	if err != nil {
+		return 0, err
+	}
+	if !set {
+		log.Debug("The withdraw fee is not set in the token contract, using the default fee", "block", blockNumber)
+		return DefaultWithdrawFee, nil
+	}
+	fee, err := bridge.tftContract.caller.GetWithdrawFee(opts)
+	if err != nil {
+		return 0, err
+	}
+	if !fee.IsInt64() {
+		return 0, errors.New("the withdraw fee in the token contract is out of range")
+	}
+	return fee.Int64(), nil
+}
+
+// supportsWithdrawFee checks if the implementation of the token contract has the withdraw fee functions
+// The token contract is a proxy, the code of the implementation it delegates to is searched for the function selector.
+func (bridge *BridgeContract) supportsWithdrawFee(opts *bind.CallOpts) (bool, error) {
+	implementation, err := bridge.tftContract.caller.Implementation(opts)
+	if err != nil {
+		return false, err
+	}
+	code, err := bridge.ethc.CodeAt(opts.Context, implementation, opts.BlockNumber)
+	if err != nil {
+		return false, err
+	}
+	if len(code) == 0 {
+		return false, fmt.Errorf("there is no contract at the implementation address %s", implementation.Hex())
+	}
+	parsed, err := tokenv1.TokenMetaData.GetAbi()
+	if err != nil {
+		return false, err
+	}
+	return hasFunctionSelector(code, parsed.Methods["isWithdrawFeeSet"].ID), nil
+}
+
+// hasFunctionSelector checks if the code of a contract pushes a function selector, like the dispatcher of a contract does
+func hasFunctionSelector(code []byte, selector []byte) bool {
+	// the compiler drops the leading zero bytes, PUSH1 is 0x60
+	trimmed := bytes.TrimLeft(selector, "\x00")
+	push := append([]byte{byte(0x5f + len(trimmed))}, trimmed...)
+	return bytes.Contains(code, push)
+}
+
+// GetTotalSupply returns the total supply of the token in stroops
+func (bridge *BridgeContract) GetTotalSupply() (*big.Int, error) {
+	log.Debug("Calling GetTotalSupply")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	opts := &bind.CallOpts{Context: ctx}
+	return bridge.tftContract.caller.TotalSupply(opts)
+}
+
 // GetSigners returns the list of signers for the contract
 func (bridge *BridgeContract) GetSigners() ([]common.Address, error) {
 	log.Debug("Calling GetSigners")
@@ -498,6 +649,43 @@ func (bridge *BridgeContract) GetSigners() ([]common.Address, error) {
 	return bridge.tftContract.caller.GetSigners(opts)
 }
 
+// SetSigners replaces the signers of the mint function and the number of required signatures
+// Only an owner of the token contract can do this.
+func (bridge *BridgeContract) SetSigners(signers []common.Address, signaturesRequired int64) error {
+	accountAddress, err := bridge.ethc.AccountAddress()
+	if err != nil {
+		return err
+	}
+
+	gas, err := bridge.ethc.SuggestGasPrice(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute*6)
+	defer cancel()
+	opts := &bind.TransactOpts{
+		Context: ctx, From: accountAddress,
+		Signer: bridge.getSignerFunc(),
+		Value:  nil, Nonce: nil, GasLimit: gasLimit, GasPrice: gas,
+	}
+
+	log.Info("Setting the signers of the token contract", "tokenaddress", bridge.networkConfig.ContractAddress, "signers", signers, "required", signaturesRequired)
+	tx, err := bridge.tftContract.transactor.SetSigners(opts, signers, big.NewInt(signaturesRequired))
+	if err != nil {
+		return err
+	}
+
+	r, err := bind.WaitMined(ctx, bridge.ethc, tx)
+	if err != nil {
+		return err
+	}
+	if r.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("setting the signers failed in transaction %s", tx.Hash().Hex())
+	}
+	return nil
+}
+
 func (bridge *BridgeContract) isMintTxID(txID string) (bool, error) {
 	log.Debug("Calling isMintID")
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
@@ -0,0 +1,18 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasFunctionSelector(t *testing.T) {
+	// PUSH4 0xa27c15fa EQ
+	code := []byte{0x60, 0x80, 0x63, 0xa2, 0x7c, 0x15, 0xfa, 0x14}
+	assert.True(t, hasFunctionSelector(code, []byte{0xa2, 0x7c, 0x15, 0xfa}))
+	assert.False(t, hasFunctionSelector(code, []byte{0x15, 0x40, 0xaa, 0x89}))
+	// the selector bytes without the PUSH4 are not a selector
+	assert.False(t, hasFunctionSelector([]byte{0xa2, 0x7c, 0x15, 0xfa}, []byte{0xa2, 0x7c, 0x15, 0xfa}))
+	// leading zero bytes are dropped by the compiler: PUSH3 0x7c15fa
+	assert.True(t, hasFunctionSelector([]byte{0x62, 0x7c, 0x15, 0xfa}, []byte{0x00, 0x7c, 0x15, 0xfa}))
+}
@@ -0,0 +1,123 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+const (
+	// supplyCheckInterval is the interval at which the vault balance is compared to the token supply
+	supplyCheckInterval = 10 * time.Minute
+)
+
+var ErrCircuitBreakerTripped = fmt.Errorf("%w: the circuit breaker is tripped, the bridge is paused", ErrTransferRefused)
+
+// CircuitBreaker pauses the bridge when the TFT balance of the Stellar vault account
+// and the token supply on the EVM chain diverge.
+// When tripped, it creates the pause file with the reason so the operator resumes the bridge
+// by removing the pause file, like after a manual pause.
+// Without a pause file, the bridge stays paused until it is restarted.
+type CircuitBreaker struct {
+	bridgeContract *BridgeContract
+	wallet         *stellar.Wallet
+	pauseSwitch    *PauseSwitch
+	// maxDivergence in TFT units, 0 disables the check
+	maxDivergence int64
+
+	tripped bool
+	reason  string
+	// trippedDivergence is the divergence in stroops that tripped the circuit breaker last,
+	// it only trips again when the divergence grows so the operator can resume after investigating
+	trippedDivergence *big.Int
+	mut               sync.RWMutex
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker
+// maxDivergence is the amount in TFT units the token supply is allowed to exceed the vault balance
+func NewCircuitBreaker(bridgeContract *BridgeContract, wallet *stellar.Wallet, pauseSwitch *PauseSwitch, maxDivergence int64) *CircuitBreaker {
+	return &CircuitBreaker{
+		bridgeContract: bridgeContract,
+		wallet:         wallet,
+		pauseSwitch:    pauseSwitch,
+		maxDivergence:  maxDivergence,
+	}
+}
+
+// Trip pauses the bridge
+func (c *CircuitBreaker) Trip(reason string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.tripped {
+		return
+	}
+	log.Error("Circuit breaker tripped, pausing the bridge", "reason", reason)
+	err := c.pauseSwitch.Pause("circuit breaker: " + reason)
+	if err == nil {
+		log.Warn("Remove the pause file to resume the bridge", "file", c.pauseSwitch.file)
+		return
+	}
+	log.Warn("Failed to create the pause file, the bridge stays paused until it is restarted", "err", err)
+	c.tripped = true
+	c.reason = reason
+}
+
+// Check returns ErrCircuitBreakerTripped if the circuit breaker is tripped
+func (c *CircuitBreaker) Check() error {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.tripped {
+		return ErrCircuitBreakerTripped
+	}
+	return nil
+}
+
+// Monitor periodically compares the vault balance with the token supply until the context is cancelled
+func (c *CircuitBreaker) Monitor(ctx context.Context) {
+	if c.maxDivergence <= 0 {
+		log.Info("Supply divergence check disabled")
+		return
+	}
+	for {
+		if err := c.checkSupply(); err != nil {
+			log.Error("Failed to compare the vault balance with the token supply", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(supplyCheckInterval):
+		}
+	}
+}
+
+func (c *CircuitBreaker) checkSupply() error {
+	vaultBalance, err := c.wallet.GetTFTBalance()
+	if err != nil {
+		return err
+	}
+	supply, err := c.bridgeContract.GetTotalSupply()
+	if err != nil {
+		return err
+	}
+	divergence := new(big.Int).Sub(supply, big.NewInt(vaultBalance))
+	log.Debug("Compared the vault balance with the token supply", "vault", stellar.StroopsToDecimal(vaultBalance), "supply", supply, "divergence", divergence)
+	if divergence.Cmp(big.NewInt(stellar.IntToStroops(c.maxDivergence))) > 0 {
+		c.mut.Lock()
+		grown := c.trippedDivergence == nil || divergence.Cmp(c.trippedDivergence) > 0
+		if grown {
+			c.trippedDivergence = divergence
+		}
+		c.mut.Unlock()
+		if !grown {
+			log.Warn("The token supply still exceeds the vault balance", "divergence", divergence)
+			return nil
+		}
+		c.Trip("the token supply exceeds the vault balance by " + divergence.String() + " stroops")
+	}
+	return nil
+}
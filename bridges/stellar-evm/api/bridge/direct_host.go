@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/threefoldtech/libp2p-relay/client"
+)
+
+// DefaultListenAddress is where a host without a relay listens for the other bridges
+const DefaultListenAddress = "/ip4/0.0.0.0/tcp/4001"
+
+// NewDirectHost creates a host that connects to the other bridges directly instead of through a relay
+// The peers are the multiaddrs of the other bridges, ending with their peer ID like /ip4/10.0.0.2/tcp/4001/p2p/12D3KooW...
+// The host only connects to the private network of the bridges with the same psk.
+func NewDirectHost(secret string, listen []string, peers []string, psk string) (host.Host, error) {
+	if psk == "" {
+		return nil, errors.New("connecting to the other bridges directly requires a psk")
+	}
+	privKey, err := privateKeyFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]peer.AddrInfo, 0, len(peers))
+	for _, p := range peers {
+		info, err := peer.AddrInfoFromString(p)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	cmgr, err := connmgr.NewConnManager(100, 400)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []libp2p.Option{
+		libp2p.Identity(privKey),
+		libp2p.ListenAddrStrings(listen...),
+		// quic does not support private networks
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.ConnectionManager(cmgr),
+	}
+	key, err := decodePSK(psk)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, libp2p.PrivateNetwork(key))
+	h, err := libp2p.New(options...)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		h.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	}
+	return h, nil
+}
+
+// connectToPeer connects to a peer unless it is connected already
+// A host with a relay finds the peer through the router or connects through the relay,
+// a direct host connects to the addresses of the peer it knows.
+func connectToPeer(ctx context.Context, h host.Host, router routing.PeerRouting, relay *peer.AddrInfo, id peer.ID) error {
+	if h.Network().Connectedness(id) == network.Connected {
+		return nil
+	}
+	if arHost, ok := h.(*autorelay.AutoRelayHost); ok {
+		return client.ConnectToPeer(ctx, arHost, router, relay, id)
+	}
+	return h.Connect(ctx, h.Peerstore().PeerInfo(id))
+}
@@ -0,0 +1,57 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+)
+
+const testPSK = "e1d5a7e2f0c4b3a29687d5c4b3a2918e7d6c5b4a39281706f5e4d3c2b1a09f8e"
+
+func TestDirectHosts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys := []*keypair.Full{keypair.MustRandom(), keypair.MustRandom(), keypair.MustRandom()}
+	candidates := []string{keys[0].Address(), keys[1].Address(), keys[2].Address()}
+	hosts := make([]host.Host, 0, len(keys))
+	var peers []string
+	for _, kp := range keys {
+		h, err := NewDirectHost(kp.Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, peers, testPSK)
+		assert.NoError(t, err)
+		defer h.Close()
+		hosts = append(hosts, h)
+		peers = append(peers, fmt.Sprintf("%s/p2p/%s", h.Addrs()[0], h.ID()))
+	}
+
+	elections := make([]*Election, 0, len(hosts))
+	for i, h := range hosts {
+		e, err := NewElection(h, nil, nil, candidates[i], candidates, state.NewChainPersistency(filepath.Join(t.TempDir(), "node.json")))
+		assert.NoError(t, err)
+		elections = append(elections, e)
+	}
+
+	// The last host knows the addresses of the others and connects to them
+	elections[2].sendHeartbeats(ctx)
+	for i := 0; i < 2; i++ {
+		assert.False(t, elections[2].candidates[hosts[i].ID()].lastSeen.IsZero())
+		assert.False(t, elections[i].candidates[hosts[2].ID()].lastSeen.IsZero())
+	}
+
+	// A host with another psk can not connect
+	other, err := NewDirectHost(keypair.MustRandom().Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, peers[:1], "00"+testPSK[2:])
+	assert.NoError(t, err)
+	defer other.Close()
+	assert.Error(t, connectToPeer(ctx, other, nil, nil, hosts[0].ID()))
+
+	// A private network is required
+	_, err = NewDirectHost(keypair.MustRandom().Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, peers[:1], "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,289 @@
+package bridge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/contracts/tokenv1"
+	tfeth "github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth/ethtest"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar/horizontest"
+)
+
+// e2eNetwork is a fake Stellar network and EVM chain the bridges of a test run against
+type e2eNetwork struct {
+	t       *testing.T
+	ledger  *horizontest.Ledger
+	horizon *horizonclient.Client
+	chain   *ethtest.Chain
+	evm     *ethtest.Server
+	// contract is the address of the token contract
+	contract common.Address
+	chainID  *big.Int
+}
+
+// e2eBridge is the configuration of a bridge of the test network
+type e2eBridge struct {
+	stellarKey *keypair.Full
+	ethKey     *ecdsa.PrivateKey
+	host       host.Host
+}
+
+func (b e2eBridge) ethAddress() common.Address {
+	return crypto.PubkeyToAddress(b.ethKey.PublicKey)
+}
+
+func newE2ENetwork(t *testing.T) *e2eNetwork {
+	networkConfig, err := tfeth.GetEthNetworkConfiguration("hardhat")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ledger := horizontest.NewLedger(stellar.GetNetworkPassPhrase("testnet"))
+	horizonServer := horizontest.NewServer(ledger)
+	t.Cleanup(horizonServer.Close)
+
+	chain, err := ethtest.NewChain(networkConfig.NetworkID, networkConfig.ContractAddress, common.Address{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	evm, err := ethtest.NewServer(chain)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(evm.Close)
+
+	return &e2eNetwork{
+		t:        t,
+		ledger:   ledger,
+		horizon:  &horizonclient.Client{HorizonURL: horizonServer.URL},
+		chain:    chain,
+		evm:      evm,
+		contract: networkConfig.ContractAddress,
+		chainID:  new(big.Int).SetUint64(networkConfig.NetworkID),
+	}
+}
+
+// mine mines a block regularly until the test ends, like a real chain
+func (n *e2eNetwork) mine(ctx context.Context) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.chain.Mine()
+		}
+	}
+}
+
+// startBridge wires a bridge like main does, the vault is the account of the master
+func (n *e2eNetwork) startBridge(ctx context.Context, b e2eBridge, master string, feeWallet string, follower bool) {
+	t := n.t
+	dir := t.TempDir()
+	bridgeCfg := &BridgeConfig{
+		PersistencyFile:       filepath.Join(dir, "node.json"),
+		Follower:              follower,
+		Direct:                true,
+		DepositFee:            10,
+		ApprovalQueueFile:     filepath.Join(dir, "approvals.json"),
+		PauseFile:             filepath.Join(dir, "pause"),
+		PauseHistoryFile:      filepath.Join(dir, "pausehistory.json"),
+		FailedWithdrawalsFile: filepath.Join(dir, "failedwithdrawals.json"),
+		SignTimeout:           DefaultSignTimeout,
+		CosignerTimeout:       DefaultCosignerTimeout,
+	}
+	stellarCfg := &stellar.StellarConfig{
+		StellarSeed:      b.stellarKey.Seed(),
+		StellarNetwork:   "testnet",
+		StellarFeeWallet: feeWallet,
+	}
+	ethCfg := &EthConfig{
+		EthNetworkName: "hardhat",
+		EthUrl:         n.evm.URL,
+		EthPrivateKey:  hex.EncodeToString(crypto.FromECDSA(b.ethKey)),
+	}
+
+	txStorage := stellar.NewTransactionStorage(stellarCfg.StellarNetwork, n.horizon, master)
+	if !assert.NoError(t, txStorage.ScanBridgeAccount()) {
+		t.FailNow()
+	}
+	contract, err := NewBridgeContract(ethCfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	wallet, err := stellar.NewWallet(stellarCfg, bridgeCfg.DepositFee, contract, txStorage, n.horizon)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	wallet.SetVaultAddress(master)
+	pauseSwitch, err := NewPauseSwitch(bridgeCfg.PauseFile, bridgeCfg.PauseHistoryFile)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	wallet.SetPauseSwitch(pauseSwitch)
+	circuitBreaker := NewCircuitBreaker(contract, wallet, pauseSwitch, bridgeCfg.MaxSupplyDivergence)
+
+	br, err := NewBridge(ctx, wallet, contract, bridgeCfg, b.host, nil, pauseSwitch, circuitBreaker)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, br.Start(ctx)) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = br.Close() })
+	if follower {
+		err = NewSignerServer(b.host, master, contract, wallet, bridgeCfg, pauseSwitch, circuitBreaker, nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+}
+
+// pay submits a TFT payment from an account with the given memo
+func (n *e2eNetwork) pay(from *keypair.Full, to string, amount string, memo txnbuild.Memo, extra ...txnbuild.Operation) hProtocol.Transaction {
+	t := n.t
+	source, err := n.horizon.AccountDetail(horizonclient.AccountRequest{AccountID: from.Address()})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	asset, err := txnbuild.ParseAssetString(stellar.TFTTest)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &source,
+		IncrementSequenceNum: true,
+		Operations:           append([]txnbuild.Operation{&txnbuild.Payment{Destination: to, Amount: amount, Asset: asset}}, extra...),
+		BaseFee:              txnbuild.MinBaseFee,
+		Memo:                 memo,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tx, err = tx.Sign(stellar.GetNetworkPassPhrase("testnet"), from)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	result, err := n.horizon.SubmitTransaction(tx)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return result
+}
+
+func (n *e2eNetwork) tftBalance(address string) int64 {
+	return n.ledger.Balance(address, stellar.TFTTest)
+}
+
+// TestEndToEnd runs a master and two cosigners over libp2p against a fake Horizon server and token chain
+// and checks deposits are minted or refunded and withdrawals are paid out, with the fees sent to the fee wallet.
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the end-to-end test waits for the bridge to poll the vault account")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newE2ENetwork(t)
+	go n.mine(ctx)
+
+	// the cosigners listen and the master connects to them
+	bridges := make([]e2eBridge, 3)
+	var peers []string
+	for i := len(bridges) - 1; i >= 0; i-- {
+		kp := keypair.MustRandom()
+		ethKey, err := crypto.GenerateKey()
+		assert.NoError(t, err)
+		h, err := NewDirectHost(kp.Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, peers, testPSK)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		defer h.Close()
+		bridges[i] = e2eBridge{stellarKey: kp, ethKey: ethKey, host: h}
+		peers = append(peers, fmt.Sprintf("%s/p2p/%s", h.Addrs()[0], h.ID()))
+	}
+	master := bridges[0]
+	vault := master.stellarKey.Address()
+
+	feeWallet := keypair.MustRandom().Address()
+	user := keypair.MustRandom()
+	for _, address := range []string{vault, feeWallet, user.Address(), bridges[1].stellarKey.Address(), bridges[2].stellarKey.Address()} {
+		n.ledger.CreateAccount(address)
+		n.ledger.AddTrustline(address, stellar.TFTTest)
+	}
+	n.ledger.Fund(user.Address(), stellar.TFTTest, stellar.IntToStroops(1000))
+
+	// 2 out of the 3 bridges have to sign on both sides
+	signers := map[string]int32{}
+	ethSigners := make([]common.Address, 0, len(bridges))
+	for _, b := range bridges {
+		signers[b.stellarKey.Address()] = 1
+		ethSigners = append(ethSigners, b.ethAddress())
+	}
+	n.ledger.SetSigners(vault, signers, hProtocol.AccountThresholds{LowThreshold: 1, MedThreshold: 2, HighThreshold: 3})
+	n.chain.SetSigners(ethSigners, 2)
+	n.chain.SetWithdrawFee(stellar.IntToStroops(1))
+
+	for i := len(bridges) - 1; i >= 0; i-- {
+		n.startBridge(ctx, bridges[i], vault, feeWallet, i > 0)
+	}
+
+	// A deposit with the EVM address in the memo is minted, the deposit fee goes to the fee wallet
+	// and the XLM in the deposit is refunded with the fee transfer
+	userKey, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	userEth := crypto.PubkeyToAddress(userKey.PublicKey)
+	xlm := n.ledger.Balance(user.Address(), horizontest.NativeAsset)
+	deposit := n.pay(user, vault, "100", txnbuild.MemoHash(common.BytesToHash(userEth.Bytes())), &txnbuild.Payment{Destination: vault, Amount: "5", Asset: txnbuild.NativeAsset{}})
+	// A deposit with a memo that is not an EVM address is refunded, minus the withdraw fee as penalty
+	refunded := n.pay(user, vault, "50", txnbuild.MemoText("not an address"))
+
+	assert.Eventually(t, func() bool {
+		return n.chain.IsMintID(deposit.Hash)
+	}, time.Minute, 100*time.Millisecond, "the deposit is not minted")
+	assert.Equal(t, big.NewInt(stellar.IntToStroops(90)), n.chain.BalanceOf(userEth))
+	assert.Eventually(t, func() bool {
+		return n.tftBalance(feeWallet) == stellar.IntToStroops(10+1)
+	}, time.Minute, 100*time.Millisecond, "the deposit fee and the refund penalty are not transferred")
+	assert.Equal(t, stellar.IntToStroops(1000-100-1), n.tftBalance(user.Address()))
+	assert.False(t, n.chain.IsMintID(refunded.Hash))
+	assert.Equal(t, xlm, n.ledger.Balance(user.Address(), horizontest.NativeAsset))
+
+	// A withdrawal is paid out after EthBlockDelay blocks, minus the withdraw fee that goes to the fee wallet
+	evm, err := ethclient.Dial(n.evm.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer evm.Close()
+	token, err := tokenv1.NewTokenTransactor(n.contract, evm)
+	assert.NoError(t, err)
+	opts, err := bind.NewKeyedTransactorWithChainID(userKey, n.chainID)
+	assert.NoError(t, err)
+	_, err = token.Withdraw(opts, big.NewInt(stellar.IntToStroops(40)), user.Address(), BridgeNetwork)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(stellar.IntToStroops(50)), n.chain.BalanceOf(userEth))
+
+	assert.Eventually(t, func() bool {
+		return n.tftBalance(user.Address()) == stellar.IntToStroops(1000-100-1+39)
+	}, time.Minute, 100*time.Millisecond, "the withdrawal is not paid out")
+	assert.Equal(t, stellar.IntToStroops(10+1+1), n.tftBalance(feeWallet))
+	assert.Equal(t, stellar.IntToStroops(100+50-10-49-1-39-1), n.tftBalance(vault))
+}
@@ -0,0 +1,171 @@
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+const (
+	// failedWithdrawalsInterval is the interval at which failed withdrawals are retried or returned
+	failedWithdrawalsInterval = 10 * time.Minute
+	// withdrawalReturnPrefix is the prefix of the mint txid of a returned withdrawal
+	withdrawalReturnPrefix = "return-"
+)
+
+// WithdrawalReturnTxID is the mint txid used to return a withdrawal that could not be paid out.
+// It can not collide with the Stellar transaction hashes used as txid for deposits.
+func WithdrawalReturnTxID(txHash common.Hash) string {
+	return withdrawalReturnPrefix + hex.EncodeToString(txHash[:])
+}
+
+// parseWithdrawalReturnTxID returns the hash of the withdrawal transaction if txID is the txid of a returned withdrawal
+func parseWithdrawalReturnTxID(txID string) (common.Hash, bool) {
+	encodedHash, ok := strings.CutPrefix(txID, withdrawalReturnPrefix)
+	if !ok {
+		return common.Hash{}, false
+	}
+	hash, err := hex.DecodeString(encodedHash)
+	if err != nil || len(hash) != common.HashLength {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(hash), true
+}
+
+func (bridge *Bridge) recordFailedWithdrawal(we WithdrawEvent) error {
+	hash := we.TxHash()
+	return bridge.failedWithdrawals.Add(state.FailedWithdrawal{
+		TxHash:      hex.EncodeToString(hash[:]),
+		Receiver:    we.receiver.Hex(),
+		Destination: we.blockchain_address,
+		Amount:      we.amount.Int64(),
+		BlockHeight: we.blockHeight,
+		LogIndex:    we.logIndex,
+		Failed:      time.Now(),
+	})
+}
+
+// recordRejectedWithdrawal records a withdrawal rejected by an operator so it is returned to the receiver,
+// the tokens are burned already
+func (bridge *Bridge) recordRejectedWithdrawal(entry approvals.Entry) error {
+	return bridge.failedWithdrawals.Add(state.FailedWithdrawal{
+		TxHash:      entry.ID,
+		Receiver:    entry.Receiver,
+		Destination: entry.Destination,
+		Amount:      entry.Amount,
+		BlockHeight: entry.BlockHeight,
+		LogIndex:    entry.LogIndex,
+		Failed:      time.Now(),
+		Rejected:    true,
+		Rejection:   entry.Rejection,
+	})
+}
+
+// processFailedWithdrawals retries the withdrawals that could not be paid out
+// and returns them to the receiver on the EVM chain once ReturnFailedWithdrawalsAfter has passed.
+// This call blocks until the context is cancelled.
+func (bridge *Bridge) processFailedWithdrawals(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(failedWithdrawalsInterval):
+		}
+		if bridge.pauseSwitch.Check() != nil {
+			continue
+		}
+
+		withdrawals, err := bridge.failedWithdrawals.List()
+		if err != nil {
+			log.Error("Failed to read the failed withdrawals", "err", err)
+			continue
+		}
+		for _, withdrawal := range withdrawals {
+			err = bridge.processFailedWithdrawal(ctx, withdrawal)
+			if err == faults.ErrUnclaimablePayment {
+				continue
+			}
+			if err != nil && err != faults.ErrAwaitingApproval && err != faults.ErrTransferDeferred && err != faults.ErrTransferRejected {
+				log.Error("Failed to process failed withdrawal", "ethTx", withdrawal.TxHash, "err", err)
+				continue
+			}
+			// The withdrawal is paid out, returned or taken over by the approval queue
+			if err = bridge.failedWithdrawals.Remove(withdrawal.TxHash); err != nil {
+				log.Error("Failed to remove failed withdrawal", "ethTx", withdrawal.TxHash, "err", err)
+			}
+		}
+	}
+}
+
+func (bridge *Bridge) processFailedWithdrawal(ctx context.Context, withdrawal state.FailedWithdrawal) error {
+	returnAfter := bridge.config.ReturnFailedWithdrawalsAfter
+	// An invalid destination will never become payable
+	_, _, err := stellar.ParseWithdrawalDestination(withdrawal.Destination)
+	if err != nil || withdrawal.Rejected || (returnAfter > 0 && time.Since(withdrawal.Failed) >= returnAfter) {
+		return bridge.returnWithdrawal(withdrawal)
+	}
+
+	payable, err := bridge.wallet.IsPayable(withdrawal.Destination)
+	if err != nil {
+		return err
+	}
+	if !payable {
+		return faults.ErrUnclaimablePayment
+	}
+	log.Info("Retrying failed withdrawal", "ethTx", withdrawal.TxHash, "destination", withdrawal.Destination)
+	bridge.mut.Lock()
+	defer bridge.mut.Unlock()
+	return bridge.withdraw(ctx, WithdrawEvent{
+		receiver:           common.HexToAddress(withdrawal.Receiver),
+		amount:             big.NewInt(withdrawal.Amount),
+		blockchain_address: withdrawal.Destination,
+		network:            BridgeNetwork,
+		txHash:             common.HexToHash(withdrawal.TxHash),
+		blockHeight:        withdrawal.BlockHeight,
+		logIndex:           withdrawal.LogIndex,
+	})
+}
+
+// returnWithdrawal mints the withdrawn tokens minus the withdraw fee back to the receiver on the EVM chain
+func (bridge *Bridge) returnWithdrawal(withdrawal state.FailedWithdrawal) error {
+	if !bridge.synced {
+		return errors.New("bridge is not synced, retry later")
+	}
+	txID := WithdrawalReturnTxID(common.HexToHash(withdrawal.TxHash))
+	known, err := bridge.bridgeContract.IsMintTxID(txID)
+	if err != nil {
+		return err
+	}
+	if known {
+		log.Info("Skipping returned withdrawal", "ethTx", withdrawal.TxHash)
+		return nil
+	}
+	if err = bridge.mintGuard.checkPaused(); err != nil {
+		return err
+	}
+
+	withdrawFee, err := bridge.bridgeContract.GetWithdrawFee(new(big.Int).SetUint64(withdrawal.BlockHeight))
+	if err != nil {
+		return err
+	}
+	amount := withdrawal.Amount - withdrawFee
+	if amount <= 0 {
+		log.Warn("Failed withdrawal does not cover the withdraw fee, dropping it", "ethTx", withdrawal.TxHash, "amount", stellar.StroopsToDecimal(withdrawal.Amount))
+		return nil
+	}
+
+	log.Info("Returning failed withdrawal", "ethTx", withdrawal.TxHash, "receiver", withdrawal.Receiver, "amount", stellar.StroopsToDecimal(amount))
+	// The cosigners only return a withdrawal that can be paid out if the operator rejected it
+	return bridge.mintWithSignatures(eth.ERC20Address(common.HexToAddress(withdrawal.Receiver)), big.NewInt(amount), txID, withdrawal.Rejection)
+}
@@ -0,0 +1,22 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdrawalReturnTxID(t *testing.T) {
+	hash := common.HexToHash("0x5c6d7a3f1e1f0a1b1cc2e8f9a1b2c3d4e5f60718293a4b5c6d7e8f9012345678")
+
+	parsed, ok := parseWithdrawalReturnTxID(WithdrawalReturnTxID(hash))
+	assert.True(t, ok)
+	assert.Equal(t, hash, parsed)
+
+	// Stellar transaction hashes are used as txid for deposits
+	_, ok = parseWithdrawalReturnTxID("5c6d7a3f1e1f0a1b1cc2e8f9a1b2c3d4e5f60718293a4b5c6d7e8f9012345678")
+	assert.False(t, ok)
+	_, ok = parseWithdrawalReturnTxID("return-1234")
+	assert.False(t, ok)
+}
@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+var (
+	// ErrTransferRefused is the parent of the errors for transfers the bridge does not execute (yet)
+	ErrTransferRefused  = errors.New("transfer refused")
+	ErrApprovalRequired = fmt.Errorf("%w: an operator approval is required", ErrTransferRefused)
+	ErrInvalidApproval  = fmt.Errorf("%w: invalid operator approval", ErrTransferRefused)
+)
+
+// transferGuard decides if a mint or a withdrawal can be executed
+type transferGuard struct {
+	pauseSwitch    *PauseSwitch
+	circuitBreaker *CircuitBreaker
+	limiter        *transferLimiter
+	// approvalThreshold in stroops, transfers above it need an operator approval, 0 disables it
+	approvalThreshold int64
+	// approver is the Stellar address of the operator that approves transfers, empty if approvals are disabled
+	approver string
+}
+
+func newTransferGuard(config *BridgeConfig, pauseSwitch *PauseSwitch, circuitBreaker *CircuitBreaker) *transferGuard {
+	return &transferGuard{
+		pauseSwitch:       pauseSwitch,
+		circuitBreaker:    circuitBreaker,
+		limiter:           newTransferLimiter(config.TransferLimits),
+		approvalThreshold: stellar.IntToStroops(config.ApprovalThreshold),
+		approver:          config.Approver,
+	}
+}
+
+// check returns nil if the transfer can be executed
+// A transfer above the approval threshold or exceeding the transfer limits needs an operator approval.
+// Approved transfers are not counted in the transfer limits.
+func (g *transferGuard) check(t approvals.Transfer, approval string) error {
+	if err := g.checkPaused(); err != nil {
+		return err
+	}
+	if approval != "" {
+		if g.approver == "" {
+			return ErrInvalidApproval
+		}
+		if err := approvals.Verify(g.approver, t, approval); err != nil {
+			return ErrInvalidApproval
+		}
+		return nil
+	}
+	if g.approver != "" && g.approvalThreshold > 0 && t.Amount > g.approvalThreshold {
+		return ErrApprovalRequired
+	}
+	err := g.limiter.Allow(t.ID, t.Destination, t.Amount, time.Now())
+	if err != nil && g.approver != "" {
+		return fmt.Errorf("%w: %s", ErrApprovalRequired, err)
+	}
+	return err
+}
+
+// holds checks if a transfer is held because it needs an operator approval or exceeds the transfer limits,
+// without counting it in the limits
+func (g *transferGuard) holds(t approvals.Transfer) bool {
+	if g.approver != "" && g.approvalThreshold > 0 && t.Amount > g.approvalThreshold {
+		return true
+	}
+	return g.limiter.Exceeds(t.ID, t.Destination, t.Amount, time.Now())
+}
+
+// checkPaused returns an error if the bridge is paused or the circuit breaker is tripped
+func (g *transferGuard) checkPaused() error {
+	if err := g.pauseSwitch.Check(); err != nil {
+		return err
+	}
+	return g.circuitBreaker.Check()
+}
@@ -0,0 +1,343 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+)
+
+const (
+	// LeaderProtocol is the protocol the candidates to act as the master send their heartbeats over
+	LeaderProtocol = protocol.ID("/p2p/rpc/leader/1")
+	// heartbeatInterval is how often a candidate sends a heartbeat to the other candidates
+	heartbeatInterval = 5 * time.Second
+	// leaseDuration is how long a heartbeat keeps a candidate alive
+	leaseDuration = 30 * time.Second
+	// minLeaderCandidates is the minimum number of candidates,
+	// with fewer a single candidate that is down stops the majority
+	minLeaderCandidates = 3
+)
+
+// HeartbeatRequest is sent by a candidate to the other candidates
+type HeartbeatRequest struct {
+	// Leader is true if the sender acts as the master
+	Leader bool
+	// Ready is true if the sender waited long enough after starting to take over
+	Ready bool
+	// StellarCursor and EthHeight are where the leader resumes from after a restart,
+	// the other candidates resume from there when they take over. They are only set by the leader.
+	StellarCursor string
+	EthHeight     uint64
+}
+
+// HeartbeatResponse tells the sender of a heartbeat if the receiver acts as the master
+type HeartbeatResponse struct {
+	Leader bool
+	Ready  bool
+}
+
+// candidate is another candidate to act as the master
+type candidate struct {
+	id      peer.ID
+	address string
+	// rank is the position in the candidates, the lowest rank has the highest priority
+	rank     int
+	lastSeen time.Time
+	leader   bool
+	// ready is set if the candidate can take over, a master only hands over to a candidate that is ready
+	ready bool
+}
+
+// Election decides which of the candidates acts as the master
+// A candidate leads if it has the highest priority of the candidates that sent a heartbeat within the lease
+// and no other candidate that is alive leads. A candidate only leads after it had the time to hear from the others
+// and as long as it reaches a majority of the candidates within half of the lease, so a master that is cut off
+// steps down before the others take over.
+type Election struct {
+	host   host.Host
+	router routing.PeerRouting
+	relay  *peer.AddrInfo
+	client *gorpc.Client
+	// rank of this candidate
+	rank        int
+	candidates  map[peer.ID]*candidate
+	persistency *state.ChainPersistency
+	lease       time.Duration
+	started     time.Time
+	now         func() time.Time
+
+	mut     sync.Mutex
+	leading bool
+	// stop ends the term of this candidate as the master
+	stop context.CancelFunc
+}
+
+// LeaderService receives the heartbeats of the other candidates
+type LeaderService struct {
+	election *Election
+}
+
+// newElection creates an election between the candidates, self is the Stellar address of this candidate
+func newElection(self string, candidates []string, persistency *state.ChainPersistency) (*Election, error) {
+	if len(candidates) < minLeaderCandidates {
+		return nil, fmt.Errorf("at least %d leader candidates are needed, %d given", minLeaderCandidates, len(candidates))
+	}
+	e := &Election{
+		rank:        -1,
+		candidates:  make(map[peer.ID]*candidate, len(candidates)),
+		persistency: persistency,
+		lease:       leaseDuration,
+		now:         time.Now,
+	}
+	for rank, address := range candidates {
+		if address == self {
+			e.rank = rank
+			continue
+		}
+		id, err := p2p.GetPeerIDFromStellarAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		e.candidates[id] = &candidate{id: id, address: address, rank: rank}
+	}
+	if e.rank < 0 {
+		return nil, fmt.Errorf("%s is not one of the leader candidates", self)
+	}
+	return e, nil
+}
+
+// NewElection creates an election between the candidates, in order of priority, and starts receiving their heartbeats
+// The election is started with Run.
+func NewElection(host host.Host, router routing.PeerRouting, relay *peer.AddrInfo, self string, candidates []string, persistency *state.ChainPersistency) (*Election, error) {
+	e, err := newElection(self, candidates, persistency)
+	if err != nil {
+		return nil, err
+	}
+	e.host = host
+	e.router = router
+	e.relay = relay
+	e.client = gorpc.NewClient(host, LeaderProtocol)
+
+	server := gorpc.NewServer(host, LeaderProtocol, gorpc.WithAuthorizeFunc(e.authorize))
+	if err = server.Register(&LeaderService{election: e}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// authorize only lets the other candidates send heartbeats
+func (e *Election) authorize(pid peer.ID, service string, method string) bool {
+	_, ok := e.candidates[pid]
+	return ok
+}
+
+// Leading returns true if this candidate acts as the master
+func (e *Election) Leading() bool {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	return e.leading
+}
+
+// Run sends heartbeats to the other candidates until the context is canceled
+// lead is called when this candidate takes over as the master, it starts the duties of the master
+// which have to stop when the context passed to it is canceled.
+func (e *Election) Run(ctx context.Context, lead func(ctx context.Context) error) {
+	e.mut.Lock()
+	e.started = e.now()
+	e.mut.Unlock()
+	log.Info("Leader election started", "rank", e.rank, "candidates", len(e.candidates)+1, "lease", e.lease)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.stepDown()
+			return
+		case <-ticker.C:
+		}
+		e.sendHeartbeats(ctx)
+
+		e.mut.Lock()
+		shouldLead, leading := e.shouldLead(e.now()), e.leading
+		e.mut.Unlock()
+		switch {
+		case shouldLead && !leading:
+			e.takeOver(ctx, lead)
+		case !shouldLead && leading:
+			e.stepDown()
+		}
+	}
+}
+
+// ready returns if this candidate waited long enough after starting to take over, the caller holds the lock
+func (e *Election) ready(now time.Time) bool {
+	return !e.started.IsZero() && now.Sub(e.started) >= e.lease
+}
+
+// shouldLead decides if this candidate leads, the caller holds the lock
+// A candidate that leads keeps leading if a candidate with a lower priority leads as well, the other one steps down.
+// A master only hands over to a candidate with a higher priority once that one is ready to take over.
+func (e *Election) shouldLead(now time.Time) bool {
+	if !e.ready(now) {
+		return false
+	}
+	// this candidate and the candidates it heard from within half of the lease
+	reachable := 1
+	for _, c := range e.candidates {
+		age := now.Sub(c.lastSeen)
+		if age > e.lease {
+			continue
+		}
+		if age <= e.lease/2 {
+			reachable++
+		}
+		if c.rank < e.rank && (c.ready || !e.leading) {
+			return false
+		}
+		if c.leader && !e.leading {
+			return false
+		}
+	}
+	// without a majority this candidate might be cut off from a master elected by the others
+	if reachable <= (len(e.candidates)+1)/2 {
+		if e.leading {
+			log.Warn("Lost the majority of the leader candidates", "reachable", reachable, "candidates", len(e.candidates)+1)
+		}
+		return false
+	}
+	return true
+}
+
+// takeOver starts the term of this candidate as the master
+// lead runs in its own goroutine since it can take a while, the heartbeats continue meanwhile.
+func (e *Election) takeOver(ctx context.Context, lead func(ctx context.Context) error) {
+	log.Warn("Taking over as the master", "rank", e.rank)
+	term, stop := context.WithCancel(ctx)
+	e.mut.Lock()
+	e.leading = true
+	e.stop = stop
+	e.mut.Unlock()
+	go func() {
+		if err := lead(term); err != nil {
+			log.Error("Failed to take over as the master", "err", err)
+			e.mut.Lock()
+			defer e.mut.Unlock()
+			// the term might have ended already and a new one started
+			if term.Err() == nil {
+				e.endTerm()
+			}
+		}
+	}()
+}
+
+func (e *Election) stepDown() {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.endTerm()
+}
+
+// endTerm ends the term of this candidate as the master, the caller holds the lock
+func (e *Election) endTerm() {
+	if !e.leading {
+		return
+	}
+	log.Warn("Stepping down as the master", "rank", e.rank)
+	e.leading = false
+	e.stop()
+	e.stop = nil
+}
+
+// heartbeat returns the heartbeat this candidate sends
+func (e *Election) heartbeat() HeartbeatRequest {
+	e.mut.Lock()
+	request := HeartbeatRequest{Leader: e.leading, Ready: e.ready(e.now())}
+	e.mut.Unlock()
+	if !request.Leader {
+		return request
+	}
+	height, err := e.persistency.GetHeight()
+	if err != nil {
+		log.Error("Failed to read where to resume from", "err", err)
+		return request
+	}
+	request.StellarCursor = height.StellarCursor
+	request.EthHeight = height.LastHeight
+	return request
+}
+
+// sendHeartbeats sends a heartbeat to every other candidate and waits for the answers
+func (e *Election) sendHeartbeats(ctx context.Context) {
+	request := e.heartbeat()
+	ctx, cancel := context.WithTimeout(ctx, heartbeatInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for id := range e.candidates {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			var response HeartbeatResponse
+			if err := e.sendHeartbeat(ctx, id, request, &response); err != nil {
+				log.Debug("Failed to send a heartbeat", "peerID", id, "err", err)
+				return
+			}
+			e.mut.Lock()
+			defer e.mut.Unlock()
+			c := e.candidates[id]
+			c.lastSeen = e.now()
+			c.leader = response.Leader
+			c.ready = response.Ready
+		}(id)
+	}
+	wg.Wait()
+}
+
+func (e *Election) sendHeartbeat(ctx context.Context, id peer.ID, request HeartbeatRequest, response *HeartbeatResponse) error {
+	if err := connectToPeer(ctx, e.host, e.router, e.relay, id); err != nil {
+		return err
+	}
+	return e.client.CallContext(ctx, id, "LeaderService", "Heartbeat", &request, response)
+}
+
+// received handles the heartbeat of another candidate and returns the response of this candidate
+// A candidate that does not lead saves where the leader resumes from to take over from there.
+func (e *Election) received(sender peer.ID, request HeartbeatRequest) HeartbeatResponse {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	response := HeartbeatResponse{Leader: e.leading, Ready: e.ready(e.now())}
+	c, ok := e.candidates[sender]
+	if !ok {
+		return response
+	}
+	c.lastSeen = e.now()
+	c.leader = request.Leader
+	c.ready = request.Ready
+	if request.Leader && !e.leading {
+		err := e.persistency.Save(&state.Blockheight{LastHeight: request.EthHeight, StellarCursor: request.StellarCursor})
+		if err != nil {
+			log.Error("Failed to save where the master resumes from", "err", err)
+		}
+	}
+	return response
+}
+
+// Heartbeat receives the heartbeat of another candidate
+func (s *LeaderService) Heartbeat(ctx context.Context, request HeartbeatRequest, response *HeartbeatResponse) error {
+	sender, err := gorpc.GetRequestSender(ctx)
+	if err != nil {
+		return err
+	}
+	*response = s.election.received(sender, request)
+	return nil
+}
@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+)
+
+func TestElection(t *testing.T) {
+	first, second, third := keypair.MustRandom().Address(), keypair.MustRandom().Address(), keypair.MustRandom().Address()
+	persistency := state.NewChainPersistency(filepath.Join(t.TempDir(), "node.json"))
+	e, err := newElection(second, []string{first, second, third}, persistency)
+	assert.NoError(t, err)
+	firstID, err := p2p.GetPeerIDFromStellarAddress(first)
+	assert.NoError(t, err)
+	thirdID, err := p2p.GetPeerIDFromStellarAddress(third)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	e.now = func() time.Time { return now }
+	e.started = now
+
+	// Waits to hear from the others after starting
+	assert.False(t, e.shouldLead(now))
+
+	// A candidate with a higher priority is alive
+	e.received(firstID, HeartbeatRequest{Leader: true, StellarCursor: "12", EthHeight: 34})
+	now = now.Add(leaseDuration + time.Second)
+	assert.False(t, e.shouldLead(now.Add(-time.Second)))
+	height, err := persistency.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Blockheight{LastHeight: 34, StellarCursor: "12"}, *height)
+
+	// Its lease expired, but no majority of the candidates is reachable
+	assert.False(t, e.shouldLead(now))
+	e.received(thirdID, HeartbeatRequest{})
+	assert.True(t, e.shouldLead(now))
+
+	// Waits until a candidate with a lower priority steps down
+	e.received(thirdID, HeartbeatRequest{Leader: true, StellarCursor: "56", EthHeight: 78})
+	assert.False(t, e.shouldLead(now))
+	e.received(thirdID, HeartbeatRequest{})
+	assert.True(t, e.shouldLead(now))
+
+	// A leader does not save the state of other leaders and keeps leading over a lower priority
+	e.leading = true
+	assert.True(t, e.received(thirdID, HeartbeatRequest{Leader: true, EthHeight: 50}).Leader)
+	assert.True(t, e.shouldLead(now))
+	height, err = persistency.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(78), height.LastHeight)
+
+	// Steps down when it is cut off, before the others consider its lease expired
+	now = now.Add(leaseDuration/2 + time.Second)
+	assert.False(t, e.shouldLead(now))
+	e.received(thirdID, HeartbeatRequest{})
+	assert.True(t, e.shouldLead(now))
+
+	// Steps down when a candidate with a higher priority is back and ready to take over
+	e.received(firstID, HeartbeatRequest{})
+	assert.True(t, e.shouldLead(now))
+	e.received(firstID, HeartbeatRequest{Ready: true})
+	assert.False(t, e.shouldLead(now))
+
+	_, err = newElection(keypair.MustRandom().Address(), []string{first, second, third}, persistency)
+	assert.Error(t, err)
+	_, err = newElection(first, []string{first, second}, persistency)
+	assert.Error(t, err)
+}
+
+func TestResumeHeight(t *testing.T) {
+	assert.Equal(t, uint64(100), resumeHeight(100, nil))
+	txMap := map[string]WithdrawEvent{"a": {blockHeight: 98}, "b": {blockHeight: 95}}
+	assert.Equal(t, uint64(95), resumeHeight(100, txMap))
+}
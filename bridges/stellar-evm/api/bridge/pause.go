@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+)
+
+// PauseSwitch pauses minting, withdrawals and refunds at runtime while the pause file exists.
+// The content of the pause file is logged as the reason for the pause.
+type PauseSwitch struct {
+	// file is the pause file, empty disables the pause switch
+	file string
+	// history stores the pause periods so they are known after a restart, nil if they are not stored
+	history *state.PauseHistory
+
+	paused bool
+	// pausedSince is the modification time of the pause file if the bridge is paused
+	pausedSince time.Time
+	// periods the bridge was paused, not including the current pause
+	periods []state.PausePeriod
+	mut     sync.Mutex
+}
+
+// NewPauseSwitch creates a new PauseSwitch
+// The pause periods are stored in historyFile, if it is empty only the pauses since the bridge started are known.
+func NewPauseSwitch(file string, historyFile string) (*PauseSwitch, error) {
+	p := &PauseSwitch{
+		file: file,
+	}
+	if file == "" || historyFile == "" {
+		return p, nil
+	}
+	p.history = state.NewPauseHistory(historyFile)
+	periods, err := p.history.List()
+	if err != nil {
+		return nil, err
+	}
+	// The bridge was stopped while it was paused
+	if n := len(periods); n > 0 && periods[n-1].End.IsZero() {
+		if _, err := os.Stat(file); err == nil {
+			p.paused = true
+			p.pausedSince = periods[n-1].Start
+			periods = periods[:n-1]
+		} else {
+			// It was resumed while the bridge was stopped, the deposits until now are treated as made while paused
+			periods[n-1].End = time.Now()
+		}
+	}
+	p.periods = periods
+	return p, nil
+}
+
+// Check returns faults.ErrBridgePaused if the bridge is paused
+func (p *PauseSwitch) Check() error {
+	if p == nil || p.file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(p.file)
+	paused := err == nil || !os.IsNotExist(err)
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if paused != p.paused {
+		now := time.Now()
+		if paused {
+			log.Warn("Bridge paused", "file", p.file, "reason", strings.TrimSpace(string(content)))
+			p.pausedSince = now
+			if info, err := os.Stat(p.file); err == nil && info.ModTime().Before(now) {
+				p.pausedSince = info.ModTime()
+			}
+		} else {
+			log.Info("Bridge resumed", "file", p.file)
+			p.periods = append(p.periods, state.PausePeriod{Start: p.pausedSince, End: now})
+		}
+		p.paused = paused
+		p.persist()
+	}
+	if paused {
+		return faults.ErrBridgePaused
+	}
+	return nil
+}
+
+// Pause pauses the bridge by creating the pause file with the reason as its content
+// An existing pause file is left as is.
+func (p *PauseSwitch) Pause(reason string) error {
+	if p == nil || p.file == "" {
+		return errors.New("no pause file configured")
+	}
+	f, err := os.OpenFile(p.file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if _, err = f.WriteString(reason + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// persist stores the pause periods including the current pause, the lock needs to be held
+func (p *PauseSwitch) persist() {
+	if p.history == nil {
+		return
+	}
+	periods := p.periods
+	if p.paused {
+		periods = append(periods[:len(periods):len(periods)], state.PausePeriod{Start: p.pausedSince})
+	}
+	if err := p.history.Save(periods); err != nil {
+		log.Error("Failed to store the pause periods", "err", err)
+	}
+}
+
+// PausedAt returns true if the bridge was paused at time t
+// Pauses that started and ended while the bridge was stopped are not known.
+func (p *PauseSwitch) PausedAt(t time.Time) bool {
+	if p == nil || p.file == "" {
+		return false
+	}
+	// refresh the current state
+	paused := p.Check() != nil
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if paused && !t.Before(p.pausedSince) {
+		return true
+	}
+	for _, period := range p.periods {
+		if !t.Before(period.Start) && !t.After(period.End) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+)
+
+func TestPauseSwitch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pause")
+	history := filepath.Join(dir, "pausehistory.json")
+	p, err := NewPauseSwitch(file, history)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Check())
+	before := time.Now().Add(-time.Minute)
+
+	assert.NoError(t, os.WriteFile(file, []byte("incident"), 0644))
+	assert.Equal(t, faults.ErrBridgePaused, p.Check())
+	paused := time.Now()
+	assert.True(t, p.PausedAt(paused))
+
+	assert.NoError(t, os.Remove(file))
+	assert.NoError(t, p.Check())
+	assert.True(t, p.PausedAt(paused))
+	assert.False(t, p.PausedAt(before))
+	assert.False(t, p.PausedAt(time.Now().Add(time.Minute)))
+
+	// The pauses are known after a restart
+	p, err = NewPauseSwitch(file, history)
+	assert.NoError(t, err)
+	assert.True(t, p.PausedAt(paused))
+	assert.False(t, p.PausedAt(before))
+
+	// A restart during a pause keeps the start of the pause
+	assert.NoError(t, os.WriteFile(file, []byte("incident"), 0644))
+	assert.Equal(t, faults.ErrBridgePaused, p.Check())
+	paused = time.Now()
+	p, err = NewPauseSwitch(file, history)
+	assert.NoError(t, err)
+	assert.True(t, p.PausedAt(paused))
+
+	// A pause that ended while the bridge was stopped covers the time until the restart
+	assert.NoError(t, os.Remove(file))
+	p, err = NewPauseSwitch(file, history)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Check())
+	assert.True(t, p.PausedAt(paused))
+	assert.False(t, p.PausedAt(time.Now().Add(time.Minute)))
+
+	// An empty file disables the pause switch
+	p, err = NewPauseSwitch("", "")
+	assert.NoError(t, err)
+	assert.NoError(t, p.Check())
+}
+
+func TestCircuitBreakerPauses(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pause")
+	p, err := NewPauseSwitch(file, "")
+	assert.NoError(t, err)
+	c := NewCircuitBreaker(nil, nil, p, 1)
+
+	c.Trip("supply diverged")
+	assert.NoError(t, c.Check())
+	assert.Equal(t, faults.ErrBridgePaused, p.Check())
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "circuit breaker: supply diverged\n", string(content))
+
+	// the operator resumes the bridge like after a manual pause
+	assert.NoError(t, os.Remove(file))
+	assert.NoError(t, p.Check())
+
+	// without a pause file it stays tripped
+	p, err = NewPauseSwitch("", "")
+	assert.NoError(t, err)
+	c = NewCircuitBreaker(nil, nil, p, 1)
+	c.Trip("supply diverged")
+	assert.Equal(t, ErrCircuitBreakerTripped, c.Check())
+}
@@ -0,0 +1,221 @@
+package bridge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+const (
+	// peerHealthInterval is how often the cosigners are pinged
+	peerHealthInterval = 30 * time.Second
+	// peerHealthReportInterval is how often the health of the cosigners is logged
+	peerHealthReportInterval = 10 * time.Minute
+	// pingTimeout is how long a cosigner gets to answer a ping
+	pingTimeout = 10 * time.Second
+	// cosignerTag protects the connections to the cosigners from being pruned by the connection manager
+	cosignerTag = "bridge-cosigner"
+)
+
+// PeerHealth is what the master knows about the health of a cosigner
+type PeerHealth struct {
+	// Latency is the moving average of the round trip times of pings and signing requests
+	Latency time.Duration
+	// Failures is the number of consecutive failed pings and signing requests
+	Failures int
+	// Errors is the total number of failed pings and signing requests
+	Errors uint64
+	// LastError is the error of the last failure
+	LastError string
+	// LastSeen is when the cosigner last answered
+	LastSeen time.Time
+	// LastSignature is when the cosigner last signed
+	LastSignature time.Time
+}
+
+// healthy returns true if the last ping or signing request of the cosigner succeeded
+func (h PeerHealth) healthy() bool {
+	return h.Failures == 0 && !h.LastSeen.IsZero()
+}
+
+// peerManager keeps connections to the cosigners and tracks their health
+type peerManager struct {
+	host   host.Host
+	router routing.PeerRouting
+	relay  *peer.AddrInfo
+
+	mut   sync.Mutex
+	peers map[peer.ID]*PeerHealth
+	now   func() time.Time
+}
+
+func newPeerManager(host host.Host, router routing.PeerRouting, relay *peer.AddrInfo) *peerManager {
+	return &peerManager{
+		host:   host,
+		router: router,
+		relay:  relay,
+		peers:  make(map[peer.ID]*PeerHealth),
+		now:    time.Now,
+	}
+}
+
+// setPeers replaces the cosigners that are tracked, the health of the cosigners that remain is kept
+func (m *peerManager) setPeers(ids []peer.ID) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	peers := make(map[peer.ID]*PeerHealth, len(ids))
+	for _, id := range ids {
+		if health, ok := m.peers[id]; ok {
+			peers[id] = health
+			continue
+		}
+		peers[id] = &PeerHealth{}
+	}
+	for id := range m.peers {
+		if _, ok := peers[id]; !ok && m.host != nil {
+			m.host.ConnManager().Unprotect(id, cosignerTag)
+		}
+	}
+	m.peers = peers
+}
+
+// connect connects to a cosigner unless it is connected already
+func (m *peerManager) connect(ctx context.Context, id peer.ID) error {
+	if err := connectToPeer(ctx, m.host, m.router, m.relay, id); err != nil {
+		return err
+	}
+	m.host.ConnManager().Protect(id, cosignerTag)
+	return nil
+}
+
+// succeeded records a successful ping or signing request that took latency
+func (m *peerManager) succeeded(id peer.ID, latency time.Duration, signed bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	health, ok := m.peers[id]
+	if !ok {
+		return
+	}
+	if health.Failures > 0 {
+		log.Info("Cosigner is back", "peerID", id, "failures", health.Failures)
+	}
+	if health.Latency == 0 {
+		health.Latency = latency
+	} else {
+		health.Latency = (4*health.Latency + latency) / 5
+	}
+	health.Failures = 0
+	health.LastSeen = m.now()
+	if signed {
+		health.LastSignature = health.LastSeen
+	}
+}
+
+// failed records a failed ping or signing request
+func (m *peerManager) failed(id peer.ID, err error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	health, ok := m.peers[id]
+	if !ok {
+		return
+	}
+	if health.Failures == 0 {
+		log.Warn("Cosigner is unhealthy", "peerID", id, "err", err)
+	}
+	health.Failures++
+	health.Errors++
+	health.LastError = err.Error()
+}
+
+// Health returns the health of the cosigners
+func (m *peerManager) Health() map[peer.ID]PeerHealth {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	health := make(map[peer.ID]PeerHealth, len(m.peers))
+	for id, h := range m.peers {
+		health[id] = *h
+	}
+	return health
+}
+
+// order sorts the cosigners by health: the ones that answered their last request first, fastest first,
+// then the ones that were not reached yet and the ones that failed last, with the fewest failures first
+func (m *peerManager) order(cosigners []cosigner) []cosigner {
+	health := m.Health()
+	rank := func(h PeerHealth) int {
+		switch {
+		case h.healthy():
+			return 0
+		case h.LastSeen.IsZero() && h.Failures == 0:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(cosigners, func(i, j int) bool {
+		hi, hj := health[cosigners[i].id], health[cosigners[j].id]
+		if rank(hi) != rank(hj) {
+			return rank(hi) < rank(hj)
+		}
+		if hi.Failures != hj.Failures {
+			return hi.Failures < hj.Failures
+		}
+		return hi.Latency < hj.Latency
+	})
+	return cosigners
+}
+
+// Run pings the cosigners periodically and logs their health until the context is canceled
+func (m *peerManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(peerHealthInterval)
+	defer ticker.Stop()
+	lastReport := time.Time{}
+	for {
+		m.pingAll(ctx)
+		if time.Since(lastReport) >= peerHealthReportInterval {
+			m.report()
+			lastReport = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *peerManager) pingAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for id := range m.Health() {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+			defer cancel()
+			if err := m.connect(ctx, id); err != nil {
+				m.failed(id, err)
+				return
+			}
+			result := <-ping.Ping(ctx, m.host, id)
+			if result.Error != nil {
+				m.failed(id, result.Error)
+				return
+			}
+			m.succeeded(id, result.RTT, false)
+		}(id)
+	}
+	wg.Wait()
+}
+
+// report logs the health of every cosigner
+func (m *peerManager) report() {
+	for id, health := range m.Health() {
+		log.Info("Cosigner health", "peerID", id, "healthy", health.healthy(), "latency", health.Latency, "failures", health.Failures, "errors", health.Errors, "lastSeen", health.LastSeen, "lastSignature", health.LastSignature, "lastError", health.LastError)
+	}
+}
@@ -0,0 +1,45 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerHealth(t *testing.T) {
+	m := newPeerManager(nil, nil, nil)
+	m.setPeers([]peer.ID{"fast", "slow", "failing", "new"})
+
+	m.succeeded("fast", 10*time.Millisecond, true)
+	m.succeeded("slow", 100*time.Millisecond, false)
+	m.succeeded("failing", time.Millisecond, true)
+	m.failed("failing", errors.New("timeout"))
+	// unknown peers are not tracked
+	m.succeeded("other", time.Millisecond, true)
+
+	health := m.Health()
+	assert.Len(t, health, 4)
+	assert.False(t, health["fast"].LastSignature.IsZero())
+	assert.True(t, health["slow"].LastSignature.IsZero())
+	assert.Equal(t, 1, health["failing"].Failures)
+	assert.Equal(t, "timeout", health["failing"].LastError)
+
+	cosigners := []cosigner{{id: "failing"}, {id: "new"}, {id: "slow"}, {id: "fast"}}
+	ordered := m.order(cosigners)
+	assert.Equal(t, []peer.ID{"fast", "slow", "new", "failing"}, []peer.ID{ordered[0].id, ordered[1].id, ordered[2].id, ordered[3].id})
+
+	// A cosigner that answers again is healthy, the total number of errors is kept
+	m.succeeded("failing", time.Millisecond, true)
+	health = m.Health()
+	assert.Equal(t, 0, health["failing"].Failures)
+	assert.Equal(t, uint64(1), health["failing"].Errors)
+
+	// The health of the cosigners that remain is kept
+	m.setPeers([]peer.ID{"fast"})
+	health = m.Health()
+	assert.Len(t, health, 1)
+	assert.Equal(t, 10*time.Millisecond, health["fast"].Latency)
+}
@@ -0,0 +1,108 @@
+package bridge
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+var ErrTransferLimitExceeded = fmt.Errorf("%w: transfer limit exceeded", ErrTransferRefused)
+
+// TransferLimits are the maximum amounts in TFT units that can be transferred by the bridge in a direction
+// A limit of 0 means there is no limit
+type TransferLimits struct {
+	Hourly           int64
+	Daily            int64
+	HourlyPerAddress int64
+	DailyPerAddress  int64
+}
+
+type limitedTransfer struct {
+	id          string
+	destination string
+	amount      int64
+	time        time.Time
+}
+
+// transferLimiter keeps track of the transfers of the last day to enforce TransferLimits
+type transferLimiter struct {
+	limits    TransferLimits
+	transfers []limitedTransfer
+	mut       sync.Mutex
+}
+
+func newTransferLimiter(limits TransferLimits) *transferLimiter {
+	return &transferLimiter{
+		limits: limits,
+	}
+}
+
+// Allow checks if a transfer of amount stroops to destination fits in the limits and remembers it if it does.
+// A transfer with an id that is already remembered is always allowed so retries are not counted twice.
+func (l *transferLimiter) Allow(id string, destination string, amount int64, now time.Time) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	known, err := l.check(id, destination, amount, now)
+	if err != nil || known {
+		return err
+	}
+	l.transfers = append(l.transfers, limitedTransfer{id: id, destination: destination, amount: amount, time: now})
+	return nil
+}
+
+// Exceeds checks if a transfer does not fit in the limits like Allow, without remembering it
+func (l *transferLimiter) Exceeds(id string, destination string, amount int64, now time.Time) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	_, err := l.check(id, destination, amount, now)
+	return err != nil
+}
+
+// check returns if the transfer is remembered already or else if it fits in the limits
+func (l *transferLimiter) check(id string, destination string, amount int64, now time.Time) (known bool, err error) {
+	// forget transfers older than a day
+	i := 0
+	for i < len(l.transfers) && now.Sub(l.transfers[i].time) >= 24*time.Hour {
+		i++
+	}
+	l.transfers = l.transfers[i:]
+
+	var hourly, daily, hourlyPerAddress, dailyPerAddress int64
+	for _, transfer := range l.transfers {
+		if transfer.id == id {
+			return true, nil
+		}
+		lastHour := now.Sub(transfer.time) < time.Hour
+		daily += transfer.amount
+		if lastHour {
+			hourly += transfer.amount
+		}
+		if transfer.destination == destination {
+			dailyPerAddress += transfer.amount
+			if lastHour {
+				hourlyPerAddress += transfer.amount
+			}
+		}
+	}
+
+	if err = checkLimit("hourly", hourly+amount, l.limits.Hourly); err != nil {
+		return
+	}
+	if err = checkLimit("daily", daily+amount, l.limits.Daily); err != nil {
+		return
+	}
+	if err = checkLimit("hourly per address", hourlyPerAddress+amount, l.limits.HourlyPerAddress); err != nil {
+		return
+	}
+	err = checkLimit("daily per address", dailyPerAddress+amount, l.limits.DailyPerAddress)
+	return
+}
+
+func checkLimit(name string, total int64, limit int64) error {
+	if limit > 0 && total > stellar.IntToStroops(limit) {
+		return fmt.Errorf("%w: %s limit of %d TFT", ErrTransferLimitExceeded, name, limit)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+func TestTransferLimiter(t *testing.T) {
+	l := newTransferLimiter(TransferLimits{Hourly: 100, Daily: 150, HourlyPerAddress: 60})
+	now := time.Now()
+
+	assert.NoError(t, l.Allow("tx1", "a", stellar.IntToStroops(60), now))
+	// A retry of the same transfer is not counted twice
+	assert.NoError(t, l.Allow("tx1", "a", stellar.IntToStroops(60), now))
+	assert.True(t, l.Exceeds("tx2", "a", stellar.IntToStroops(1), now))
+	err := l.Allow("tx2", "a", stellar.IntToStroops(1), now)
+	assert.True(t, errors.Is(err, ErrTransferLimitExceeded))
+	assert.NoError(t, l.Allow("tx3", "b", stellar.IntToStroops(40), now))
+	err = l.Allow("tx4", "c", stellar.IntToStroops(1), now)
+	assert.True(t, errors.Is(err, ErrTransferLimitExceeded))
+
+	// The hourly limits are reset after an hour but the daily limit is not
+	later := now.Add(time.Hour)
+	assert.NoError(t, l.Allow("tx5", "a", stellar.IntToStroops(50), later))
+	err = l.Allow("tx6", "c", stellar.IntToStroops(1), later)
+	assert.True(t, errors.Is(err, ErrTransferLimitExceeded))
+
+	// Everything is forgotten after a day
+	assert.NoError(t, l.Allow("tx7", "a", stellar.IntToStroops(60), now.Add(25*time.Hour)))
+}
+
+func TestTransferLimiterNoLimits(t *testing.T) {
+	l := newTransferLimiter(TransferLimits{})
+	assert.NoError(t, l.Allow("tx1", "a", stellar.IntToStroops(1e9), time.Now()))
+}
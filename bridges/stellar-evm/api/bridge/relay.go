@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+// relayACL only relays for the bridges with the given Stellar addresses
+type relayACL struct {
+	allowed map[peer.ID]bool
+}
+
+func newRelayACL(signers []string) (*relayACL, error) {
+	ids, err := p2p.GetPeerIDsFromStellarAddresses(signers)
+	if err != nil {
+		return nil, err
+	}
+	acl := &relayACL{allowed: make(map[peer.ID]bool, len(ids))}
+	for _, id := range ids {
+		acl.allowed[id] = true
+	}
+	return acl, nil
+}
+
+// AllowReserve only lets the bridges reserve a slot to be reached through the relay
+func (a *relayACL) AllowReserve(p peer.ID, addr ma.Multiaddr) bool {
+	if !a.allowed[p] {
+		log.Warn("Refused a relay reservation", "peerID", p, "address", addr)
+		return false
+	}
+	return true
+}
+
+// AllowConnect only relays connections between bridges
+func (a *relayACL) AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool {
+	if !a.allowed[src] || !a.allowed[dest] {
+		log.Warn("Refused to relay a connection", "from", src, "address", srcAddr, "to", dest)
+		return false
+	}
+	return true
+}
+
+// Relay is a relay node of the private network of the bridges
+// The bridges find each other through its DHT and connect through it if they can not connect directly.
+type Relay struct {
+	Host   host.Host
+	Router routing.PeerRouting
+	relay  *relay.Relay
+}
+
+// NewRelay starts a relay on the listen multiaddrs for the private network with the hex encoded psk
+// Only the bridges with the signers Stellar addresses can reserve a slot and connect through it.
+// If secret is empty, the relay gets a random peer ID.
+func NewRelay(ctx context.Context, secret string, listen []string, psk string, signers []string) (*Relay, error) {
+	key, err := decodePSK(psk)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := newRelayACL(signers)
+	if err != nil {
+		return nil, err
+	}
+	cmgr, err := connmgr.NewConnManager(100, 400)
+	if err != nil {
+		return nil, err
+	}
+
+	var idht *dht.IpfsDHT
+	options := []libp2p.Option{
+		libp2p.ListenAddrStrings(listen...),
+		libp2p.PrivateNetwork(key),
+		// quic does not support private networks
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.ConnectionManager(cmgr),
+		// The bridges find each other through the DHT of the relay
+		libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
+			idht, err = dht.New(ctx, h, dht.Mode(dht.ModeServer))
+			return idht, err
+		}),
+	}
+	if secret != "" {
+		var privKey crypto.PrivKey
+		if privKey, err = privateKeyFromSecret(secret); err != nil {
+			return nil, err
+		}
+		options = append(options, libp2p.Identity(privKey))
+	}
+	h, err := libp2p.New(options...)
+	if err != nil {
+		return nil, err
+	}
+	r, err := relay.New(h, relay.WithACL(acl))
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	return &Relay{Host: h, Router: idht, relay: r}, nil
+}
+
+// Close stops the relay
+func (r *Relay) Close() error {
+	if err := r.relay.Close(); err != nil {
+		return err
+	}
+	return r.Host.Close()
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+func TestRelayACL(t *testing.T) {
+	signer, other := keypair.MustRandom().Address(), keypair.MustRandom().Address()
+	acl, err := newRelayACL([]string{signer})
+	assert.NoError(t, err)
+	signerID, err := p2p.GetPeerIDFromStellarAddress(signer)
+	assert.NoError(t, err)
+	otherID, err := p2p.GetPeerIDFromStellarAddress(other)
+	assert.NoError(t, err)
+
+	assert.True(t, acl.AllowReserve(signerID, nil))
+	assert.False(t, acl.AllowReserve(otherID, nil))
+	assert.True(t, acl.AllowConnect(signerID, nil, signerID))
+	assert.False(t, acl.AllowConnect(otherID, nil, signerID))
+	assert.False(t, acl.AllowConnect(signerID, nil, otherID))
+}
+
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	master, cosigner := keypair.MustRandom(), keypair.MustRandom()
+	relay, err := NewRelay(ctx, "", []string{"/ip4/127.0.0.1/tcp/0"}, testPSK, []string{master.Address(), cosigner.Address()})
+	assert.NoError(t, err)
+	defer relay.Close()
+	relayAddress := fmt.Sprintf("%s/p2p/%s", relay.Host.Addrs()[0], relay.Host.ID())
+	relayInfo, err := peer.AddrInfoFromString(relayAddress)
+	assert.NoError(t, err)
+
+	masterHost, router, err := NewHost(ctx, master.Seed(), relayAddress, testPSK)
+	assert.NoError(t, err)
+	defer masterHost.Close()
+	cosignerHost, _, err := NewHost(ctx, cosigner.Seed(), relayAddress, testPSK)
+	assert.NoError(t, err)
+	defer cosignerHost.Close()
+
+	// The master finds the cosigner through the relay
+	assert.Eventually(t, func() bool {
+		return connectToPeer(ctx, masterHost, router, relayInfo, cosignerHost.ID()) == nil
+	}, 20*time.Second, 500*time.Millisecond)
+}
@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/txnbuild"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+// signRequestValidator checks that a transaction is what a signing request of its kind asks to sign
+type signRequestValidator func(request multisig.StellarSignRequest, txn *txnbuild.Transaction) error
+
+// validator returns the validator for a kind of signing request
+func (s *SignerService) validator(kind multisig.RequestKind) (signRequestValidator, error) {
+	switch kind {
+	case multisig.KindWithdrawal:
+		return s.validateWithdrawal, nil
+	case multisig.KindRefund:
+		return s.validateRefundTransaction, nil
+	case multisig.KindDepositFeeTransfer:
+		return s.validateDepositFeeTransfer, nil
+	case multisig.KindClaim:
+		return func(_ multisig.StellarSignRequest, txn *txnbuild.Transaction) error {
+			return s.validateClaimTransaction(txn)
+		}, nil
+	case multisig.KindSignerRotation:
+		return s.validateSignerRotation, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidTransaction, "unknown kind of signing request %q", kind)
+}
+
+// legacySignRequest sets the kind and references of a request of a master that does not set them
+// The kind is inferred from the fields that are set, like older masters expect.
+// A transaction that is not a single payment to the fee wallet is not taken for a deposit fee transfer.
+func legacySignRequest(request multisig.StellarSignRequest, txn *txnbuild.Transaction, feeWallet string) (multisig.StellarSignRequest, error) {
+	switch {
+	case request.SignerRotation != nil:
+		request.Kind = multisig.KindSignerRotation
+	case request.Block != 0:
+		request.Kind = multisig.KindWithdrawal
+	case request.Message != "":
+		request.Kind = multisig.KindRefund
+		request.DepositTxHash = request.Message
+	case isClaimTransaction(txn):
+		request.Kind = multisig.KindClaim
+	case isFeeWalletPayment(txn, feeWallet):
+		request.Kind = multisig.KindDepositFeeTransfer
+		// the memo references the deposit
+		request.DepositTxHash, _ = stellar.ExtractMemoFromTx(txn)
+	default:
+		return request, errors.Wrap(ErrInvalidTransaction, "the kind of the request is not set and can not be inferred")
+	}
+	log.Debug("Inferred the kind of a signing request", "kind", request.Kind)
+	return request, nil
+}
+
+// isFeeWalletPayment returns true if the transaction only pays to the fee wallet
+func isFeeWalletPayment(txn *txnbuild.Transaction, feeWallet string) bool {
+	operations := txn.Operations()
+	if len(operations) != 1 || feeWallet == "" {
+		return false
+	}
+	payment, ok := operations[0].(*txnbuild.Payment)
+	return ok && payment.Destination == feeWallet
+}
+
+// checkMemo checks that the memo of the transaction is the hex encoded reference
+func checkMemo(txn *txnbuild.Transaction, reference string) error {
+	if reference == "" {
+		return errors.Wrap(ErrInvalidTransaction, "the request does not reference a transaction")
+	}
+	memo, err := stellar.ExtractMemoFromTx(txn)
+	if err != nil {
+		log.Warn("Failed to extract memo", "err", err)
+		return errors.Wrap(ErrInvalidTransaction, "Unable to extract the memo from the supplied transaction")
+	}
+	if memo != reference {
+		return errors.Wrapf(ErrInvalidTransaction, "the memo %s does not match the referenced transaction %s", memo, reference)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+const testBalanceID = "00000000da0d57da7d4850e7fc10d2a9d0ebc731f7afb40574c03395b17d49149b91f5be"
+
+func newTestTransaction(t *testing.T, memo txnbuild.Memo, operations ...txnbuild.Operation) *txnbuild.Transaction {
+	source := txnbuild.NewSimpleAccount(keypair.MustRandom().Address(), 1)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &source,
+		IncrementSequenceNum: true,
+		Operations:           operations,
+		Memo:                 memo,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+	})
+	assert.NoError(t, err)
+	return tx
+}
+
+func newTestPayment() txnbuild.Operation {
+	return &txnbuild.Payment{Destination: keypair.MustRandom().Address(), Amount: "1", Asset: txnbuild.NativeAsset{}}
+}
+
+func TestLegacySignRequest(t *testing.T) {
+	deposit := [32]byte{1}
+	depositHex := hex.EncodeToString(deposit[:])
+	feeWallet := keypair.MustRandom().Address()
+	payment := newTestTransaction(t, txnbuild.MemoHash(deposit), newTestPayment())
+	feeTransfer := newTestTransaction(t, txnbuild.MemoHash(deposit), &txnbuild.Payment{Destination: feeWallet, Amount: "1", Asset: txnbuild.NativeAsset{}})
+	claim := newTestTransaction(t, nil, &txnbuild.ClaimClaimableBalance{BalanceID: testBalanceID})
+
+	request, err := legacySignRequest(multisig.StellarSignRequest{SignerRotation: &multisig.SignerRotation{}}, payment, feeWallet)
+	assert.NoError(t, err)
+	assert.Equal(t, multisig.KindSignerRotation, request.Kind)
+
+	request, err = legacySignRequest(multisig.StellarSignRequest{Block: 10}, payment, feeWallet)
+	assert.NoError(t, err)
+	assert.Equal(t, multisig.KindWithdrawal, request.Kind)
+
+	request, err = legacySignRequest(multisig.StellarSignRequest{Message: depositHex}, payment, feeWallet)
+	assert.NoError(t, err)
+	assert.Equal(t, multisig.KindRefund, request.Kind)
+	assert.Equal(t, depositHex, request.DepositTxHash)
+
+	request, err = legacySignRequest(multisig.StellarSignRequest{}, claim, feeWallet)
+	assert.NoError(t, err)
+	assert.Equal(t, multisig.KindClaim, request.Kind)
+
+	request, err = legacySignRequest(multisig.StellarSignRequest{}, feeTransfer, feeWallet)
+	assert.NoError(t, err)
+	assert.Equal(t, multisig.KindDepositFeeTransfer, request.Kind)
+	assert.Equal(t, depositHex, request.DepositTxHash)
+
+	// anything else is not taken for a deposit fee transfer
+	_, err = legacySignRequest(multisig.StellarSignRequest{}, payment, feeWallet)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestSignRequiresKind(t *testing.T) {
+	s := &SignerService{requireKind: true}
+	tx := newTestTransaction(t, txnbuild.MemoHash([32]byte{1}), newTestPayment())
+	xdr, err := tx.Base64()
+	assert.NoError(t, err)
+	err = s.Sign(context.Background(), multisig.StellarSignRequest{TxnXDR: xdr}, &multisig.StellarSignResponse{})
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestValidatorKinds(t *testing.T) {
+	s := &SignerService{}
+	for _, kind := range []multisig.RequestKind{multisig.KindWithdrawal, multisig.KindRefund, multisig.KindDepositFeeTransfer, multisig.KindClaim, multisig.KindSignerRotation} {
+		validate, err := s.validator(kind)
+		assert.NoError(t, err, kind)
+		assert.NotNil(t, validate, kind)
+	}
+	for _, kind := range []multisig.RequestKind{"", "batch", "transfer"} {
+		_, err := s.validator(kind)
+		assert.True(t, errors.Is(err, ErrInvalidTransaction), kind)
+	}
+}
+
+// The validators check the references of the requests before looking up what they reference
+func TestValidateWithdrawalReference(t *testing.T) {
+	s := &SignerService{}
+	ethTx := common.HexToHash("0x01")
+	tx := newTestTransaction(t, txnbuild.MemoHash(common.HexToHash("0x02")), newTestPayment(), newTestPayment())
+	err := s.validateWithdrawal(multisig.StellarSignRequest{Kind: multisig.KindWithdrawal, EthTxHash: ethTx, Block: 1}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestValidateRefundReference(t *testing.T) {
+	s := &SignerService{}
+	tx := newTestTransaction(t, txnbuild.MemoReturn([32]byte{1}), newTestPayment())
+	err := s.validateRefundTransaction(multisig.StellarSignRequest{Kind: multisig.KindRefund, DepositTxHash: hex.EncodeToString([]byte{2})}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+	err = s.validateRefundTransaction(multisig.StellarSignRequest{Kind: multisig.KindRefund}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestValidateDepositFeeTransferReference(t *testing.T) {
+	s := &SignerService{}
+	tx := newTestTransaction(t, txnbuild.MemoHash([32]byte{1}), newTestPayment())
+	err := s.validateDepositFeeTransfer(multisig.StellarSignRequest{Kind: multisig.KindDepositFeeTransfer, DepositTxHash: hex.EncodeToString([]byte{2})}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+	tx = newTestTransaction(t, nil, newTestPayment())
+	err = s.validateDepositFeeTransfer(multisig.StellarSignRequest{Kind: multisig.KindDepositFeeTransfer}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestValidateClaim(t *testing.T) {
+	s := &SignerService{}
+	tx := newTestTransaction(t, nil, newTestPayment())
+	assert.True(t, errors.Is(s.validateClaimTransaction(tx), ErrInvalidTransaction))
+	tx = newTestTransaction(t, nil, &txnbuild.ClaimClaimableBalance{BalanceID: testBalanceID}, &txnbuild.ClaimClaimableBalance{BalanceID: testBalanceID})
+	assert.True(t, errors.Is(s.validateClaimTransaction(tx), ErrInvalidTransaction))
+}
+
+func TestValidateSignerRotationWithoutRotation(t *testing.T) {
+	s := &SignerService{}
+	tx := newTestTransaction(t, nil, newTestPayment())
+	err := s.validateSignerRotation(multisig.StellarSignRequest{Kind: multisig.KindSignerRotation}, tx)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
+
+func TestCheckWithdrawalPayments(t *testing.T) {
+	destination, feeWallet := keypair.MustRandom().Address(), keypair.MustRandom().Address()
+	payment := &txnbuild.Payment{Destination: destination, Amount: "9", Asset: txnbuild.NativeAsset{}}
+	fee := &txnbuild.Payment{Destination: feeWallet, Amount: "1", Asset: txnbuild.NativeAsset{}}
+	withFee := newTestTransaction(t, nil, payment, fee)
+	withoutFee := newTestTransaction(t, nil, payment)
+
+	assert.NoError(t, checkWithdrawalPayments(withFee, destination, 90000000, 10000000, feeWallet))
+	assert.True(t, errors.Is(checkWithdrawalPayments(withoutFee, destination, 90000000, 10000000, feeWallet), ErrInvalidTransaction))
+
+	// A fee of 0 or no fee wallet is not paid
+	assert.NoError(t, checkWithdrawalPayments(withoutFee, destination, 90000000, 0, feeWallet))
+	assert.NoError(t, checkWithdrawalPayments(withoutFee, destination, 90000000, 10000000, ""))
+	assert.True(t, errors.Is(checkWithdrawalPayments(withFee, destination, 90000000, 0, feeWallet), ErrInvalidTransaction))
+}
+
+func TestFindWithdrawEvent(t *testing.T) {
+	receiver := common.HexToAddress("0x01")
+	ethTx := common.HexToHash("0x02")
+	first := WithdrawEvent{receiver: receiver, txHash: ethTx, logIndex: 3, network: BridgeNetwork}
+	second := WithdrawEvent{receiver: receiver, txHash: ethTx, logIndex: 5, network: BridgeNetwork}
+
+	request := multisig.StellarSignRequest{Kind: multisig.KindWithdrawal, Receiver: receiver, EthTxHash: ethTx, LogIndex: 5}
+	withdrawal, err := findWithdrawEvent([]WithdrawEvent{first, second}, request)
+	assert.NoError(t, err)
+	assert.Equal(t, second, withdrawal)
+
+	request.LogIndex = 4
+	_, err = findWithdrawEvent([]WithdrawEvent{first, second}, request)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+
+	request.LogIndex = 3
+	request.Receiver = common.HexToAddress("0x03")
+	_, err = findWithdrawEvent([]WithdrawEvent{first, second}, request)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+
+	other := first
+	other.network = "other"
+	request.Receiver = receiver
+	_, err = findWithdrawEvent([]WithdrawEvent{other}, request)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+
+	// Without a reference the transaction needs to contain exactly 1 withdraw event
+	legacy := multisig.StellarSignRequest{Block: 1, Receiver: receiver}
+	withdrawal, err = findWithdrawEvent([]WithdrawEvent{first}, legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, first, withdrawal)
+	_, err = findWithdrawEvent([]WithdrawEvent{first, second}, legacy)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+	_, err = findWithdrawEvent(nil, legacy)
+	assert.True(t, errors.Is(err, ErrInvalidTransaction))
+}
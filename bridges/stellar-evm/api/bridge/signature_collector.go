@@ -0,0 +1,202 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// DefaultSignTimeout is how long the cosigners get to reach the required weight
+	DefaultSignTimeout = 30 * time.Second
+	// DefaultCosignerTimeout is how long a single cosigner gets to answer
+	DefaultCosignerTimeout = 10 * time.Second
+
+	// cosignerRetryBackoff is how long to wait before asking a cosigner that failed again, it doubles for every failure
+	cosignerRetryBackoff = time.Second
+	// maxCosignerAttempts is how many times a cosigner is asked within one signing round
+	maxCosignerAttempts = 3
+	// partialSignaturesLifetime is how long the signatures of a request that did not reach the required weight are kept
+	partialSignaturesLifetime = time.Hour
+)
+
+// partialSignatures keeps the signatures collected for requests that did not reach the required weight
+// The next attempt for the same request only asks the cosigners that did not sign yet,
+// if it asks to sign the same version of the request.
+type partialSignatures[T any] struct {
+	mut     sync.Mutex
+	entries map[string]partialEntry[T]
+	now     func() time.Time
+}
+
+type partialEntry[T any] struct {
+	// version is what the signatures sign
+	version    string
+	signatures map[peer.ID]T
+	expires    time.Time
+}
+
+func newPartialSignatures[T any]() *partialSignatures[T] {
+	return &partialSignatures[T]{
+		entries: make(map[string]partialEntry[T]),
+		now:     time.Now,
+	}
+}
+
+// get returns a copy of the signatures collected for a version of a request
+func (p *partialSignatures[T]) get(key string, version string) map[peer.ID]T {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	now := p.now()
+	for k, entry := range p.entries {
+		if !now.Before(entry.expires) {
+			delete(p.entries, k)
+		}
+	}
+	signatures := make(map[peer.ID]T)
+	entry, ok := p.entries[key]
+	if !ok || entry.version != version {
+		return signatures
+	}
+	for id, signature := range entry.signatures {
+		signatures[id] = signature
+	}
+	return signatures
+}
+
+// keep stores the signatures collected for a version of a request, forget removes them
+func (p *partialSignatures[T]) keep(key string, version string, signatures map[peer.ID]T) {
+	if len(signatures) == 0 {
+		return
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.entries[key] = partialEntry[T]{version: version, signatures: signatures, expires: p.now().Add(partialSignaturesLifetime)}
+}
+
+func (p *partialSignatures[T]) forget(key string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	delete(p.entries, key)
+}
+
+type signReply[T any] struct {
+	peer   peer.ID
+	answer T
+	err    error
+}
+
+// collectSignatures asks the cosigners to sign until the weight of their signatures reaches required
+// The fastest cosigners that can reach the required weight are asked first,
+// the others are asked when one of them fails or if they take longer than slowCosignerDelay.
+// Cosigners that fail are asked again with an increasing backoff. The signatures of a round that does not reach
+// the required weight are kept under key and reused by the next round if it asks to sign the same version.
+func collectSignatures[T any](ctx context.Context, s *SignersClient, partial *partialSignatures[T], key string, version string, required int, cosigners []cosigner, sign func(ctx context.Context, id peer.ID) (T, error)) ([]T, error) {
+	roundCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	weights := make(map[peer.ID]int, len(cosigners))
+	for _, c := range cosigners {
+		weights[c.id] = c.weight
+	}
+	collected := partial.get(key, version)
+	weight := 0
+	for id := range collected {
+		if _, ok := weights[id]; !ok {
+			// no longer a cosigner
+			delete(collected, id)
+			continue
+		}
+		weight += weights[id]
+	}
+	if weight > 0 {
+		log.Info("Reusing signatures of a previous attempt", "signatures", len(collected), "weight", weight)
+	}
+
+	queue := make([]cosigner, 0, len(cosigners))
+	for _, c := range cosigners {
+		if _, ok := collected[c.id]; !ok {
+			queue = append(queue, c)
+		}
+	}
+
+	// buffered so the requests never block after the signing round is over
+	replies := make(chan signReply[T], len(cosigners))
+	retries := make(chan peer.ID, len(cosigners))
+	attempts := make(map[peer.ID]int, len(cosigners))
+	pending, waiting := 0, 0
+	ask := func(id peer.ID) {
+		attempts[id]++
+		pending++
+		go func() {
+			peerCtx, cancel := context.WithTimeout(roundCtx, s.peerTimeout)
+			defer cancel()
+			answer, err := sign(peerCtx, id)
+			replies <- signReply[T]{peer: id, answer: answer, err: err}
+		}()
+	}
+	askOthers := func() {
+		for _, c := range queue {
+			ask(c.id)
+		}
+		queue = nil
+	}
+
+	for askedWeight := weight; len(queue) > 0 && askedWeight < required; queue = queue[1:] {
+		askedWeight += queue[0].weight
+		ask(queue[0].id)
+	}
+	slow := time.After(slowCosignerDelay)
+
+collect:
+	for weight < required && pending+waiting+len(queue) > 0 {
+		select {
+		case <-roundCtx.Done():
+			break collect
+		case <-slow:
+			askOthers()
+		case id := <-retries:
+			waiting--
+			ask(id)
+		case reply := <-replies:
+			pending--
+			if reply.err != nil {
+				log.Error("failed to get signature", "peerID", reply.peer, "attempt", attempts[reply.peer], "err", reply.err.Error())
+				if attempts[reply.peer] < maxCosignerAttempts {
+					waiting++
+					backoff := cosignerRetryBackoff << (attempts[reply.peer] - 1)
+					time.AfterFunc(backoff, func() { retries <- reply.peer })
+				}
+				askOthers()
+				continue
+			}
+			log.Info("got a valid reply", "peerID", reply.peer)
+			collected[reply.peer] = reply.answer
+			weight += weights[reply.peer]
+		}
+		if pending == 0 && waiting == 0 {
+			askOthers()
+		}
+	}
+
+	if weight < required {
+		partial.keep(key, version, collected)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("required signature weight is not met, got %d, need %d", weight, required)
+	}
+	partial.forget(key)
+
+	results := make([]T, 0, len(collected))
+	for _, c := range cosigners {
+		if signature, ok := collected[c.id]; ok {
+			results = append(results, signature)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCosigners signs with the cosigners that do not fail and counts how often each one is asked
+type fakeCosigners struct {
+	mut   sync.Mutex
+	fail  map[peer.ID]int
+	asked map[peer.ID]int
+}
+
+func (f *fakeCosigners) sign(ctx context.Context, id peer.ID) (string, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.asked[id]++
+	if f.fail[id] != 0 {
+		f.fail[id]--
+		return "", errors.New("unavailable")
+	}
+	return string(id), nil
+}
+
+func TestCollectSignatures(t *testing.T) {
+	s := &SignersClient{timeout: 500 * time.Millisecond, peerTimeout: 100 * time.Millisecond}
+	partial := newPartialSignatures[string]()
+	cosigners := []cosigner{{id: "a", weight: 1}, {id: "b", weight: 1}, {id: "c", weight: 1}}
+
+	// Only a signs, its signature is kept
+	f := &fakeCosigners{fail: map[peer.ID]int{"b": -1, "c": -1}, asked: map[peer.ID]int{}}
+	_, err := collectSignatures(context.Background(), s, partial, "mint", "", 2, cosigners, f.sign)
+	assert.Error(t, err)
+	assert.Len(t, partial.get("mint", ""), 1)
+	// the signature is not reused for another version of the request
+	assert.Empty(t, partial.get("mint", "rebuilt"))
+
+	// The next attempt reuses it and retries b after a failure
+	s.timeout = 3 * time.Second
+	f = &fakeCosigners{fail: map[peer.ID]int{"b": 1, "c": -1}, asked: map[peer.ID]int{}}
+	signatures, err := collectSignatures(context.Background(), s, partial, "mint", "", 2, cosigners, f.sign)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, signatures)
+	assert.Equal(t, 0, f.asked["a"])
+	assert.Equal(t, 2, f.asked["b"])
+	assert.Empty(t, partial.get("mint", ""))
+}
@@ -0,0 +1,256 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+const (
+	// ProtocolV2 is the signer protocol where every signing request is signed by the master
+	ProtocolV2 = protocol.ID("/p2p/rpc/signer/2")
+	// ProtocolVersion is the latest version of the signer protocol
+	ProtocolVersion = 2
+
+	// signedRequestLifetime is how long a signed request the master sends is valid
+	signedRequestLifetime = time.Minute
+	// maxSignedRequestLifetime is the longest lifetime a cosigner accepts,
+	// it bounds how long the IDs of the requests need to be remembered to detect replays
+	maxSignedRequestLifetime = 5 * time.Minute
+)
+
+// Capabilities of the cosigners, a master only sends requests a cosigner announced it supports
+const (
+	CapabilityStellarSign    = "stellar-sign"
+	CapabilityEthSign        = "eth-sign"
+	CapabilitySignerRotation = "signer-rotation"
+)
+
+// signerCapabilities are the capabilities of this cosigner
+var signerCapabilities = []string{CapabilityStellarSign, CapabilityEthSign, CapabilitySignerRotation}
+
+// stellarSignCapability returns the capability a cosigner needs to sign a request of the given kind
+func stellarSignCapability(kind multisig.RequestKind) string {
+	switch kind {
+	case multisig.KindSignerRotation:
+		return CapabilitySignerRotation
+	}
+	return CapabilityStellarSign
+}
+
+var (
+	ErrInvalidSignedRequest = errors.New("Invalid signed request")
+	ErrExpiredRequest       = errors.Wrap(ErrInvalidSignedRequest, "the request is expired")
+	ErrReplayedRequest      = errors.Wrap(ErrInvalidSignedRequest, "the request was received before")
+	ErrRequestBeforeStart   = errors.Wrap(ErrInvalidSignedRequest, "the request was issued before the cosigner started")
+)
+
+// SignedRequest is a request of the version 2 signer protocol
+type SignedRequest struct {
+	// ID is unique for every request
+	ID string
+	// Method is the method of the SignerService the request is for
+	Method string
+	// Issued is the unix time in milliseconds the request is created
+	Issued int64
+	// Expires is the unix time after which the request is refused
+	Expires int64
+	// Master is the Stellar address of the master that sent the request
+	Master string
+	// Payload is the gob encoded request for the method
+	Payload []byte
+	// Signature is the signature of the master over all other fields
+	Signature []byte
+}
+
+// message returns what the master signs
+func (r SignedRequest) message() []byte {
+	r.Signature = nil
+	// json encoding of a struct is deterministic
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// CapabilitiesRequest asks a cosigner for the protocol version and capabilities it supports
+type CapabilitiesRequest struct{}
+
+// CapabilitiesResponse are the protocol version and capabilities a cosigner supports
+type CapabilitiesResponse struct {
+	Version      int
+	Capabilities []string
+}
+
+// requestSigner signs requests on behalf of the master
+type requestSigner interface {
+	GetAddress() string
+	SignMessage(message []byte) ([]byte, error)
+}
+
+// newSignedRequest creates a request for method signed by signer
+func newSignedRequest(signer requestSigner, method string, request interface{}) (signed SignedRequest, err error) {
+	var payload bytes.Buffer
+	if err = gob.NewEncoder(&payload).Encode(request); err != nil {
+		return
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	now := time.Now()
+	signed = SignedRequest{
+		ID:      hex.EncodeToString(id),
+		Method:  method,
+		Issued:  now.UnixMilli(),
+		Expires: now.Add(signedRequestLifetime).Unix(),
+		Master:  signer.GetAddress(),
+		Payload: payload.Bytes(),
+	}
+	signed.Signature, err = signer.SignMessage(signed.message())
+	return
+}
+
+// requestVerifier verifies the signed requests a cosigner receives
+type requestVerifier struct {
+	masters map[string]bool
+	// seen are the IDs of the requests that are not expired yet with their expiration
+	seen map[string]time.Time
+	// started is when the verifier is created, the seen IDs of earlier requests are lost
+	// so requests issued before are refused
+	started time.Time
+	mut     sync.Mutex
+	now     func() time.Time
+}
+
+func newRequestVerifier(masters []string) *requestVerifier {
+	v := &requestVerifier{
+		masters: make(map[string]bool, len(masters)),
+		seen:    make(map[string]time.Time),
+		started: time.Now(),
+		now:     time.Now,
+	}
+	for _, master := range masters {
+		v.masters[master] = true
+	}
+	return v
+}
+
+// verify checks that the request for method is sent and signed by a master, is not expired, was not received before
+// and was not issued before the verifier started, it could have been received before a restart then.
+// The payload is decoded in request.
+func (v *requestVerifier) verify(sender peer.ID, method string, signed SignedRequest, request interface{}) error {
+	if signed.Method != method {
+		return errors.Wrapf(ErrInvalidSignedRequest, "the request is for %s", signed.Method)
+	}
+	if !v.masters[signed.Master] {
+		return errors.Wrapf(ErrInvalidSignedRequest, "%s is not a master", signed.Master)
+	}
+	masterID, err := p2p.GetPeerIDFromStellarAddress(signed.Master)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignedRequest, err.Error())
+	}
+	if masterID != sender {
+		return errors.Wrapf(ErrInvalidSignedRequest, "the request of %s is sent by %s", signed.Master, sender)
+	}
+	kp, err := keypair.ParseAddress(signed.Master)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignedRequest, err.Error())
+	}
+	if err = kp.Verify(signed.message(), signed.Signature); err != nil {
+		return errors.Wrap(ErrInvalidSignedRequest, "invalid signature")
+	}
+
+	now := v.now()
+	expires := time.Unix(signed.Expires, 0)
+	if !now.Before(expires) {
+		return ErrExpiredRequest
+	}
+	if expires.Sub(now) > maxSignedRequestLifetime {
+		return errors.Wrap(ErrInvalidSignedRequest, "the request expires too late")
+	}
+	if signed.Issued < v.started.UnixMilli() {
+		return ErrRequestBeforeStart
+	}
+
+	v.mut.Lock()
+	for id, e := range v.seen {
+		if !now.Before(e) {
+			delete(v.seen, id)
+		}
+	}
+	if _, seen := v.seen[signed.ID]; seen {
+		v.mut.Unlock()
+		return ErrReplayedRequest
+	}
+	v.seen[signed.ID] = expires
+	v.mut.Unlock()
+
+	if err = gob.NewDecoder(bytes.NewReader(signed.Payload)).Decode(request); err != nil {
+		return errors.Wrap(ErrInvalidSignedRequest, err.Error())
+	}
+	return nil
+}
+
+// SignerServiceV2 is the SignerService of the version 2 protocol
+// It is registered under the SignerService name.
+type SignerServiceV2 struct {
+	service  *SignerService
+	verifier *requestVerifier
+}
+
+func (s *SignerServiceV2) verify(ctx context.Context, method string, signed SignedRequest, request interface{}) error {
+	sender, err := gorpc.GetRequestSender(ctx)
+	if err != nil {
+		return err
+	}
+	if err = s.verifier.verify(sender, method, signed, request); err != nil {
+		log.Warn("Refusing a signed request", "id", signed.ID, "method", method, "master", signed.Master, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Capabilities returns the protocol version and capabilities of the cosigner
+func (s *SignerServiceV2) Capabilities(ctx context.Context, request CapabilitiesRequest, response *CapabilitiesResponse) error {
+	response.Version = ProtocolVersion
+	response.Capabilities = signerCapabilities
+	return nil
+}
+
+// Status returns the status of the cosigner
+func (s *SignerServiceV2) Status(ctx context.Context, request StatusRequest, response *StatusResponse) error {
+	return s.service.Status(ctx, request, response)
+}
+
+func (s *SignerServiceV2) Sign(ctx context.Context, signed SignedRequest, response *multisig.StellarSignResponse) error {
+	var request multisig.StellarSignRequest
+	if err := s.verify(ctx, "Sign", signed, &request); err != nil {
+		return err
+	}
+	// Only masters that set the kind use the version 2 protocol
+	if request.Kind == "" {
+		return errors.Wrap(ErrInvalidTransaction, "the kind of the request is not set")
+	}
+	return s.service.Sign(ctx, request, response)
+}
+
+func (s *SignerServiceV2) SignMint(ctx context.Context, signed SignedRequest, response *EthSignResponse) error {
+	var request EthSignRequest
+	if err := s.verify(ctx, "SignMint", signed, &request); err != nil {
+		return err
+	}
+	return s.service.SignMint(ctx, request, response)
+}
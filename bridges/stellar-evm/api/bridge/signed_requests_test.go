@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+)
+
+type keypairSigner struct {
+	*keypair.Full
+}
+
+func (k keypairSigner) GetAddress() string {
+	return k.Address()
+}
+
+func (k keypairSigner) SignMessage(message []byte) ([]byte, error) {
+	return k.Sign(message)
+}
+
+func TestSignedRequests(t *testing.T) {
+	master := keypairSigner{keypair.MustRandom()}
+	masterID, err := p2p.GetPeerIDFromStellarAddress(master.Address())
+	assert.NoError(t, err)
+	v := newRequestVerifier([]string{master.Address()})
+
+	request := EthSignRequest{TxId: "abc", Amount: 10, RequiredSignatures: 2}
+	signed, err := newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+
+	var received EthSignRequest
+	assert.NoError(t, v.verify(masterID, "SignMint", signed, &received))
+	assert.Equal(t, request, received)
+
+	// replayed
+	assert.True(t, errors.Is(v.verify(masterID, "SignMint", signed, &received), ErrReplayedRequest))
+
+	// for another method
+	signed, err = newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(v.verify(masterID, "Sign", signed, &received), ErrInvalidSignedRequest))
+
+	// tampered
+	signed, err = newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+	signed.Expires++
+	assert.True(t, errors.Is(v.verify(masterID, "SignMint", signed, &received), ErrInvalidSignedRequest))
+
+	// sent by another peer
+	signed, err = newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+	otherID, err := p2p.GetPeerIDFromStellarAddress(keypair.MustRandom().Address())
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(v.verify(otherID, "SignMint", signed, &received), ErrInvalidSignedRequest))
+
+	// signed by someone else than a master
+	other := keypairSigner{keypair.MustRandom()}
+	signed, err = newSignedRequest(other, "SignMint", &request)
+	assert.NoError(t, err)
+	otherID, err = p2p.GetPeerIDFromStellarAddress(other.Address())
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(v.verify(otherID, "SignMint", signed, &received), ErrInvalidSignedRequest))
+
+	// expired
+	signed, err = newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+	v.now = func() time.Time { return time.Now().Add(signedRequestLifetime) }
+	assert.True(t, errors.Is(v.verify(masterID, "SignMint", signed, &received), ErrExpiredRequest))
+
+	// expires too late
+	v.now = func() time.Time { return time.Now().Add(-maxSignedRequestLifetime) }
+	assert.True(t, errors.Is(v.verify(masterID, "SignMint", signed, &received), ErrInvalidSignedRequest))
+
+	// issued before a restart of the cosigner, it could have been received already
+	v.now = time.Now
+	signed, err = newSignedRequest(master, "SignMint", &request)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	v = newRequestVerifier([]string{master.Address()})
+	assert.True(t, errors.Is(v.verify(masterID, "SignMint", signed, &received), ErrRequestBeforeStart))
+}
+
+func TestNegotiate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cosigner, err := NewDirectHost(keypair.MustRandom().Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, nil, testPSK)
+	assert.NoError(t, err)
+	defer cosigner.Close()
+	gorpc.NewServer(cosigner, Protocol)
+	upgraded, err := NewDirectHost(keypair.MustRandom().Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, nil, testPSK)
+	assert.NoError(t, err)
+	defer upgraded.Close()
+	assert.NoError(t, gorpc.NewServer(upgraded, ProtocolV2).RegisterName("SignerService", &SignerServiceV2{}))
+
+	master, err := NewDirectHost(keypair.MustRandom().Seed(), []string{"/ip4/127.0.0.1/tcp/0"}, nil, testPSK)
+	assert.NoError(t, err)
+	defer master.Close()
+	assert.NoError(t, master.Connect(ctx, peer.AddrInfo{ID: cosigner.ID(), Addrs: cosigner.Addrs()}))
+	assert.NoError(t, master.Connect(ctx, peer.AddrInfo{ID: upgraded.ID(), Addrs: upgraded.Addrs()}))
+
+	// identify might not have finished, the protocol is negotiated when opening the stream
+	client := NewSignersClient(master, nil, nil, keypairSigner{keypair.MustRandom()})
+	capabilities, err := client.negotiate(ctx, cosigner.ID())
+	assert.NoError(t, err)
+	assert.Nil(t, capabilities)
+
+	capabilities, err = client.negotiate(ctx, upgraded.ID())
+	assert.NoError(t, err)
+	assert.Len(t, capabilities, len(signerCapabilities))
+}
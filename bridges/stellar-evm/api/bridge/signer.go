@@ -5,6 +5,8 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -15,10 +17,11 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
-	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	"github.com/stellar/go/strkey"
 	"github.com/stellar/go/support/errors"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/p2p"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
 	"github.com/threefoldtech/libp2p-relay/client"
 )
 
@@ -43,32 +46,40 @@ func (c *SignerConfig) Valid() error {
 	return nil
 }
 
-func NewHost(ctx context.Context, secret, relay string, psk string) (host.Host, routing.PeerRouting, error) {
+// privateKeyFromSecret returns the libp2p key of a Stellar secret, the peer ID matches the Stellar address
+func privateKeyFromSecret(secret string) (crypto.PrivKey, error) {
 	seed, err := strkey.Decode(strkey.VersionByteSeed, secret)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	if len(seed) != ed25519.SeedSize {
-		return nil, nil, fmt.Errorf("invalid seed size '%d' expecting '%d'", len(seed), ed25519.SeedSize)
+		return nil, fmt.Errorf("invalid seed size '%d' expecting '%d'", len(seed), ed25519.SeedSize)
 	}
+	return crypto.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(seed))
+}
 
-	var privKey crypto.PrivKey
-	if secret != "" {
-		privKey, err = crypto.UnmarshalEd25519PrivateKey(
-			ed25519.NewKeyFromSeed(seed),
-		)
-		if err != nil {
-			return nil, nil, err
-		}
+// decodePSK decodes the hex encoded pre-shared key of the private network of the bridges
+func decodePSK(psk string) ([]byte, error) {
+	key, err := hex.DecodeString(psk)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("psk must be 32 bytes long")
 	}
+	return key, nil
+}
 
-	key, err := hex.DecodeString(psk)
+func NewHost(ctx context.Context, secret, relay string, psk string) (host.Host, routing.PeerRouting, error) {
+	privKey, err := privateKeyFromSecret(secret)
 	if err != nil {
 		return nil, nil, err
 	}
-	if len(key) != 32 {
-		return nil, nil, errors.New("psk must be 32 bytes long")
+
+	key, err := decodePSK(psk)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	relayAddrInfo, err := peer.AddrInfoFromString(relay)
@@ -93,196 +104,247 @@ func NewHost(ctx context.Context, secret, relay string, psk string) (host.Host,
 	return ar, routing, nil
 }
 
-type SignersClient struct {
-	peers  []peer.ID
-	host   host.Host
-	router routing.PeerRouting
-	client *gorpc.Client
-	relay  *peer.AddrInfo
-}
+// slowCosignerDelay is how long the fastest cosigners get to reach the required weight before the others are asked
+const slowCosignerDelay = 2 * time.Second
 
-type response struct {
-	answer *multisig.StellarSignResponse
-	peer   peer.ID
-	err    error
+type cosigner struct {
+	id     peer.ID
+	weight int
 }
 
-type ethResponse struct {
-	answer *EthSignResponse
-	peer   peer.ID
-	err    error
+type SignersClient struct {
+	cosigners []cosigner
+	// capabilities of the negotiated cosigners, nil for the ones that only support the version 1 protocol
+	capabilities map[peer.ID]map[string]bool
+	mut          sync.RWMutex
+	host         host.Host
+	router       routing.PeerRouting
+	client       *gorpc.Client
+	clientV2     *gorpc.Client
+	relay        *peer.AddrInfo
+	signer       requestSigner
+	// timeout is how long a signing round takes at most, peerTimeout how long a single cosigner gets to answer
+	timeout     time.Duration
+	peerTimeout time.Duration
+	// signatures of the previous attempts that did not reach the required weight
+	stellarSignatures *partialSignatures[multisig.StellarSignResponse]
+	ethSignatures     *partialSignatures[EthSignResponse]
+	// peers keeps the connections to the cosigners and tracks their health
+	peers *peerManager
 }
 
 // NewSignersClient creates a signer client to ask cosigners to sign
-func NewSignersClient(host host.Host, router routing.PeerRouting, cosigners []peer.ID, relay *peer.AddrInfo) *SignersClient {
+// The cosigners are set with SetCosigners.
+// Cosigners that support the version 2 protocol get requests signed by signer.
+func NewSignersClient(host host.Host, router routing.PeerRouting, relay *peer.AddrInfo, signer requestSigner) *SignersClient {
 
 	return &SignersClient{
-		client: gorpc.NewClient(host, Protocol),
-		host:   host,
-		router: router,
-		peers:  cosigners,
-		relay:  relay,
+		capabilities: make(map[peer.ID]map[string]bool),
+		client:       gorpc.NewClient(host, Protocol),
+		clientV2:     gorpc.NewClient(host, ProtocolV2),
+		host:         host,
+		router:       router,
+		relay:        relay,
+		signer:       signer,
+		timeout:      DefaultSignTimeout,
+		peerTimeout:  DefaultCosignerTimeout,
+
+		stellarSignatures: newPartialSignatures[multisig.StellarSignResponse](),
+		ethSignatures:     newPartialSignatures[EthSignResponse](),
+		peers:             newPeerManager(host, router, relay),
 	}
 }
 
-func (s *SignersClient) Sign(ctx context.Context, signRequest multisig.StellarSignRequest) ([]multisig.StellarSignResponse, error) {
-	// cancel context after 30 seconds
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	responseChannels := make([]chan response, 0, len(s.peers))
-	for _, addr := range s.peers {
-		respCh := make(chan response, 1)
-		responseChannels = append(responseChannels, respCh)
-		go func(peerID peer.ID, ch chan response) {
-			defer close(ch)
-			answer, err := s.sign(ctxWithTimeout, peerID, signRequest)
-
-			select {
-			case <-ctxWithTimeout.Done():
-			case ch <- response{answer: answer, peer: peerID, err: err}:
-			}
-		}(addr, respCh)
+// SetTimeouts sets how long a signing round takes at most and how long a single cosigner gets to answer
+func (s *SignersClient) SetTimeouts(timeout time.Duration, peerTimeout time.Duration) {
+	s.timeout = timeout
+	s.peerTimeout = peerTimeout
+}
 
+// SetCosigners replaces the cosigners that are asked to sign
+func (s *SignersClient) SetCosigners(signers []stellar.Signer) error {
+	cosigners := make([]cosigner, 0, len(signers))
+	ids := make([]peer.ID, 0, len(signers))
+	for _, signer := range signers {
+		id, err := p2p.GetPeerIDFromStellarAddress(signer.Address)
+		if err != nil {
+			return err
+		}
+		cosigners = append(cosigners, cosigner{id: id, weight: signer.Weight})
+		ids = append(ids, id)
 	}
+	s.peers.setPeers(ids)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.cosigners = cosigners
+	// renegotiate, cosigners might have been upgraded
+	s.capabilities = make(map[peer.ID]map[string]bool)
+	return nil
+}
 
-	var results []multisig.StellarSignResponse
+// negotiate returns the capabilities of a connected cosigner, nil if it only supports the unsigned version 1 protocol
+func (s *SignersClient) negotiate(ctx context.Context, id peer.ID) (map[string]bool, error) {
+	s.mut.RLock()
+	capabilities, ok := s.capabilities[id]
+	s.mut.RUnlock()
+	if ok {
+		return capabilities, nil
+	}
 
-	for len(responseChannels) > 0 {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		receivedFrom := -1
-	responsechannelsLoop:
-		for i, responseChannel := range responseChannels {
-			select {
-			case reply := <-responseChannel:
-				receivedFrom = i
-				if reply.err != nil {
-					log.Error("failed to get signature", "peerID", reply.peer, "err", reply.err.Error())
-				} else {
-					if reply.answer != nil {
-						log.Info("got a valid reply", "peerID", reply.peer)
-						results = append(results, *reply.answer)
-					}
-				}
-				break responsechannelsLoop
-			default: //don't block
-			}
-		}
-		if receivedFrom >= 0 {
-			//Remove the channel from the list
-			responseChannels[receivedFrom] = responseChannels[len(responseChannels)-1]
-			responseChannels = responseChannels[:len(responseChannels)-1]
-			//check if we have enough signatures
-			if len(results) == signRequest.RequiredSignatures {
-				break
-			}
-		} else {
-			time.Sleep(time.Millisecond * 100)
+	// The protocols a peer supports are only known in the peerstore once identify has finished,
+	// so the version 2 protocol is tried and the version 1 protocol is only used if the cosigner refuses it.
+	var response CapabilitiesResponse
+	if err := s.clientV2.CallContext(ctx, id, "SignerService", "Capabilities", &CapabilitiesRequest{}, &response); err != nil {
+		if !isProtocolNotSupported(err) {
+			return nil, errors.Wrap(err, "failed to get the capabilities of the cosigner")
 		}
-
+		log.Debug("the cosigner only supports the version 1 signer protocol", "peerID", id)
+		s.mut.Lock()
+		s.capabilities[id] = nil
+		s.mut.Unlock()
+		return nil, nil
 	}
-
-	if len(results) != signRequest.RequiredSignatures {
-		return nil, fmt.Errorf("required number of signatures is not met")
+	capabilities = make(map[string]bool, len(response.Capabilities))
+	for _, capability := range response.Capabilities {
+		capabilities[capability] = true
 	}
+	log.Debug("negotiated the signer protocol", "peerID", id, "version", response.Version, "capabilities", response.Capabilities)
 
-	return results, nil
+	s.mut.Lock()
+	s.capabilities[id] = capabilities
+	s.mut.Unlock()
+	return capabilities, nil
 }
 
-func (s *SignersClient) sign(ctx context.Context, id peer.ID, signRequest multisig.StellarSignRequest) (*multisig.StellarSignResponse, error) {
-	arHost := s.host.(*autorelay.AutoRelayHost)
+// forgetCapabilities makes the protocol of a cosigner be negotiated again on the next call
+func (s *SignersClient) forgetCapabilities(id peer.ID) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	delete(s.capabilities, id)
+}
 
-	if err := client.ConnectToPeer(ctx, arHost, s.router, s.relay, id); err != nil {
-		return nil, errors.Wrapf(err, "failed to connect to host id '%s'", id)
-	}
+// isProtocolNotSupported returns true if opening a stream failed because the peer does not support the protocol
+// The rpc client only passes the message of the multistream error.
+func isProtocolNotSupported(err error) bool {
+	return strings.Contains(err.Error(), "protocols not supported")
+}
 
-	var response multisig.StellarSignResponse
-	if err := s.client.CallContext(ctx, id, "SignerService", "Sign", &signRequest, &response); err != nil {
-		return nil, err
+// call calls a method of the SignerService of a connected cosigner
+// The request is signed if the cosigner supports the version 2 protocol, it must then support the capability as well.
+func (s *SignersClient) call(ctx context.Context, id peer.ID, method string, capability string, request interface{}, response interface{}) error {
+	capabilities, err := s.negotiate(ctx, id)
+	if err != nil {
+		return err
 	}
-
-	return &response, nil
+	if capabilities == nil {
+		if err = s.client.CallContext(ctx, id, "SignerService", method, request, response); err != nil {
+			// the cosigner might have been upgraded
+			s.forgetCapabilities(id)
+		}
+		return err
+	}
+	if !capabilities[capability] {
+		return fmt.Errorf("the cosigner does not support %s", capability)
+	}
+	signed, err := newSignedRequest(s.signer, method, request)
+	if err != nil {
+		return err
+	}
+	if err = s.clientV2.CallContext(ctx, id, "SignerService", method, &signed, response); err != nil {
+		// the cosigner might have been downgraded
+		s.forgetCapabilities(id)
+		return err
+	}
+	return nil
 }
 
-func (s *SignersClient) SignMint(ctx context.Context, signRequest EthSignRequest) ([]EthSignResponse, error) {
-	// cancel context after 30 seconds
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	responseChannels := make([]chan ethResponse, 0, len(s.peers))
-	for _, addr := range s.peers {
-		respCh := make(chan ethResponse, 1)
-		responseChannels = append(responseChannels, respCh)
-		go func(peerID peer.ID, ch chan ethResponse) {
-			defer close(ch)
-			answer, err := s.signMint(ctxWithTimeout, peerID, signRequest)
-
-			select {
-			case <-ctxWithTimeout.Done():
-			case ch <- ethResponse{answer: answer, peer: peerID, err: err}:
-			}
-		}(addr, respCh)
+func (s *SignersClient) getCosigners() []cosigner {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.cosigners
+}
 
-	}
+// cosignersByHealth returns the cosigners, the healthy ones with the lowest latency first
+func (s *SignersClient) cosignersByHealth() []cosigner {
+	return s.peers.order(append([]cosigner(nil), s.getCosigners()...))
+}
 
-	var results []EthSignResponse
+// MonitorPeers keeps the connections to the cosigners and pings them until the context is canceled
+func (s *SignersClient) MonitorPeers(ctx context.Context) {
+	s.peers.Run(ctx)
+}
 
-	for len(responseChannels) > 0 {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		receivedFrom := -1
-	responsechannelsLoop:
-		for i, responseChannel := range responseChannels {
-			select {
-			case reply := <-responseChannel:
-				receivedFrom = i
-				if reply.err != nil {
-					log.Error("failed to get signature", "peerID", reply.peer, "err", reply.err.Error())
-				} else {
-					if reply.answer != nil {
-						log.Info("got a valid reply from a signer")
-						results = append(results, *reply.answer)
-					}
-				}
-				break responsechannelsLoop
-			default: //don't block
-			}
-		}
-		if receivedFrom >= 0 {
-			//Remove the channel from the list
-			responseChannels[receivedFrom] = responseChannels[len(responseChannels)-1]
-			responseChannels = responseChannels[:len(responseChannels)-1]
-			//check if we have enough signatures
-			if len(results) == int(signRequest.RequiredSignatures) {
-				break
-			}
-		} else {
-			time.Sleep(time.Millisecond * 100)
+// callCosigner connects to a cosigner if needed, calls a method of its SignerService and records the health of the cosigner
+func (s *SignersClient) callCosigner(ctx context.Context, id peer.ID, method string, capability string, request interface{}, response interface{}) error {
+	if err := s.peers.connect(ctx, id); err != nil {
+		s.peers.failed(id, err)
+		return errors.Wrapf(err, "failed to connect to host id '%s'", id)
+	}
+	start := time.Now()
+	if err := s.call(ctx, id, method, capability, request, response); err != nil {
+		// the signing round is over, it is not the fault of the cosigner
+		if ctx.Err() != context.Canceled {
+			s.peers.failed(id, err)
 		}
-
+		return err
 	}
+	s.peers.succeeded(id, time.Since(start), true)
+	return nil
+}
 
-	if len(results) != int(signRequest.RequiredSignatures) {
-		return nil, fmt.Errorf("required number of signatures is not met")
+// Sign collects signatures until their weight reaches signRequest.RequiredSignatures
+// The signatures collected by an attempt that fails are reused by the next attempt for the same transaction.
+func (s *SignersClient) Sign(ctx context.Context, signRequest multisig.StellarSignRequest) ([]multisig.StellarSignResponse, error) {
+	sign := func(ctx context.Context, id peer.ID) (multisig.StellarSignResponse, error) {
+		answer, err := s.sign(ctx, id, signRequest)
+		if err != nil {
+			return multisig.StellarSignResponse{}, err
+		}
+		return *answer, nil
 	}
+	return collectSignatures(ctx, s, s.stellarSignatures, stellarSignKey(signRequest), signRequest.TxnXDR, signRequest.RequiredSignatures, s.cosignersByHealth(), sign)
+}
 
-	return results, nil
+// stellarSignKey identifies a signing request across attempts, the transaction is the version that is signed
+// Requests that do not reference what they sign are identified by their transaction.
+func stellarSignKey(signRequest multisig.StellarSignRequest) string {
+	if key := signRequest.Key(); key != "" {
+		return key
+	}
+	return signRequest.TxnXDR
 }
 
-func (s *SignersClient) signMint(ctx context.Context, id peer.ID, signRequest EthSignRequest) (*EthSignResponse, error) {
-	arHost := s.host.(*autorelay.AutoRelayHost)
+func (s *SignersClient) sign(ctx context.Context, id peer.ID, signRequest multisig.StellarSignRequest) (*multisig.StellarSignResponse, error) {
+	var response multisig.StellarSignResponse
+	if err := s.callCosigner(ctx, id, "Sign", stellarSignCapability(signRequest.Kind), &signRequest, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
 
-	if err := client.ConnectToPeer(ctx, arHost, s.router, s.relay, id); err != nil {
-		return nil, errors.Wrapf(err, "failed to connect to host id '%s'", id.Pretty())
+// SignMint collects signRequest.RequiredSignatures signatures of the cosigners for a mint
+// The signatures collected by an attempt that fails are reused by the next attempt for the same mint.
+func (s *SignersClient) SignMint(ctx context.Context, signRequest EthSignRequest) ([]EthSignResponse, error) {
+	// every cosigner signs the mint once
+	cosigners := s.cosignersByHealth()
+	for i := range cosigners {
+		cosigners[i].weight = 1
 	}
+	sign := func(ctx context.Context, id peer.ID) (EthSignResponse, error) {
+		answer, err := s.signMint(ctx, id, signRequest)
+		if err != nil {
+			return EthSignResponse{}, err
+		}
+		return *answer, nil
+	}
+	key := fmt.Sprint(signRequest.Receiver, signRequest.Amount, signRequest.TxId)
+	return collectSignatures(ctx, s, s.ethSignatures, key, "", int(signRequest.RequiredSignatures), cosigners, sign)
+}
 
+func (s *SignersClient) signMint(ctx context.Context, id peer.ID, signRequest EthSignRequest) (*EthSignResponse, error) {
 	var response EthSignResponse
-	if err := s.client.CallContext(ctx, id, "SignerService", "SignMint", &signRequest, &response); err != nil {
+	if err := s.callCosigner(ctx, id, "SignMint", CapabilityEthSign, &signRequest, &response); err != nil {
 		return nil, err
 	}
-
 	return &response, nil
 }
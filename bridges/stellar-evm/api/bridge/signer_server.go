@@ -3,11 +3,10 @@ package bridge
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math/big"
-	"strings"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	gorpc "github.com/libp2p/go-libp2p-gorpc"
@@ -15,10 +14,10 @@ import (
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
-	"github.com/shopspring/decimal"
-	"github.com/stellar/go/protocols/horizon/effects"
+	"github.com/stellar/go/amount"
 	"github.com/stellar/go/txnbuild"
 	"github.com/stellar/go/xdr"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/contracts/tokenv1"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
@@ -41,6 +40,9 @@ type EthSignRequest struct {
 	Amount             int64
 	TxId               string
 	RequiredSignatures int64
+	// Approval is the operator approval for a mint that needs one,
+	// or the operator rejection for the return of a withdrawal that was rejected
+	Approval string
 }
 
 type EthSignResponse struct {
@@ -52,10 +54,35 @@ type SignerService struct {
 	bridgeContract      *BridgeContract
 	stellarWallet       *stellar.Wallet
 	bridgeMasterAddress string
-	depositFee          int64 // deposit fee in TFT units TODO: maybe just pass part of the comfig
+	depositFee          int64 // deposit fee in TFT units
+	pauseSwitch         *PauseSwitch
+	mintGuard           *transferGuard
+	withdrawGuard       *transferGuard
+	blocklist           *addressBlocklist
+	// approver is the Stellar address of the operator that approves signer rotations
+	approver   string
+	authorizer *signerAuthorizer
+	// watchdog is nil if the cosigner does not watch the master
+	watchdog *Watchdog
+	// requireKind refuses requests without a kind instead of inferring it, once all masters set it
+	requireKind bool
 }
 
-func NewSignerServer(host host.Host, bridgeMasterAddress string, bridgeContract *BridgeContract, stellarWallet *stellar.Wallet, depositFee int64) error {
+// StatusRequest asks a cosigner for its status
+type StatusRequest struct{}
+
+// StatusResponse is the status of a cosigner
+type StatusResponse struct {
+	// Address is the Stellar address of the cosigner
+	Address string
+	Paused  bool
+	// RejectedCalls is the number of calls from unauthorized peers since the cosigner started
+	RejectedCalls uint64
+	// WatchdogAlerts is the number of watchdog alerts since the cosigner started
+	WatchdogAlerts uint64
+}
+
+func NewSignerServer(host host.Host, bridgeMasterAddress string, bridgeContract *BridgeContract, stellarWallet *stellar.Wallet, config *BridgeConfig, pauseSwitch *PauseSwitch, circuitBreaker *CircuitBreaker, watchdog *Watchdog) error {
 	log.Info("server started", "identity", host.ID().Pretty())
 	partialMA, err := multiaddr.NewMultiaddr(fmt.Sprintf("/p2p/%s", host.ID()))
 	if err != nil {
@@ -67,20 +94,65 @@ func NewSignerServer(host host.Host, bridgeMasterAddress string, bridgeContract
 		log.Info("p2p node address", "address", full.String())
 	}
 
-	server := gorpc.NewServer(host, Protocol)
-
-	signerService := SignerService{
+	// Only the masters can ask for signatures, any of the leader candidates can be elected as the master
+	masters := append([]string{bridgeMasterAddress}, config.AuthorizedMasters...)
+	masters = append(masters, config.LeaderCandidates...)
+	authorizer, err := newSignerAuthorizer(masters, config.ReadOnlyPeers)
+	if err != nil {
+		return err
+	}
+	signerService := &SignerService{
 		bridgeContract:      bridgeContract,
 		stellarWallet:       stellarWallet,
 		bridgeMasterAddress: bridgeMasterAddress,
-		depositFee:          depositFee,
+		depositFee:          config.DepositFee,
+		pauseSwitch:         pauseSwitch,
+		mintGuard:           newTransferGuard(config, pauseSwitch, circuitBreaker),
+		withdrawGuard:       newTransferGuard(config, pauseSwitch, circuitBreaker),
+		blocklist:           newAddressBlocklist(config.BlockedAddressesFile, bridgeContract.GetContractAdress()),
+		approver:            config.Approver,
+		authorizer:          authorizer,
+		watchdog:            watchdog,
+		requireKind:         config.RequireSignedRequests,
+	}
+
+	watchdog.setGuards(signerService.mintGuard, signerService.withdrawGuard)
+
+	// Masters that are not upgraded yet still use the unsigned protocol
+	if !config.RequireSignedRequests {
+		server := gorpc.NewServer(host, Protocol, gorpc.WithAuthorizeFunc(authorizer.authorize))
+		if err = server.Register(signerService); err != nil {
+			return err
+		}
 	}
+	serverV2 := gorpc.NewServer(host, ProtocolV2, gorpc.WithAuthorizeFunc(authorizer.authorize))
+	return serverV2.RegisterName("SignerService", &SignerServiceV2{
+		service:  signerService,
+		verifier: newRequestVerifier(masters),
+	})
+}
 
-	return server.Register(&signerService)
+// Status returns the status of the cosigner
+// This is callable by the read-only peers.
+func (s *SignerService) Status(ctx context.Context, request StatusRequest, response *StatusResponse) error {
+	response.Address = s.stellarWallet.GetAddress()
+	response.Paused = s.pauseSwitch.Check() != nil
+	response.RejectedCalls = s.authorizer.rejected.Load()
+	response.WatchdogAlerts = s.watchdog.Alerts()
+	return nil
 }
 
 func (s *SignerService) SignMint(ctx context.Context, request EthSignRequest, response *EthSignResponse) error {
 	log.Info("sign mint request", "request txid", request.TxId)
+	s.watchdog.ObserveMint(request)
+
+	if withdrawalTxHash, ok := parseWithdrawalReturnTxID(request.TxId); ok {
+		if err := s.validateWithdrawalReturn(request, withdrawalTxHash); err != nil {
+			log.Warn("Refusing to sign the return of a withdrawal", "txid", request.TxId, "err", err)
+			return err
+		}
+		return s.signMint(request, response)
+	}
 
 	// Check in transaction storage if the deposit transaction exists
 	tx, err := s.stellarWallet.TransactionStorage.GetTransactionWithId(request.TxId)
@@ -90,10 +162,14 @@ func (s *SignerService) SignMint(ctx context.Context, request EthSignRequest, re
 	}
 
 	// Validate amount
-	depositedAmount, _, err := s.stellarWallet.GetDepositAmountAndSender(request.TxId, s.bridgeMasterAddress)
+	deposit, err := s.stellarWallet.GetDepositDetails(*tx, s.bridgeMasterAddress)
 	if err != nil {
 		return err
 	}
+	if deposit, err = s.stellarWallet.ClaimedDeposit(deposit); err != nil {
+		return err
+	}
+	depositedAmount := deposit.TotalTFT()
 	log.Debug("validating amount for sign tx", "amount", depositedAmount, "request amount", request.Amount)
 
 	depositFeeBigInt := big.NewInt(stellar.IntToStroops(s.depositFee))
@@ -107,7 +183,7 @@ func (s *SignerService) SignMint(ctx context.Context, request EthSignRequest, re
 
 	log.Debug("tx memo", "memoType", tx.MemoType, "memo", tx.Memo)
 	// Validate address
-	addr, err := eth.GetErc20AddressFromB64(tx.Memo)
+	addr, err := s.stellarWallet.GetDepositReceiver(*tx, s.bridgeMasterAddress)
 	if err != nil {
 		return err
 	}
@@ -116,6 +192,35 @@ func (s *SignerService) SignMint(ctx context.Context, request EthSignRequest, re
 		return fmt.Errorf("deposit addresses do not match")
 	}
 
+	if err = s.blocklist.Check(request.Receiver); err != nil {
+		log.Warn("Refusing to sign a mint to a blocked address", "txid", request.TxId, "receiver", request.Receiver)
+		return err
+	}
+
+	// A refunded deposit can not be minted
+	refunded, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(request.TxId)
+	if err != nil {
+		return err
+	}
+	if refunded {
+		return fmt.Errorf("the deposit is refunded or minted already")
+	}
+
+	err = s.mintGuard.check(approvals.Transfer{
+		Kind:        approvals.KindMint,
+		ID:          request.TxId,
+		Destination: request.Receiver.Hex(),
+		Amount:      request.Amount,
+	}, request.Approval)
+	if err != nil {
+		log.Warn("Refusing to sign the mint", "txid", request.TxId, "err", err)
+		return err
+	}
+
+	return s.signMint(request, response)
+}
+
+func (s *SignerService) signMint(request EthSignRequest, response *EthSignResponse) error {
 	signature, err := s.bridgeContract.CreateTokenSignature(request.Receiver, request.Amount, request.TxId)
 	if err != nil {
 		return err
@@ -129,6 +234,7 @@ func (s *SignerService) SignMint(ctx context.Context, request EthSignRequest, re
 
 // Sign signs a stellar sign request
 // This is calable on the libp2p network with RPC
+// A signer rotation is signed while the bridge is paused so compromised signers can be replaced.
 func (s *SignerService) Sign(ctx context.Context, request multisig.StellarSignRequest, response *multisig.StellarSignResponse) error {
 	loaded, err := txnbuild.TransactionFromXDR(request.TxnXDR)
 	if err != nil {
@@ -140,43 +246,36 @@ func (s *SignerService) Sign(ctx context.Context, request multisig.StellarSignRe
 		return fmt.Errorf("provided transaction is of wrong type")
 	}
 
-	if request.Block != 0 {
-		log.Info("Validating withdrawal signing request")
-		err := s.validateWithdrawal(request, txn)
-		if err != nil {
-			if errors.Is(err, ErrInvalidTransaction) {
-				log.Warn("Withdrawal validation error", "err", err)
-				return err
-			}
-			log.Error("An error occurred while validating a withdrawal signing request", "err", err)
-			return errors.New("Error") //Internal errors should not be exposed externally
+	if request.Kind == "" {
+		if s.requireKind {
+			log.Warn("Refusing to sign a request without a kind")
+			return errors.Wrap(ErrInvalidTransaction, "the kind of the request is not set")
 		}
-	} else if request.Message != "" {
-		// If the signrequest has a message attached we know it's a refund transaction
-		log.Info("Validating refund signing request", "deposit", request.Message)
-		err := s.validateRefundTransaction(request, txn)
-		if err != nil {
-			if errors.Is(err, ErrInvalidTransaction) {
-				log.Warn("Refund validation error", "err", err)
-				return err
-			}
-			log.Error("An error occurred while validating a refund signing request", "err", err)
-			return errors.New("Error") //Internal errors should not be exposed externally
-		}
-	} else {
-		// If the signrequest is not a withdrawal request and a refund request
-		// then it's most likely a transfer to fee wallet transaction from a deposit
-		log.Info("Validating fee transfer signing request")
-		err := s.validateDepositFeeTransfer(request, txn)
-		if err != nil {
-			if errors.Is(err, ErrInvalidTransaction) {
-				log.Info("Fee transfer validation error", "err", err)
-				return err
-			}
-			log.Error("An error occurred while validating a deposit fee transfer signing request", "err", err)
-			return errors.New("Error") //Internal errors should not be exposed externally
+		if request, err = legacySignRequest(request, txn, s.stellarWallet.Config.StellarFeeWallet); err != nil {
+			log.Warn("Refusing to sign", "err", err)
+			return err
 		}
 	}
+	s.watchdog.ObserveStellarRequest(request)
+	if err := s.pauseSwitch.Check(); err != nil && request.Kind != multisig.KindSignerRotation {
+		log.Warn("Refusing to sign, the bridge is paused")
+		return err
+	}
+
+	validate, err := s.validator(request.Kind)
+	if err != nil {
+		log.Warn("Refusing to sign", "err", err)
+		return err
+	}
+	log.Info("Validating signing request", "kind", request.Kind)
+	if err = validate(request, txn); err != nil {
+		if errors.Is(err, ErrInvalidTransaction) || errors.Is(err, ErrTransferRefused) {
+			log.Warn("Signing request validation error", "kind", request.Kind, "err", err)
+			return err
+		}
+		log.Error("An error occurred while validating a signing request", "kind", request.Kind, "err", err)
+		return errors.New("Error") //Internal errors should not be exposed externally
+	}
 
 	log.Info("Signing valid signing request")
 	txn, err = s.stellarWallet.Sign(txn)
@@ -195,28 +294,156 @@ func (s *SignerService) Sign(ctx context.Context, request multisig.StellarSignRe
 	return nil
 }
 
-func (s *SignerService) validateWithdrawal(request multisig.StellarSignRequest, txn *txnbuild.Transaction) error {
-	withdraw, err := s.bridgeContract.tftContract.filter.FilterWithdraw(&bind.FilterOpts{Start: request.Block}, []common.Address{request.Receiver})
+// validateSignerRotation checks that a signer rotation is approved by the operator
+// and that the transaction only replaces the cosigners and thresholds of the vault account
+func (s *SignerService) validateSignerRotation(request multisig.StellarSignRequest, txn *txnbuild.Transaction) error {
+	if request.SignerRotation == nil {
+		return errors.Wrap(ErrInvalidTransaction, "the request has no signer rotation")
+	}
+	rotation := *request.SignerRotation
+	if err := rotation.Validate(); err != nil {
+		return errors.Wrap(ErrInvalidTransaction, err.Error())
+	}
+	hash := rotation.Hash()
+	if s.approver == "" || approvals.Verify(s.approver, approvals.SignerRotation(hash), request.Approval) != nil {
+		return ErrInvalidApproval
+	}
+
+	if txn.SourceAccount().AccountID != s.bridgeMasterAddress {
+		return errors.Wrap(ErrInvalidTransaction, "the transaction is not for the vault account")
+	}
+	memo, ok := txn.Memo().(txnbuild.MemoHash)
+	if !ok || memo != hash {
+		return errors.Wrap(ErrInvalidTransaction, "the memo does not match the signer rotation")
+	}
+	// The memo makes sure an old approval is not replayed to go back to an earlier signer set
+	executed, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(hex.EncodeToString(hash[:]))
 	if err != nil {
 		return err
 	}
+	if executed {
+		return errors.Wrap(ErrInvalidTransaction, stellar.ErrSignerRotationExecuted.Error())
+	}
 
-	if !withdraw.Next() {
-		return fmt.Errorf("no withdraw event found")
+	vault, err := s.stellarWallet.GetAccountDetails(s.bridgeMasterAddress)
+	if err != nil {
+		return err
+	}
+	expected := stellar.SignerRotationOperations(vault, rotation)
+	operations := txn.Operations()
+	if len(operations) != len(expected) {
+		return errors.Wrap(ErrInvalidTransaction, "the operations do not match the signer rotation")
 	}
-	ethereumTransactionHash, _ := strings.CutPrefix(withdraw.Event.Raw.TxHash.Hex(), "0x")
+	for i, op := range operations {
+		opXDR, err := op.BuildXDR()
+		if err != nil {
+			return errors.Wrap(ErrInvalidTransaction, "failed to build operation xdr")
+		}
+		expectedXDR, err := expected[i].BuildXDR()
+		if err != nil {
+			return err
+		}
+		encoded, err := xdr.MarshalBase64(opXDR)
+		if err != nil {
+			return err
+		}
+		expectedEncoded, err := xdr.MarshalBase64(expectedXDR)
+		if err != nil {
+			return err
+		}
+		if encoded != expectedEncoded {
+			return errors.Wrap(ErrInvalidTransaction, "the operations do not match the signer rotation")
+		}
+	}
+	log.Info("Signing approved signer rotation", "signers", rotation.StellarSigners, "threshold", rotation.StellarThreshold)
+	return nil
+}
+
+// validateWithdrawalReturn checks that a withdrawal can not be paid out or is rejected by the operator
+// and that the request returns it to the receiver
+func (s *SignerService) validateWithdrawalReturn(request EthSignRequest, withdrawalTxHash common.Hash) error {
+	withdrawal, err := s.bridgeContract.GetWithdrawEvent(withdrawalTxHash)
+	if err != nil {
+		return err
+	}
+	if withdrawal.receiver != request.Receiver {
+		return fmt.Errorf("the receiver of the withdrawal does not match")
+	}
+
+	withdrawFee, err := s.bridgeContract.GetWithdrawFee(new(big.Int).SetUint64(withdrawal.blockHeight))
+	if err != nil {
+		return errors.Wrap(err, "failed to get the withdraw fee")
+	}
+	if withdrawal.amount.Int64()-withdrawFee != request.Amount {
+		return fmt.Errorf("amounts do not match")
+	}
+
+	paidOut, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(hex.EncodeToString(withdrawalTxHash[:]))
+	if err != nil {
+		return err
+	}
+	if paidOut {
+		return fmt.Errorf("the withdrawal is paid out already")
+	}
+	payable, err := s.stellarWallet.IsPayable(withdrawal.blockchain_address)
+	if err != nil {
+		return err
+	}
+	// A withdrawal that can be paid out is only returned if the operator rejected it
+	if payable {
+		if s.approver == "" {
+			return fmt.Errorf("the withdrawal can be paid out")
+		}
+		err = approvals.VerifyRejection(s.approver, approvals.Transfer{
+			Kind:        approvals.KindWithdraw,
+			ID:          hex.EncodeToString(withdrawalTxHash[:]),
+			Destination: withdrawal.blockchain_address,
+			Amount:      withdrawal.amount.Int64(),
+		}, request.Approval)
+		if err != nil {
+			return fmt.Errorf("the withdrawal can be paid out and is not rejected by the operator: %w", err)
+		}
+	}
+
+	return s.mintGuard.checkPaused()
+}
 
-	amount := withdraw.Event.Tokens.Int64()
-	log.Info("validating withdrawal", "amount", stellar.StroopsToDecimal(amount), "receiver", withdraw.Event.BlockchainAddress, "tx", ethereumTransactionHash)
-	memo, err := stellar.ExtractMemoFromTx(txn)
+// validateWithdrawal checks that the transaction pays out the Withdraw event request.LogIndex
+// in the EVM transaction request.EthTxHash.
+// Requests of masters that do not set the kind only reference the EVM transaction through the memo,
+// it then needs to contain exactly 1 Withdraw event.
+func (s *SignerService) validateWithdrawal(request multisig.StellarSignRequest, txn *txnbuild.Transaction) error {
+	ethTxHash := request.EthTxHash
+	if ethTxHash == (common.Hash{}) {
+		memo, err := stellar.ExtractMemoFromTx(txn)
+		if err != nil || memo == "" {
+			return errors.Wrap(ErrInvalidTransaction, "Unable to extract the memo from the supplied transaction")
+		}
+		ethTxHash = common.HexToHash(memo)
+	}
+	memo := hex.EncodeToString(ethTxHash[:])
+	if err := checkMemo(txn, memo); err != nil {
+		return err
+	}
+
+	events, err := s.bridgeContract.GetWithdrawEvents(ethTxHash)
 	if err != nil {
-		log.Warn("Unable to extract the memo from the supplied transaction", "err", err)
-		return errors.Wrap(ErrInvalidTransaction, "Unable to extract the memo from the supplied transaction")
+		return err
 	}
-	if memo != ethereumTransactionHash {
-		log.Warn("The supplied memo and the ethereum transaction do not match", "memo", memo, "tx", ethereumTransactionHash)
-		return errors.Wrap(ErrInvalidTransaction, "The supplied memo and the ethereum transaction do not match")
+	withdrawal, err := findWithdrawEvent(events, request)
+	if err != nil {
+		return err
 	}
+	confirmed, err := s.bridgeContract.IsConfirmed(withdrawal.blockHeight, EthBlockDelay)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return errors.Wrap(ErrInvalidTransaction, "the withdraw event is not confirmed yet")
+	}
+
+	amount := withdrawal.amount.Int64()
+	log.Info("validating withdrawal", "amount", stellar.StroopsToDecimal(amount), "receiver", withdrawal.blockchain_address, "tx", memo, "logIndex", withdrawal.logIndex)
 	withdrawalAlreadyExecuted, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(memo)
 	if err != nil {
 		return err
@@ -224,10 +451,46 @@ func (s *SignerService) validateWithdrawal(request multisig.StellarSignRequest,
 	if withdrawalAlreadyExecuted {
 		return errors.Wrap(ErrInvalidTransaction, "Withdrawal already executed")
 	}
+	returned, err := s.bridgeContract.IsMintTxID(WithdrawalReturnTxID(ethTxHash))
+	if err != nil {
+		return err
+	}
+	if returned {
+		return errors.Wrap(ErrInvalidTransaction, "Withdrawal already returned")
+	}
+
+	withdrawFee, err := s.bridgeContract.GetWithdrawFee(new(big.Int).SetUint64(withdrawal.blockHeight))
+	if err != nil {
+		return errors.Wrap(err, "failed to get the withdraw fee")
+	}
+
+	destination, _, err := stellar.ParseWithdrawalDestination(withdrawal.blockchain_address)
+	if err != nil {
+		return errors.Wrap(ErrInvalidTransaction, "the withdrawal has an invalid destination")
+	}
 
-	amount -= WithdrawFee
-	if len(txn.Operations()) != 2 {
-		return errors.Wrap(ErrInvalidTransaction, "a withdraw tx needs to contain 2 payment operations")
+	if err = checkWithdrawalPayments(txn, destination, amount-withdrawFee, withdrawFee, s.stellarWallet.Config.StellarFeeWallet); err != nil {
+		return err
+	}
+
+	return s.withdrawGuard.check(approvals.Transfer{
+		Kind:        approvals.KindWithdraw,
+		ID:          memo,
+		Destination: withdrawal.blockchain_address,
+		Amount:      withdrawal.amount.Int64(),
+	}, request.Approval)
+}
+
+// checkWithdrawalPayments checks that a withdraw transaction pays amount to the destination and the withdraw fee to the fee wallet
+// Without a fee or a fee wallet, the transaction only contains the payment to the destination.
+func checkWithdrawalPayments(txn *txnbuild.Transaction, destination string, amount int64, withdrawFee int64, feeWallet string) error {
+	feeExpected := withdrawFee > 0 && feeWallet != ""
+	operations := 1
+	if feeExpected {
+		operations = 2
+	}
+	if len(txn.Operations()) != operations {
+		return errors.Wrapf(ErrInvalidTransaction, "a withdraw tx needs to contain %d payment operations", operations)
 	}
 	feePaymentPresent := false
 	for _, op := range txn.Operations() {
@@ -236,51 +499,65 @@ func (s *SignerService) validateWithdrawal(request multisig.StellarSignRequest,
 			return errors.Wrap(ErrInvalidTransaction, "failed to build operation xdr")
 		}
 
-		if opXDR.Body.Type != xdr.OperationTypePayment {
-			continue
-		}
-
 		paymentOperation, ok := opXDR.Body.GetPaymentOp()
 		if !ok {
 			return errors.Wrap(ErrInvalidTransaction, "transaction contains non payment operations")
 		}
 
-		acc := paymentOperation.Destination.ToAccountId()
+		// A muxed destination is compared with its muxed address
+		paymentDestination := paymentOperation.Destination.Address()
 
-		if acc.Address() == s.stellarWallet.Config.StellarFeeWallet {
-			if int64(paymentOperation.Amount) != WithdrawFee {
+		if feeExpected && paymentDestination == feeWallet && !feePaymentPresent {
+			if int64(paymentOperation.Amount) != withdrawFee {
 				return errors.Wrap(ErrInvalidTransaction, "the withdraw fee is incorrect")
 			}
 			feePaymentPresent = true
 			continue
 		}
 
-		if acc.Address() != withdraw.Event.BlockchainAddress {
-			return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, need %s", acc.Address(), withdraw.Event.BlockchainAddress)
+		if paymentDestination != destination {
+			return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, need %s", paymentDestination, destination)
 		}
 
 		if int64(paymentOperation.Amount) != amount {
-			return fmt.Errorf("amount is not correct, received %d, need %d", paymentOperation.Amount, xdr.Int64(withdraw.Event.Tokens.Int64()))
+			return fmt.Errorf("amount is not correct, received %d, need %d", paymentOperation.Amount, xdr.Int64(amount))
 		}
 	}
-	if !feePaymentPresent {
+	if feeExpected && !feePaymentPresent {
 		return errors.Wrap(ErrInvalidTransaction, "No withdraw fee payment")
 	}
-
 	return nil
 }
 
+// findWithdrawEvent returns the withdraw event a withdrawal request references
+// A request without an EVM transaction hash references the only withdraw event of the transaction.
+func findWithdrawEvent(events []WithdrawEvent, request multisig.StellarSignRequest) (WithdrawEvent, error) {
+	var matches []WithdrawEvent
+	for _, event := range events {
+		if request.EthTxHash == (common.Hash{}) || event.logIndex == request.LogIndex {
+			matches = append(matches, event)
+		}
+	}
+	if len(matches) != 1 {
+		return WithdrawEvent{}, errors.Wrapf(ErrInvalidTransaction, "found %d matching withdraw events in the EVM transaction, need exactly 1", len(matches))
+	}
+	withdrawal := matches[0]
+	if withdrawal.receiver != request.Receiver {
+		return WithdrawEvent{}, errors.Wrap(ErrInvalidTransaction, "the receiver of the withdraw event does not match")
+	}
+	if withdrawal.network != BridgeNetwork {
+		return WithdrawEvent{}, errors.Wrapf(ErrInvalidTransaction, "the withdraw event is for network %s", withdrawal.network)
+	}
+	return withdrawal, nil
+}
+
 func (s *SignerService) validateRefundTransaction(request multisig.StellarSignRequest, txn *txnbuild.Transaction) error {
 
 	// check if a refund already happened
-	memo, err := stellar.ExtractMemoFromTx(txn)
-	if err != nil {
-		log.Warn("Failed to extract memo", "err", err)
-		return ErrInvalidTransaction
-	}
-	if memo != request.Message {
-		return errors.Wrap(ErrInvalidTransaction, "The transaction memo and the signrequest message do not match")
+	if err := checkMemo(txn, request.DepositTxHash); err != nil {
+		return err
 	}
+	memo := request.DepositTxHash
 	alreadyRefunded, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(memo)
 	if err != nil {
 		return err
@@ -289,88 +566,137 @@ func (s *SignerService) validateRefundTransaction(request multisig.StellarSignRe
 		return ErrAlreadyRefunded
 	}
 
-	var destinationAccount string
-	var refundAmountWithoutPenalty int64
-	var penaltyPayment bool
-	// There are 2 payment operations, 1 to the feewallet and 1 to the account that made the deposit
-	if len(txn.Operations()) > 2 {
-		return errors.Wrap(ErrInvalidTransaction, "The refund transaction has too many operations")
+	// The master can deduct a lower penalty, like for deposits made while it was paused,
+	// but not more than the refund penalty of this cosigner
+	maxPenalty, err := s.stellarWallet.RefundPenalty(memo)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the refund penalty")
+	}
+	if request.Penalty > maxPenalty {
+		return errors.Wrapf(ErrInvalidFeePayment, "the penalty of %d TFT stroops is higher than the refund penalty of %d TFT stroops", request.Penalty, maxPenalty)
+	}
+	if request.Penalty != 0 && request.Penalty != maxPenalty {
+		log.Info("The refund penalty of the master differs", "deposit", memo, "penalty", request.Penalty, "ours", maxPenalty)
 	}
-	for _, op := range txn.Operations() {
-		opXDR, err := op.BuildXDR()
-		if err != nil {
-			return fmt.Errorf("failed to build operation xdr")
-		}
 
-		if opXDR.Body.Type != xdr.OperationTypePayment {
-			continue
-		}
+	depositTx, err := s.stellarWallet.TransactionStorage.GetTransactionWithId(memo)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the deposit a refund is requested for")
+	}
+	deposit, err := s.stellarWallet.GetDepositDetails(*depositTx, s.bridgeMasterAddress)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve the deposit a refund is requested for")
+	}
+	if deposit, err = s.stellarWallet.ClaimedDeposit(deposit); err != nil {
+		return errors.Wrap(ErrInvalidTransaction, err.Error())
+	}
 
-		paymentOperation, ok := opXDR.Body.GetPaymentOp()
+	tftAsset := s.stellarWallet.GetTFTAsset()
+	// The refunded amounts per asset, there is 1 payment operation to the feewallet
+	// and 1 payment operation per asset to the account that made the deposit
+	refunded := make(map[string]int64)
+	var penaltyPayment bool
+	var penalty int64
+	for _, op := range txn.Operations() {
+		payment, ok := op.(*txnbuild.Payment)
 		if !ok {
-			return fmt.Errorf("failed to get payment operation")
+			return errors.Wrap(ErrInvalidTransaction, "The refund transaction contains non payment operations")
+		}
+		asset, err := payment.Asset.ToXDR()
+		if err != nil {
+			return errors.Wrap(ErrInvalidTransaction, "invalid asset")
+		}
+		// "native" or CODE:ISSUER like the assets of the deposit
+		assetString := asset.StringCanonical()
+		paymentAmount, err := amount.ParseInt64(payment.Amount)
+		if err != nil {
+			return errors.Wrap(ErrInvalidTransaction, "invalid amount")
 		}
 
-		operationDestinationAccount := paymentOperation.Destination.Address()
-
-		if operationDestinationAccount == s.stellarWallet.Config.StellarFeeWallet {
+		if payment.Destination == s.stellarWallet.Config.StellarFeeWallet {
 			if penaltyPayment {
 				return errors.Wrap(ErrInvalidTransaction, "Multiple payments to the feewallet")
 			}
 			penaltyPayment = true
-			if paymentOperation.Amount != xdr.Int64(WithdrawFee) {
-				return errors.Wrapf(ErrInvalidFeePayment, "fee amount should be %d, but got %d", WithdrawFee, paymentOperation.Amount)
+			// Masters that do not set the penalty in the request yet can pay any penalty up to the refund penalty
+			if assetString != tftAsset || paymentAmount > maxPenalty || (request.Penalty != 0 && paymentAmount != request.Penalty) {
+				return errors.Wrapf(ErrInvalidFeePayment, "penalty should be %d TFT stroops, at most %d, but got %d %s", request.Penalty, maxPenalty, paymentAmount, assetString)
 			}
+			penalty = paymentAmount
 			continue
 		}
-		destinationAccount = operationDestinationAccount
-		refundAmountWithoutPenalty = int64(paymentOperation.Amount)
+		// Check if the deposit was sent from the account that we are trying to credit
+		if payment.Destination != deposit.Sender {
+			return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, original account debited is %s", payment.Destination, deposit.Sender)
+		}
+		if _, ok := refunded[assetString]; ok {
+			return errors.Wrapf(ErrInvalidTransaction, "Multiple refunds of %s", assetString)
+		}
+		refunded[assetString] = paymentAmount
 	}
 
-	//TODO: this does an horizon call, is this necessary? The transactions are also present in the Transactionstorage
-	txnEffectsFromMessage, err := s.stellarWallet.GetTransactionEffects(memo)
-	if err != nil {
-		return errors.Wrap(err, "failed to retrieve transaction effects of the transaction a refund is requested for")
+	if request.Penalty > 0 && !penaltyPayment {
+		return errors.Wrap(ErrInvalidFeePayment, "the penalty is not paid to the feewallet")
 	}
 
-	// Check if the deposit was sent from the account that we are trying to credit
-	//  and if the refund amount is correct
-	var depositedAmount decimal.Decimal
-	for _, effect := range txnEffectsFromMessage.Embedded.Records {
-		if effect.GetType() == effects.EffectTypeNames[effects.EffectAccountDebited] {
-			if effect.GetAccount() != destinationAccount {
-				return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, original account debited is %s", destinationAccount, effect.GetAccount())
-			}
+	// Check if the refunded amounts are correct
+	if refundedTFT, ok := refunded[tftAsset]; ok {
+		minted, err := s.bridgeContract.IsMintTxID(memo)
+		if err != nil {
+			return err
 		}
-		if effect.GetType() == effects.EffectTypeNames[effects.EffectAccountCredited] {
-			if effect.GetAccount() == s.bridgeMasterAddress {
-				bridgeDepositEffect, ok := effect.(effects.AccountCredited)
-				if !ok {
-					return errors.New("Unable to convert an AccountCredited effect to its real type")
-				}
-				depositedAmount, err = decimal.NewFromString(bridgeDepositEffect.Amount)
-				if err != nil {
-					return err
-				}
-			}
+		if minted {
+			return errors.Wrap(ErrInvalidTransaction, "The TFT of the deposit are minted")
 		}
-
-		if stellar.DecimalToStroops(depositedAmount) != (refundAmountWithoutPenalty + WithdrawFee) {
+		if deposit.TotalTFT() != refundedTFT+penalty {
 			return errors.Wrap(ErrInvalidTransaction, "The refunded amount does not match the deposit")
 		}
+		delete(refunded, tftAsset)
+	} else if penaltyPayment {
+		return errors.Wrap(ErrInvalidTransaction, "A penalty is only paid when refunding TFT")
 	}
+	return checkRefundedAssets(refunded, deposit.OtherAssets)
+}
 
+// validateClaimTransaction checks if a transaction only claims a TFT claimable balance for the vault account
+func (s *SignerService) validateClaimTransaction(txn *txnbuild.Transaction) error {
+	if len(txn.Operations()) != 1 {
+		return errors.Wrap(ErrInvalidTransaction, "A claim transaction should have exactly 1 operation")
+	}
+	claim, ok := txn.Operations()[0].(*txnbuild.ClaimClaimableBalance)
+	if !ok {
+		return errors.Wrap(ErrInvalidTransaction, "transaction contains non claim operations")
+	}
+	if claim.SourceAccount != "" && claim.SourceAccount != s.bridgeMasterAddress {
+		return errors.Wrap(ErrInvalidTransaction, "the claim is not for the vault account")
+	}
+	claimable, err := s.stellarWallet.IsClaimableDeposit(claim.BalanceID, s.bridgeMasterAddress)
+	if err != nil {
+		return err
+	}
+	if !claimable {
+		return errors.Wrapf(ErrInvalidTransaction, "%s is not a TFT claimable balance for the vault account", claim.BalanceID)
+	}
 	return nil
 }
 
+// isClaimTransaction checks if the transaction claims a claimable balance
+func isClaimTransaction(txn *txnbuild.Transaction) bool {
+	for _, op := range txn.Operations() {
+		if _, ok := op.(*txnbuild.ClaimClaimableBalance); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *SignerService) validateDepositFeeTransfer(request multisig.StellarSignRequest, txn *txnbuild.Transaction) (err error) {
 
 	// Check if a fee transfer for this already happened
-	memo, err := stellar.ExtractMemoFromTx(txn)
-	if err != nil {
-		log.Warn("Failed to extract memo", "err", err)
-		return ErrInvalidTransaction
+	if err = checkMemo(txn, request.DepositTxHash); err != nil {
+		return
 	}
+	memo := request.DepositTxHash
 	alreadyExists, err := s.stellarWallet.TransactionStorage.TransactionWithMemoExists(memo)
 	if err != nil {
 		return
@@ -379,42 +705,77 @@ func (s *SignerService) validateDepositFeeTransfer(request multisig.StellarSignR
 		return ErrTransactionAlreadyExists
 	}
 
-	//A Fee transfer only has 1 operation
-	if len(txn.Operations()) != 1 {
-		return errors.Wrap(ErrInvalidTransaction, "The transaction should have exactly 1 operation")
+	//Validate the deposit transaction that triggered this deposit fee transfer
+	depositTx, err := s.stellarWallet.TransactionStorage.GetTransactionWithId(memo)
+	if err != nil {
+		return
 	}
-
-	op := txn.Operations()[0]
-	opXDR, err := op.BuildXDR()
+	deposit, err := s.stellarWallet.GetDepositDetails(*depositTx, s.bridgeMasterAddress)
 	if err != nil {
-		return errors.Wrap(ErrInvalidTransaction, "failed to build operation xdr")
+		return
 	}
-
-	if opXDR.Body.Type != xdr.OperationTypePayment {
-		return errors.Wrap(ErrInvalidTransaction, "transaction contains non payment operations")
+	if deposit.TotalTFT() <= s.depositFee {
+		return errors.Wrap(ErrInvalidFeePayment, "The amount of the deposit is smaller than the deposit fee")
 	}
 
-	paymentOperation, ok := opXDR.Body.GetPaymentOp()
-	if !ok {
-		return errors.Wrap(ErrInvalidTransaction, "transaction contains non payment operations")
-	}
+	// There is 1 payment operation to the feewallet and the other assets of the deposit can be refunded
+	// in the same transaction with 1 payment operation per asset to the account that made the deposit
+	tftAsset := s.stellarWallet.GetTFTAsset()
+	refunded := make(map[string]int64)
+	var feePayment bool
+	for _, op := range txn.Operations() {
+		payment, ok := op.(*txnbuild.Payment)
+		if !ok {
+			return errors.Wrap(ErrInvalidTransaction, "transaction contains non payment operations")
+		}
+		asset, err := payment.Asset.ToXDR()
+		if err != nil {
+			return errors.Wrap(ErrInvalidTransaction, "invalid asset")
+		}
+		assetString := asset.StringCanonical()
+		paymentAmount, err := amount.ParseInt64(payment.Amount)
+		if err != nil {
+			return errors.Wrap(ErrInvalidTransaction, "invalid amount")
+		}
 
-	acc := paymentOperation.Destination.ToAccountId()
-	//TODO: should this be fetched through the wallet?
-	if acc.Address() != s.stellarWallet.Config.StellarFeeWallet {
-		return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, need fee wallet %s", acc.Address(), s.stellarWallet.Config.StellarFeeWallet)
+		if payment.Destination == s.stellarWallet.Config.StellarFeeWallet {
+			if feePayment {
+				return errors.Wrap(ErrInvalidTransaction, "Multiple payments to the feewallet")
+			}
+			feePayment = true
+			if assetString != tftAsset || paymentAmount != stellar.IntToStroops(s.depositFee) {
+				return errors.Wrapf(ErrInvalidTransaction, "amount is not correct, received %d %s, need %d TFT", paymentAmount, assetString, s.depositFee)
+			}
+			continue
+		}
+		if payment.Destination != deposit.Sender {
+			return errors.Wrapf(ErrInvalidTransaction, "destination is not correct, got %s, need fee wallet %s or the sender of the deposit %s", payment.Destination, s.stellarWallet.Config.StellarFeeWallet, deposit.Sender)
+		}
+		if _, ok := refunded[assetString]; ok {
+			return errors.Wrapf(ErrInvalidTransaction, "Multiple refunds of %s", assetString)
+		}
+		refunded[assetString] = paymentAmount
 	}
-
-	if int64(paymentOperation.Amount) != stellar.IntToStroops(s.depositFee) {
-		return errors.Wrapf(ErrInvalidTransaction, "amount is not correct, received %d, need %d", stellar.StroopsToDecimal(int64(paymentOperation.Amount)), s.depositFee)
+	if !feePayment {
+		return errors.Wrap(ErrInvalidTransaction, "there is no payment to the fee wallet")
 	}
-	//Validate the deposit transaction that triggered this deposit fee transfer
-	depositedAmount, _, err := s.stellarWallet.GetDepositAmountAndSender(memo, s.bridgeMasterAddress)
-	if err != nil {
-		return
+	// The other assets are not refunded if the sender can not receive them
+	if len(refunded) == 0 {
+		return nil
 	}
-	if depositedAmount <= s.depositFee {
-		return errors.Wrap(ErrInvalidFeePayment, "The amount of the deposit is smaller than the deposit fee")
+	return checkRefundedAssets(refunded, deposit.OtherAssets)
+}
+
+// checkRefundedAssets checks if the refunded amounts per asset are exactly the other assets of a deposit
+func checkRefundedAssets(refunded map[string]int64, otherAssets []stellar.AssetAmount) error {
+	for _, other := range otherAssets {
+		if refunded[other.Asset] != other.Amount {
+			return errors.Wrapf(ErrInvalidTransaction, "The refunded amount of %s does not match the deposit", other.Asset)
+		}
+		delete(refunded, other.Asset)
+	}
+	if len(refunded) > 0 {
+		return errors.Wrap(ErrInvalidTransaction, "The refund contains assets that are not in the deposit")
 	}
-	return
+	return nil
 }
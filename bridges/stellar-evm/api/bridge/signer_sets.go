@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// signersReloadInterval is the interval at which the signers of the vault account and the token contract are reloaded
+	signersReloadInterval = 5 * time.Minute
+)
+
+// monitorSigners periodically reloads the signers so a signer rotation is picked up without a restart
+// This call blocks until the context is cancelled.
+func (bridge *Bridge) monitorSigners(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(signersReloadInterval):
+		}
+		if err := bridge.reloadSigners(); err != nil {
+			log.Error("Failed to reload the signers", "err", err)
+		}
+	}
+}
+
+// reloadSigners updates the cosigners and the required signature count from the vault account
+// and logs the differences with the signers of the token contract.
+// The signers of the token contract are read for every mint.
+func (bridge *Bridge) reloadSigners() error {
+	bridge.signersMut.Lock()
+	defer bridge.signersMut.Unlock()
+	requirements, err := bridge.wallet.GetSigningRequirements()
+	if err != nil {
+		return err
+	}
+	ethSigners, err := bridge.bridgeContract.GetSigners()
+	if err != nil {
+		return err
+	}
+	ethRequired, err := bridge.bridgeContract.GetRequiresSignatureCount()
+	if err != nil {
+		return err
+	}
+	if err = bridge.wallet.SetSigners(requirements); err != nil {
+		return err
+	}
+
+	sort.Slice(requirements.Cosigners, func(i, j int) bool { return requirements.Cosigners[i].Address < requirements.Cosigners[j].Address })
+	signerSets := fmt.Sprint(requirements, ethSigners, ethRequired)
+	if signerSets != bridge.signerSets {
+		log.Info("Loaded the signers", "cosigners", requirements.Cosigners, "threshold", requirements.Threshold, "masterWeight", requirements.MasterWeight, "ethSigners", ethSigners, "ethSignatures", ethRequired)
+		bridge.signerSets = signerSets
+	}
+
+	// With weighted signers the number of required signatures can not be compared
+	stellarRequired := requirements.Threshold
+	if requirements.Weighted() {
+		stellarRequired = -1
+	}
+	for _, discrepancy := range signerDiscrepancies(len(requirements.Cosigners)+1, stellarRequired, ethSigners, ethRequired.Int64(), bridge.GetClient().address) {
+		log.Error("The signers of the vault account and the token contract differ", "discrepancy", discrepancy)
+	}
+	return nil
+}
+
+// signerDiscrepancies compares the signers of the vault account, including the master, with the signers of the token contract
+// A negative stellarRequired skips the comparison of the required signatures.
+func signerDiscrepancies(stellarSigners int, stellarRequired int, ethSigners []common.Address, ethRequired int64, master common.Address) (discrepancies []string) {
+	if stellarSigners != len(ethSigners) {
+		discrepancies = append(discrepancies, fmt.Sprintf("the vault account has %d signers, the token contract %d", stellarSigners, len(ethSigners)))
+	}
+	if stellarRequired >= 0 && int64(stellarRequired) != ethRequired {
+		discrepancies = append(discrepancies, fmt.Sprintf("the vault account requires %d signatures, the token contract %d", stellarRequired, ethRequired))
+	}
+	masterIsSigner := false
+	for _, signer := range ethSigners {
+		if signer == master {
+			masterIsSigner = true
+		}
+	}
+	if !masterIsSigner {
+		discrepancies = append(discrepancies, fmt.Sprintf("the master %s is not a signer of the token contract", master.Hex()))
+	}
+	return
+}
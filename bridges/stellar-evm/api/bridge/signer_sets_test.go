@@ -0,0 +1,17 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignerDiscrepancies(t *testing.T) {
+	master := common.HexToAddress("0x01")
+	ethSigners := []common.Address{master, common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+
+	assert.Empty(t, signerDiscrepancies(3, 2, ethSigners, 2, master))
+	assert.Len(t, signerDiscrepancies(4, 3, ethSigners, 2, master), 2)
+	assert.Len(t, signerDiscrepancies(3, 2, ethSigners, 2, common.HexToAddress("0x04")), 1)
+}
@@ -0,0 +1,333 @@
+package bridge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+const (
+	// watchdogInterval is how often the watchdog checks if the master handles the transfers
+	watchdogInterval = time.Minute
+	// watchdogRetention is how long handled transfers are remembered
+	watchdogRetention = 24 * time.Hour
+	// unexpectedRequestGrace is how long a transfer the master asks to sign has to show up on the chains
+	unexpectedRequestGrace = 5 * time.Minute
+)
+
+// watchedTransfer is a deposit or withdrawal the watchdog expects the master to handle
+type watchedTransfer struct {
+	kind string
+	// receiver is the EVM address of a mint, empty if the deposit can not be minted
+	receiver string
+	// destination is the Stellar destination of a withdrawal
+	destination string
+	// amount is the amount in stroops that is expected to be minted or withdrawn
+	amount int64
+	// action is what the master asked to do with the transfer if it requested it before the watchdog saw it
+	action requestAction
+	// seen is when the watchdog noticed the transfer, zero if it only knows it from a request
+	seen time.Time
+	// requested is when the master asked to sign the transfer, zero if it did not yet
+	requested time.Time
+	// handled is set if the master requested a signature or the vault paid it out
+	handled bool
+	alerted bool
+}
+
+// Watchdog lets a follower check the master independently
+// It watches the vault for deposits and the token contract for withdrawals
+// and alerts if the master does not handle them or requests signatures for transfers it did not see.
+type Watchdog struct {
+	contract   *BridgeContract
+	wallet     *stellar.Wallet
+	vault      string
+	depositFee int64 // deposit fee in TFT units
+	// silence is how long the master can leave a transfer unhandled
+	silence time.Duration
+
+	// mintGuard and withdrawGuard are the guards of the cosigner,
+	// the master holds the transfers they hold in its approval queue
+	mintGuard     *transferGuard
+	withdrawGuard *transferGuard
+
+	mut         sync.Mutex
+	transfers   map[string]*watchedTransfer
+	lastRequest time.Time
+	alerts      atomic.Uint64
+	now         func() time.Time
+}
+
+// NewWatchdog creates a watchdog for the vault account, it is started with Run
+func NewWatchdog(contract *BridgeContract, wallet *stellar.Wallet, vault string, config *BridgeConfig) *Watchdog {
+	return &Watchdog{
+		contract:   contract,
+		wallet:     wallet,
+		vault:      vault,
+		depositFee: config.DepositFee,
+		silence:    config.MasterSilenceTimeout,
+		transfers:  make(map[string]*watchedTransfer),
+		now:        time.Now,
+	}
+}
+
+// Run watches the vault and the token contract until the context is canceled
+func (w *Watchdog) Run(ctx context.Context) error {
+	currentBlock, err := w.contract.ethc.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	withdrawals := make(chan WithdrawEvent)
+	go func() {
+		if err := w.contract.SubscribeWithdraw(ctx, withdrawals, currentBlock); err != nil {
+			log.Error("Watchdog stopped watching withdrawals", "err", err)
+		}
+	}()
+	go func() {
+		// Only new transactions, the master handles older ones on startup
+		if err := w.wallet.TransactionStorage.StreamTransactions(ctx, "now", w.handleVaultTransaction); err != nil {
+			log.Error("Watchdog stopped watching the vault", "err", err)
+		}
+	}()
+
+	log.Info("Watchdog started", "vault", w.vault, "silence", w.silence)
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case we := <-withdrawals:
+			if we.network != BridgeNetwork {
+				continue
+			}
+			w.expect(hex.EncodeToString(we.txHash[:]), watchedTransfer{kind: approvals.KindWithdraw, destination: we.blockchain_address, amount: we.amount.Int64()})
+		case <-ticker.C:
+			w.check()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Alerts returns the number of alerts since the watchdog started
+func (w *Watchdog) Alerts() uint64 {
+	if w == nil {
+		return 0
+	}
+	return w.alerts.Load()
+}
+
+func (w *Watchdog) alert(msg string, ctx ...interface{}) {
+	alerts := w.alerts.Add(1)
+	log.Error("Watchdog: "+msg, append(ctx, "alerts", alerts)...)
+}
+
+// handleVaultTransaction expects deposits to be minted or refunded
+// and marks the transfers the vault pays out or refunds as handled
+func (w *Watchdog) handleVaultTransaction(tx hProtocol.Transaction) {
+	if !tx.Successful {
+		return
+	}
+	if tx.Account == w.vault {
+		if tx.MemoType != "hash" && tx.MemoType != "return" {
+			return
+		}
+		memo, err := base64.StdEncoding.DecodeString(tx.Memo)
+		if err != nil {
+			return
+		}
+		w.handled(hex.EncodeToString(memo))
+		return
+	}
+
+	deposit, err := w.wallet.GetDepositDetails(tx, w.vault)
+	if err != nil || (deposit.TotalTFT() == 0 && len(deposit.OtherAssets) == 0) {
+		return
+	}
+	expected := watchedTransfer{kind: approvals.KindMint}
+	// A deposit that can not be minted is refunded
+	if receiver, err := w.wallet.GetDepositReceiver(tx, w.vault); err == nil && deposit.TotalTFT() > stellar.IntToStroops(w.depositFee) {
+		expected.receiver = common.BytesToAddress(receiver[:]).Hex()
+		expected.amount = deposit.TotalTFT() - stellar.IntToStroops(w.depositFee)
+	}
+	w.expect(tx.Hash, expected)
+}
+
+// expect adds a transfer the master has to handle
+func (w *Watchdog) expect(id string, expected watchedTransfer) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	expected.seen = w.now()
+	t, ok := w.transfers[id]
+	if !ok {
+		w.transfers[id] = &expected
+		return
+	}
+	if !t.seen.IsZero() {
+		return
+	}
+	// The master asked to sign the transfer before the watchdog saw it
+	requested := *t
+	t.kind, t.receiver, t.destination, t.amount, t.seen = expected.kind, expected.receiver, expected.destination, expected.amount, expected.seen
+	w.compare(id, t, requested.action, requested.kind, requested.receiver, requested.amount)
+}
+
+// requestAction is what a request the master asks to sign does with a transfer
+type requestAction int
+
+const (
+	// actionOther is a payout, a deposit fee transfer or the return of a withdrawal
+	actionOther requestAction = iota
+	actionMint
+	actionRefund
+)
+
+// compare alerts if a transfer the master asks to sign does not match what the watchdog expects
+// The receiver and amount are only compared for mints.
+// A deposit that can be minted can still be refunded by the master, for example if an operator rejected it,
+// so the alert for such a refund needs to be checked against the operator actions.
+func (w *Watchdog) compare(id string, t *watchedTransfer, action requestAction, kind string, receiver string, amount int64) {
+	if t.kind != kind {
+		w.alert("the master asked to sign an unexpected kind of transfer", "id", id, "expected", t.kind, "requested", kind)
+		return
+	}
+	switch action {
+	case actionRefund:
+		if t.receiver != "" {
+			w.alert("the master asked to refund a deposit that can be minted", "id", id, "expectedReceiver", t.receiver, "expectedAmount", t.amount)
+		}
+		return
+	case actionOther:
+		return
+	}
+	if t.receiver == "" {
+		w.alert("the master asked to mint a deposit that needs to be refunded", "id", id, "receiver", receiver, "amount", amount)
+		return
+	}
+	if !strings.EqualFold(t.receiver, receiver) || t.amount != amount {
+		w.alert("the master asked to sign a mint that does not match the deposit", "id", id, "receiver", receiver, "amount", amount, "expectedReceiver", t.receiver, "expectedAmount", t.amount)
+	}
+}
+
+// handled marks a transfer as handled by the master
+func (w *Watchdog) handled(id string) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if t, ok := w.transfers[id]; ok {
+		t.handled = true
+	}
+}
+
+// request records that the master asked to sign a transfer
+// receiver and amount are only compared for mints.
+func (w *Watchdog) request(id string, action requestAction, kind string, receiver string, amount int64) {
+	if w == nil {
+		return
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	now := w.now()
+	w.lastRequest = now
+	t, ok := w.transfers[id]
+	if !ok {
+		w.transfers[id] = &watchedTransfer{kind: kind, action: action, receiver: receiver, amount: amount, requested: now, handled: true}
+		return
+	}
+	t.handled = true
+	if !t.requested.IsZero() {
+		// a retry
+		return
+	}
+	t.requested = now
+	w.compare(id, t, action, kind, receiver, amount)
+}
+
+// ObserveMint records a mint the master asks to sign
+func (w *Watchdog) ObserveMint(request EthSignRequest) {
+	if withdrawalTxHash, ok := parseWithdrawalReturnTxID(request.TxId); ok {
+		// A returned withdrawal is handled
+		w.request(hex.EncodeToString(withdrawalTxHash[:]), actionOther, approvals.KindWithdraw, "", 0)
+		return
+	}
+	w.request(request.TxId, actionMint, approvals.KindMint, request.Receiver.Hex(), request.Amount)
+}
+
+// ObserveStellarRequest records a Stellar transaction the master asks to sign
+func (w *Watchdog) ObserveStellarRequest(request multisig.StellarSignRequest) {
+	switch request.Kind {
+	case multisig.KindWithdrawal:
+		w.request(hex.EncodeToString(request.EthTxHash[:]), actionOther, approvals.KindWithdraw, "", 0)
+	case multisig.KindRefund:
+		w.request(request.DepositTxHash, actionRefund, approvals.KindMint, "", 0)
+	case multisig.KindDepositFeeTransfer:
+		w.request(request.DepositTxHash, actionOther, approvals.KindMint, "", 0)
+	default:
+		if w != nil {
+			w.mut.Lock()
+			w.lastRequest = w.now()
+			w.mut.Unlock()
+		}
+	}
+}
+
+// setGuards sets the guards of the cosigner to know which transfers the master holds
+func (w *Watchdog) setGuards(mintGuard *transferGuard, withdrawGuard *transferGuard) {
+	if w == nil {
+		return
+	}
+	w.mintGuard = mintGuard
+	w.withdrawGuard = withdrawGuard
+}
+
+// held checks if the master holds a transfer in its approval queue because it needs an approval
+// or exceeds the transfer limits, the master does not handle it until it is approved or fits in the limits
+func (w *Watchdog) held(id string, t *watchedTransfer) bool {
+	transfer := approvals.Transfer{Kind: t.kind, ID: id, Amount: t.amount}
+	guard := w.withdrawGuard
+	if t.kind == approvals.KindMint {
+		// A deposit that can not be minted is refunded right away
+		if t.receiver == "" {
+			return false
+		}
+		transfer.Destination = t.receiver
+		guard = w.mintGuard
+	} else {
+		transfer.Destination = t.destination
+	}
+	return guard != nil && guard.holds(transfer)
+}
+
+// check alerts for the transfers the master did not handle in time
+// and for the requests of transfers that did not show up on the chains
+func (w *Watchdog) check() {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	now := w.now()
+	for id, t := range w.transfers {
+		switch {
+		case t.handled && !t.seen.IsZero() && now.Sub(t.seen) > watchdogRetention:
+			delete(w.transfers, id)
+		case t.seen.IsZero() && now.Sub(t.requested) > watchdogRetention:
+			delete(w.transfers, id)
+		case t.alerted:
+		case !t.handled && now.Sub(t.seen) > w.silence && w.held(id, t):
+			log.Debug("Watchdog: the transfer is held for an operator approval or deferred", "id", id, "kind", t.kind)
+		case !t.handled && now.Sub(t.seen) > w.silence:
+			t.alerted = true
+			w.alert("the master did not handle a transfer", "id", id, "kind", t.kind, "seen", t.seen, "lastRequest", w.lastRequest)
+		case t.seen.IsZero() && now.Sub(t.requested) > unexpectedRequestGrace:
+			t.alerted = true
+			w.alert("the master asked to sign a transfer that did not show up", "id", id, "kind", t.kind, "requested", t.requested)
+		}
+	}
+}
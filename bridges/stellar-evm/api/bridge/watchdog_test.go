@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+func newTestWatchdog(now *time.Time) *Watchdog {
+	w := NewWatchdog(nil, nil, "", &BridgeConfig{MasterSilenceTimeout: 30 * time.Minute})
+	w.now = func() time.Time { return *now }
+	return w
+}
+
+func TestWatchdogMasterSilence(t *testing.T) {
+	now := time.Now()
+	w := newTestWatchdog(&now)
+	receiver := common.HexToAddress("0x01")
+
+	w.expect("deposit", watchedTransfer{kind: approvals.KindMint, receiver: receiver.Hex(), amount: 100})
+	w.expect("withdrawal", watchedTransfer{kind: approvals.KindWithdraw})
+	w.ObserveMint(EthSignRequest{TxId: "deposit", Receiver: receiver, Amount: 100})
+	assert.Equal(t, uint64(0), w.Alerts())
+
+	now = now.Add(31 * time.Minute)
+	w.check()
+	assert.Equal(t, uint64(1), w.Alerts())
+	// alerted once
+	w.check()
+	assert.Equal(t, uint64(1), w.Alerts())
+
+	// handled transfers are forgotten after a while
+	now = now.Add(watchdogRetention)
+	w.handled("withdrawal")
+	w.check()
+	assert.Empty(t, w.transfers)
+}
+
+func TestWatchdogUnexpectedRequests(t *testing.T) {
+	now := time.Now()
+	w := newTestWatchdog(&now)
+	receiver := common.HexToAddress("0x01")
+
+	// a mint that does not match the deposit
+	w.expect("deposit", watchedTransfer{kind: approvals.KindMint, receiver: receiver.Hex(), amount: 100})
+	w.ObserveMint(EthSignRequest{TxId: "deposit", Receiver: receiver, Amount: 200})
+	assert.Equal(t, uint64(1), w.Alerts())
+
+	// a mint of a deposit that needs to be refunded
+	w.expect("refund", watchedTransfer{kind: approvals.KindMint})
+	w.ObserveMint(EthSignRequest{TxId: "refund", Receiver: receiver, Amount: 200})
+	assert.Equal(t, uint64(2), w.Alerts())
+	w.expect("other", watchedTransfer{kind: approvals.KindMint})
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindRefund, DepositTxHash: "other"})
+	assert.Equal(t, uint64(2), w.Alerts())
+
+	// a refund of a deposit that can be minted
+	w.expect("mintable", watchedTransfer{kind: approvals.KindMint, receiver: receiver.Hex(), amount: 100})
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindRefund, DepositTxHash: "mintable"})
+	assert.Equal(t, uint64(3), w.Alerts())
+
+	// requested before the watchdog saw it
+	ethTx := common.HexToHash("0x02")
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindWithdrawal, EthTxHash: ethTx})
+	w.expect(ethTx.Hex()[2:], watchedTransfer{kind: approvals.KindWithdraw})
+	assert.Equal(t, uint64(3), w.Alerts())
+
+	// a refund requested before the watchdog saw the deposit
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindRefund, DepositTxHash: "early"})
+	w.expect("early", watchedTransfer{kind: approvals.KindMint, receiver: receiver.Hex(), amount: 100})
+	assert.Equal(t, uint64(4), w.Alerts())
+
+	// never showed up
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindDepositFeeTransfer, DepositTxHash: "unknown"})
+	now = now.Add(unexpectedRequestGrace + time.Second)
+	w.check()
+	assert.Equal(t, uint64(5), w.Alerts())
+}
+
+func TestWatchdogHeldTransfers(t *testing.T) {
+	now := time.Now()
+	w := newTestWatchdog(&now)
+	config := &BridgeConfig{ApprovalThreshold: 1000, Approver: "approver"}
+	w.setGuards(newTransferGuard(config, nil, nil), newTransferGuard(config, nil, nil))
+	receiver := common.HexToAddress("0x01")
+
+	// above the approval threshold
+	w.expect("deposit", watchedTransfer{kind: approvals.KindMint, receiver: receiver.Hex(), amount: stellar.IntToStroops(2000)})
+	w.expect("withdrawal", watchedTransfer{kind: approvals.KindWithdraw, destination: "destination", amount: stellar.IntToStroops(2000)})
+	now = now.Add(31 * time.Minute)
+	w.check()
+	assert.Equal(t, uint64(0), w.Alerts())
+
+	w.expect("small", watchedTransfer{kind: approvals.KindWithdraw, destination: "destination", amount: stellar.IntToStroops(10)})
+	now = now.Add(31 * time.Minute)
+	w.check()
+	assert.Equal(t, uint64(1), w.Alerts())
+}
+
+func TestNilWatchdog(t *testing.T) {
+	var w *Watchdog
+	w.ObserveMint(EthSignRequest{TxId: "deposit"})
+	w.ObserveStellarRequest(multisig.StellarSignRequest{Kind: multisig.KindClaim})
+	assert.Equal(t, uint64(0), w.Alerts())
+}
@@ -0,0 +1,302 @@
+/*
+Package approvals holds transfers that need a manual approval of an operator before the bridge executes them.
+*/
+package approvals
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+)
+
+const (
+	KindMint           = "mint"
+	KindWithdraw       = "withdraw"
+	KindSignerRotation = "signer-rotation"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+	// StatusRefunded is the status of a rejected deposit that is refunded,
+	// it is kept so the deposit is not added and refunded again
+	StatusRefunded Status = "refunded"
+	// StatusDeferred is the status of a transfer that exceeds the transfer limits and is retried until it fits
+	StatusDeferred Status = "deferred"
+)
+
+var ErrEntryNotFound = errors.New("approval queue entry not found")
+
+// Transfer identifies what an operator approves
+type Transfer struct {
+	Kind string `json:"kind"`
+	// ID is the Stellar deposit transaction hash for a mint or the Ethereum transaction hash for a withdrawal
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	// Amount in stroops
+	Amount int64 `json:"amount"`
+}
+
+// SignerRotation is what an operator approves to replace the signers of the bridge
+// The hash identifies the new signer set.
+func SignerRotation(hash [32]byte) Transfer {
+	return Transfer{Kind: KindSignerRotation, ID: hex.EncodeToString(hash[:])}
+}
+
+func (t Transfer) message() []byte {
+	return []byte(fmt.Sprintf("%s:%s:%s:%d", t.Kind, t.ID, t.Destination, t.Amount))
+}
+
+// rejectionMessage differs from the approval message so an approval can not be used as a rejection and vice versa
+func (t Transfer) rejectionMessage() []byte {
+	return append([]byte("reject:"), t.message()...)
+}
+
+// Sign creates an approval for the transfer with the operator's Stellar secret
+func Sign(secret string, t Transfer) (approval string, err error) {
+	return sign(secret, t.message())
+}
+
+// Verify checks if the approval for the transfer is signed by the operator with the given Stellar address
+func Verify(operator string, t Transfer, approval string) error {
+	return verify(operator, t.message(), approval)
+}
+
+// SignRejection creates a rejection of the transfer with the operator's Stellar secret
+func SignRejection(secret string, t Transfer) (rejection string, err error) {
+	return sign(secret, t.rejectionMessage())
+}
+
+// VerifyRejection checks if the rejection of the transfer is signed by the operator with the given Stellar address
+func VerifyRejection(operator string, t Transfer, rejection string) error {
+	return verify(operator, t.rejectionMessage(), rejection)
+}
+
+func sign(secret string, message []byte) (string, error) {
+	kp, err := keypair.ParseFull(secret)
+	if err != nil {
+		return "", err
+	}
+	signature, err := kp.Sign(message)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func verify(operator string, message []byte, signature string) error {
+	kp, err := keypair.ParseAddress(operator)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	return kp.Verify(message, decoded)
+}
+
+// Entry is a transfer in the queue
+type Entry struct {
+	Transfer
+	Status   Status `json:"status"`
+	Reason   string `json:"reason"`
+	Approval string `json:"approval,omitempty"`
+	// Rejection is the operator rejection, the cosigners only return a payable withdrawal with it
+	Rejection string    `json:"rejection,omitempty"`
+	Created   time.Time `json:"created"`
+	// Receiver, BlockHeight and LogIndex of the withdraw event, needed to execute an approved withdrawal
+	Receiver    string `json:"receiver,omitempty"`
+	BlockHeight uint64 `json:"blockHeight,omitempty"`
+	LogIndex    uint   `json:"logIndex,omitempty"`
+}
+
+// Queue is a file backed approval queue
+// The file is shared between the bridge and the operator tooling so it is read on every access
+// and updates hold a lock on the lock file next to it, so concurrent updates of both are not lost.
+type Queue struct {
+	location string
+	mut      sync.Mutex
+}
+
+// NewQueue creates a new Queue stored at location
+func NewQueue(location string) *Queue {
+	return &Queue{
+		location: location,
+	}
+}
+
+// Get returns the entry for the transfer with the given id
+func (q *Queue) Get(id string) (entry Entry, err error) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	entries, err := q.load()
+	if err != nil {
+		return
+	}
+	entry, ok := entries[id]
+	if !ok {
+		err = ErrEntryNotFound
+	}
+	return
+}
+
+// List returns all entries ordered by creation time
+func (q *Queue) List() ([]Entry, error) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	entries, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// Add adds a pending entry if there is no entry for the transfer yet
+func (q *Queue) Add(entry Entry) error {
+	return q.update(func(entries map[string]Entry) error {
+		if _, ok := entries[entry.ID]; ok {
+			return nil
+		}
+		entry.Status = StatusPending
+		entry.Approval = ""
+		entries[entry.ID] = entry
+		return nil
+	})
+}
+
+// Defer adds a deferred entry if there is no entry for the transfer yet
+func (q *Queue) Defer(entry Entry) error {
+	return q.update(func(entries map[string]Entry) error {
+		if _, ok := entries[entry.ID]; ok {
+			return nil
+		}
+		entry.Status = StatusDeferred
+		entry.Approval = ""
+		entries[entry.ID] = entry
+		return nil
+	})
+}
+
+// Approve marks a pending entry as approved with the operator approval
+func (q *Queue) Approve(id string, approval string) error {
+	return q.update(func(entries map[string]Entry) error {
+		entry, ok := entries[id]
+		if !ok {
+			return ErrEntryNotFound
+		}
+		entry.Status = StatusApproved
+		entry.Approval = approval
+		entries[id] = entry
+		return nil
+	})
+}
+
+// Reject marks an entry as rejected with the operator rejection
+func (q *Queue) Reject(id string, rejection string) error {
+	return q.update(func(entries map[string]Entry) error {
+		entry, ok := entries[id]
+		if !ok {
+			return ErrEntryNotFound
+		}
+		entry.Status = StatusRejected
+		entry.Approval = ""
+		entry.Rejection = rejection
+		entries[id] = entry
+		return nil
+	})
+}
+
+// MarkRefunded marks a rejected deposit as refunded
+func (q *Queue) MarkRefunded(id string) error {
+	return q.update(func(entries map[string]Entry) error {
+		entry, ok := entries[id]
+		if !ok {
+			return ErrEntryNotFound
+		}
+		entry.Status = StatusRefunded
+		entries[id] = entry
+		return nil
+	})
+}
+
+// Remove removes an entry once it is handled
+func (q *Queue) Remove(id string) error {
+	return q.update(func(entries map[string]Entry) error {
+		delete(entries, id)
+		return nil
+	})
+}
+
+func (q *Queue) update(fn func(map[string]Entry) error) error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	unlock, err := lockFile(q.location + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := q.load()
+	if err != nil {
+		return err
+	}
+	if err = fn(entries); err != nil {
+		return err
+	}
+	return q.save(entries)
+}
+
+func (q *Queue) load() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	file, err := os.ReadFile(q.location)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(file, &entries)
+	return entries, err
+}
+
+// save writes the entries to a unique temporary file first and renames it so a reader never sees a partial file
+func (q *Queue) save(entries map[string]Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.location), filepath.Base(q.location)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.location)
+}
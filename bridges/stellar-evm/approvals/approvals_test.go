@@ -0,0 +1,85 @@
+package approvals
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := "SBVM45L3DA4QA4GRGOZVOKEMRI6LGJXBGOFGHUTCWL3LW6H7KSHCYUTS"
+	operator := keypair.MustParseFull(secret).Address()
+	transfer := Transfer{Kind: KindMint, ID: "txid", Destination: "0x65e491D7b985f77e60c85105834A0332fF3002CE", Amount: 100}
+
+	approval, err := Sign(secret, transfer)
+	assert.NoError(t, err)
+	assert.NoError(t, Verify(operator, transfer, approval))
+
+	transfer.Amount = 101
+	assert.Error(t, Verify(operator, transfer, approval))
+
+	transfer.Amount = 100
+	rejection, err := SignRejection(secret, transfer)
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyRejection(operator, transfer, rejection))
+	// an approval is not a rejection and the other way around
+	assert.Error(t, VerifyRejection(operator, transfer, approval))
+	assert.Error(t, Verify(operator, transfer, rejection))
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(filepath.Join(t.TempDir(), "approvals.json"))
+
+	_, err := q.Get("txid")
+	assert.Equal(t, ErrEntryNotFound, err)
+
+	assert.NoError(t, q.Add(Entry{Transfer: Transfer{Kind: KindWithdraw, ID: "txid", Amount: 100}}))
+	entry, err := q.Get("txid")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, entry.Status)
+
+	assert.NoError(t, q.Approve("txid", "approval"))
+	// Adding an existing entry does not reset it
+	assert.NoError(t, q.Add(Entry{Transfer: Transfer{Kind: KindWithdraw, ID: "txid", Amount: 100}}))
+	entry, err = q.Get("txid")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusApproved, entry.Status)
+	assert.Equal(t, "approval", entry.Approval)
+
+	assert.NoError(t, q.Remove("txid"))
+	entries, err := q.List()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Equal(t, ErrEntryNotFound, q.Reject("txid", "rejection"))
+	assert.Equal(t, ErrEntryNotFound, q.MarkRefunded("txid"))
+
+	assert.NoError(t, q.Defer(Entry{Transfer: Transfer{Kind: KindMint, ID: "deposit", Amount: 100}}))
+	entry, err = q.Get("deposit")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDeferred, entry.Status)
+}
+
+func TestQueueConcurrentWriters(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "approvals.json")
+	// the bridge and the operator tooling each have their own queue on the same file
+	writers := []*Queue{NewQueue(location), NewQueue(location)}
+	var wg sync.WaitGroup
+	for i, q := range writers {
+		wg.Add(1)
+		go func(i int, q *Queue) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.NoError(t, q.Add(Entry{Transfer: Transfer{Kind: KindMint, ID: fmt.Sprintf("%d-%d", i, j)}}))
+			}
+		}(i, q)
+	}
+	wg.Wait()
+	entries, err := writers[0].List()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 40)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package approvals
+
+// lockFile does not lock on platforms without flock,
+// only one process should update the queue there
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
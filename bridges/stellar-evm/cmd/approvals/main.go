@@ -0,0 +1,88 @@
+// approvals lists, approves and rejects the transfers in the approval queue of a bridge
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flag "github.com/spf13/pflag"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[flags] list | approve <id> | reject <id>")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	var queueFile string
+	var secret string
+	flag.StringVar(&queueFile, "approvals", "./approvals.json", "file where the bridge stores transfers awaiting an operator approval")
+	flag.StringVar(&secret, "secret", "", "stellar secret of the operator, required to approve or reject a transfer")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+	}
+	queue := approvals.NewQueue(queueFile)
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = list(queue)
+	case "approve":
+		if len(args) != 2 || secret == "" {
+			usage()
+		}
+		err = approve(queue, args[1], secret)
+	case "reject":
+		if len(args) != 2 || secret == "" {
+			usage()
+		}
+		err = reject(queue, args[1], secret)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func list(queue *approvals.Queue) error {
+	entries, err := queue.List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s %s %s TFT to %s (%s): %s\n", entry.Status, entry.Kind, stellar.StroopsToDecimal(entry.Amount), entry.Destination, entry.ID, entry.Reason)
+	}
+	return nil
+}
+
+func approve(queue *approvals.Queue, id string, secret string) error {
+	entry, err := queue.Get(id)
+	if err != nil {
+		return err
+	}
+	approval, err := approvals.Sign(secret, entry.Transfer)
+	if err != nil {
+		return err
+	}
+	return queue.Approve(id, approval)
+}
+
+func reject(queue *approvals.Queue, id string, secret string) error {
+	entry, err := queue.Get(id)
+	if err != nil {
+		return err
+	}
+	rejection, err := approvals.SignRejection(secret, entry.Transfer)
+	if err != nil {
+		return err
+	}
+	return queue.Reject(id, rejection)
+}
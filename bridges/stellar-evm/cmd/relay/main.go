@@ -0,0 +1,63 @@
+// relay runs a relay node for the private network of the bridges
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/multiformats/go-multiaddr"
+	flag "github.com/spf13/pflag"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/api/bridge"
+)
+
+func main() {
+	var secret, psk string
+	var listen, signers []string
+	var debug bool
+
+	flag.StringVar(&secret, "secret", "", "stellar secret the peer ID of the relay is derived from, if not set a random peer ID is used")
+	flag.StringVar(&psk, "psk", "", "32 bytes hex encoded pre-shared key of the private network of the bridges")
+	flag.StringSliceVar(&listen, "listen", []string{"/ip4/0.0.0.0/tcp/4001"}, "multiaddrs to listen on")
+	flag.StringSliceVar(&signers, "signers", nil, "stellar addresses of the bridges that can use the relay")
+	flag.BoolVar(&debug, "debug", false, "sets debug level log output")
+	flag.Parse()
+
+	if psk == "" || len(signers) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "--psk <psk> --signers G...,G... [flags]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	level := log.LvlInfo
+	if debug {
+		level = log.LvlDebug
+	}
+	log.Root().SetHandler(log.LvlFilterHandler(level, log.StreamHandler(os.Stdout, log.TerminalFormat(true))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay, err := bridge.NewRelay(ctx, secret, listen, psk, signers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer relay.Close()
+
+	partialMA, err := multiaddr.NewMultiaddr(fmt.Sprintf("/p2p/%s", relay.Host.ID()))
+	if err != nil {
+		panic(err)
+	}
+	for _, addr := range relay.Host.Addrs() {
+		log.Info("relay address", "address", addr.Encapsulate(partialMA).String())
+	}
+	log.Info("relaying for the bridges", "signers", len(signers))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	log.Info("signal", "signal", sig)
+}
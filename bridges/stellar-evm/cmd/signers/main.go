@@ -0,0 +1,157 @@
+// signers replaces the signers of the vault account and the token contract of a bridge
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	flag "github.com/spf13/pflag"
+	"github.com/stellar/go/keypair"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/api/bridge"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/approvals"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[flags] approve | rotate")
+	fmt.Fprintln(os.Stderr, "  approve: sign the new signer set with the operator secret and print the approval")
+	fmt.Fprintln(os.Stderr, "  rotate: collect the signatures of the current cosigners with the master secret and replace the signers")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	var rotation multisig.SignerRotation
+	var ethSigners []string
+	var stellarWeights map[string]int
+	var secret, approval string
+	var ethCfg bridge.EthConfig
+	var stellarNetwork, relay, psk string
+
+	flag.StringSliceVar(&rotation.StellarSigners, "stellarSigners", nil, "the new cosigners of the vault account, without the master")
+	flag.StringToIntVar(&stellarWeights, "stellarWeights", nil, "the weights of the new cosigners as address=weight, a cosigner without a weight has a weight of 1")
+	flag.Uint8Var(&rotation.StellarThreshold, "threshold", 0, "the new medium and high threshold of the vault account")
+	flag.StringSliceVar(&ethSigners, "ethSigners", nil, "the new signers of the token contract")
+	flag.Int64Var(&rotation.EthSignaturesRequired, "ethSignaturesRequired", 0, "the number of signatures the token contract requires to mint")
+
+	flag.StringVar(&secret, "secret", "", "stellar secret of the operator to approve, of the master bridge to rotate")
+	flag.StringVar(&approval, "approval", "", "operator approval of the new signers, required to rotate")
+	flag.StringVar(&stellarNetwork, "network", "testnet", "stellar network, testnet or production")
+	flag.StringVar(&relay, "relay", "", "relay address")
+	flag.StringVar(&psk, "psk", "", "psk for the relay")
+	flag.StringVar(&ethCfg.EthNetworkName, "ethnetwork", "eth-mainnet", "ethereum network name")
+	flag.StringVar(&ethCfg.EthUrl, "ethurl", "ws://localhost:8551", "ethereum rpc url")
+	flag.StringVar(&ethCfg.ContractAddress, "contract", "", "token contract address")
+	flag.StringVar(&ethCfg.EthPrivateKey, "ethkey", "", "ethereum private key of an owner of the token contract")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 || secret == "" {
+		usage()
+	}
+	for _, signer := range ethSigners {
+		if !common.IsHexAddress(signer) {
+			fmt.Fprintln(os.Stderr, "invalid EVM address:", signer)
+			os.Exit(1)
+		}
+		rotation.EthSigners = append(rotation.EthSigners, common.HexToAddress(signer))
+	}
+	for signer, weight := range stellarWeights {
+		if weight < 1 || weight > 255 {
+			fmt.Fprintln(os.Stderr, "invalid weight for", signer)
+			os.Exit(1)
+		}
+		if rotation.StellarWeights == nil {
+			rotation.StellarWeights = make(map[string]uint8, len(stellarWeights))
+		}
+		rotation.StellarWeights[signer] = uint8(weight)
+	}
+	if err := rotation.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var err error
+	switch args[0] {
+	case "approve":
+		approval, err = approvals.Sign(secret, approvals.SignerRotation(rotation.Hash()))
+		if err == nil {
+			fmt.Println(approval)
+		}
+	case "rotate":
+		if approval == "" {
+			usage()
+		}
+		err = rotate(rotation, approval, secret, stellarNetwork, relay, psk, &ethCfg)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// rotate replaces the cosigners of the vault account and then the signers of the token contract
+// Running it again after a failure does not submit the Stellar transaction twice.
+func rotate(rotation multisig.SignerRotation, approval string, secret string, network string, relay string, psk string, ethCfg *bridge.EthConfig) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kp, err := keypair.ParseFull(secret)
+	if err != nil {
+		return err
+	}
+	contract, err := bridge.NewBridgeContract(ethCfg)
+	if err != nil {
+		return err
+	}
+	horizon, err := stellar.NewHorizonClient(network, "")
+	if err != nil {
+		return err
+	}
+	txStorage := stellar.NewTransactionStorage(network, horizon, kp.Address())
+	wallet, err := stellar.NewWallet(&stellar.StellarConfig{StellarNetwork: network, StellarSeed: secret}, 0, contract, txStorage, horizon)
+	if err != nil {
+		return err
+	}
+
+	host, router, err := bridge.NewHost(ctx, secret, relay, psk)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+	relayAddrInfo, err := peer.AddrInfoFromString(relay)
+	if err != nil {
+		return err
+	}
+	wallet.SetSignerClient(bridge.NewSignersClient(host, router, relayAddrInfo, wallet))
+	requirements, err := wallet.GetSigningRequirements()
+	if err != nil {
+		return err
+	}
+	if err = wallet.SetSigners(requirements); err != nil {
+		return err
+	}
+
+	err = wallet.CreateAndSubmitSignerRotation(ctx, rotation, approval)
+	switch {
+	case errors.Is(err, stellar.ErrSignerRotationExecuted):
+		fmt.Println("The signers of the vault account are replaced already")
+	case err != nil:
+		return fmt.Errorf("failed to replace the signers of the vault account: %w", err)
+	default:
+		fmt.Println("Replaced the signers of the vault account")
+	}
+
+	if err = contract.SetSigners(rotation.EthSigners, rotation.EthSignaturesRequired); err != nil {
+		return fmt.Errorf("failed to replace the signers of the token contract: %w", err)
+	}
+	fmt.Println("Replaced the signers of the token contract")
+	return nil
+}
@@ -29,3 +29,20 @@ func GetErc20AddressFromB64(input string) (ethAddress ERC20Address, err error) {
 
 	return ethAddress, nil
 }
+
+// GetErc20AddressFromHash extracts an ERC20 address from a 32 byte hash
+// The address is right aligned and the first 12 bytes have to be 0, like an address in the EVM ABI encoding
+func GetErc20AddressFromHash(hash []byte) (ethAddress ERC20Address, err error) {
+	if len(hash) != 32 {
+		err = errors.New("A hash should be 32 bytes")
+		return
+	}
+	for _, b := range hash[:32-ERC20AddressLength] {
+		if b != 0 {
+			err = errors.New("A hash containing an ERC20 address should start with 12 zero bytes")
+			return
+		}
+	}
+	copy(ethAddress[:], hash[32-ERC20AddressLength:])
+	return
+}
@@ -0,0 +1,541 @@
+// Package ethtest provides an in-memory EVM chain with the TFT token contract, served over JSON-RPC,
+// so the bridge can be tested without access to an EVM network.
+// The token contract is not executed by an EVM, its functions are implemented in Go like in tokenV1.sol.
+// The simulated backend of go-ethereum can not be used: the bindings in contracts/tokenv1 are generated from the ABI
+// only and the compiled contract is not part of this repository. The calls and logs use the generated ABI,
+// so a mismatch with the bindings fails, but the behaviour of the contract is emulated and has to be kept in sync.
+package ethtest
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/contracts/tokenv1"
+)
+
+const (
+	// blockGasLimit is the gas limit of every block
+	blockGasLimit = 30000000
+	// txGas is the gas every transaction uses
+	txGas = 50000
+)
+
+// ErrReverted is returned for calls the token contract rejects
+var ErrReverted = errors.New("execution reverted")
+
+type block struct {
+	header   *types.Header
+	receipts []*types.Receipt
+}
+
+// token is the state of the token contract
+type token struct {
+	owner              common.Address
+	balances           map[common.Address]*big.Int
+	totalSupply        *big.Int
+	signers            []common.Address
+	signaturesRequired *big.Int
+	withdrawFee        *big.Int
+	withdrawFeeSet     bool
+	mintIDs            map[string]bool
+}
+
+// Chain is an in-memory EVM chain with the token contract deployed
+// Every transaction is mined in a block of its own as soon as it is sent.
+type Chain struct {
+	chainID  *big.Int
+	contract common.Address
+	abi      abi.ABI
+
+	mut      sync.Mutex
+	blocks   []block
+	receipts map[common.Hash]*types.Receipt
+	nonces   map[common.Address]uint64
+	token    token
+
+	headFeed event.Feed
+	logsFeed event.Feed
+}
+
+// NewChain creates a chain with the token contract at the contract address, owned by owner
+func NewChain(chainID uint64, contract common.Address, owner common.Address) (*Chain, error) {
+	parsed, err := tokenv1.TokenMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{
+		chainID:  new(big.Int).SetUint64(chainID),
+		contract: contract,
+		abi:      *parsed,
+		receipts: make(map[common.Hash]*types.Receipt),
+		nonces:   make(map[common.Address]uint64),
+		token: token{
+			owner:              owner,
+			balances:           make(map[common.Address]*big.Int),
+			totalSupply:        new(big.Int),
+			signaturesRequired: new(big.Int),
+			withdrawFee:        new(big.Int),
+			mintIDs:            make(map[string]bool),
+		},
+	}
+	c.blocks = append(c.blocks, block{header: &types.Header{
+		Number:     new(big.Int),
+		Difficulty: new(big.Int),
+		GasLimit:   blockGasLimit,
+		Time:       uint64(time.Now().Unix()),
+	}})
+	return c, nil
+}
+
+// SetSigners sets the signers of the mint function like the owner of the token contract does
+func (c *Chain) SetSigners(signers []common.Address, signaturesRequired int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.token.signers = append([]common.Address(nil), signers...)
+	c.token.signaturesRequired = big.NewInt(signaturesRequired)
+}
+
+// SetWithdrawFee sets the withdraw fee in stroops like the owner of the token contract does
+func (c *Chain) SetWithdrawFee(fee int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.token.withdrawFee = big.NewInt(fee)
+	c.token.withdrawFeeSet = true
+}
+
+// BalanceOf returns the token balance of an address
+func (c *Chain) BalanceOf(address common.Address) *big.Int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return new(big.Int).Set(c.balance(address))
+}
+
+// IsMintID returns true if tokens are minted for the txid
+func (c *Chain) IsMintID(txid string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.token.mintIDs[txid]
+}
+
+// Head returns the number of the last block
+func (c *Chain) Head() uint64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.head().header.Number.Uint64()
+}
+
+// Mine mines an empty block
+func (c *Chain) Mine() {
+	c.mut.Lock()
+	b := c.mine(nil)
+	c.mut.Unlock()
+	c.publish(b)
+}
+
+// SendTransaction executes a signed transaction and mines it in a new block
+// A transaction the token contract rejects is mined with a failed status, like on an EVM chain.
+func (c *Chain) SendTransaction(tx *types.Transaction) error {
+	from, err := types.Sender(types.LatestSignerForChainID(c.chainID), tx)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	if nonce := c.nonces[from]; tx.Nonce() != nonce {
+		c.mut.Unlock()
+		return fmt.Errorf("invalid nonce for %s: got %d, need %d", from.Hex(), tx.Nonce(), nonce)
+	}
+	if tx.Gas() < txGas {
+		c.mut.Unlock()
+		return fmt.Errorf("intrinsic gas too low: have %d, want %d", tx.Gas(), txGas)
+	}
+	c.nonces[from]++
+
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		TxHash:            tx.Hash(),
+		GasUsed:           txGas,
+		CumulativeGasUsed: txGas,
+		EffectiveGasPrice: tx.GasPrice(),
+	}
+	if to := tx.To(); to != nil && *to == c.contract {
+		logs, err := c.execute(from, tx.Data())
+		if err != nil {
+			receipt.Status = types.ReceiptStatusFailed
+		}
+		receipt.Logs = logs
+	}
+	b := c.mine([]*types.Receipt{receipt})
+	c.mut.Unlock()
+	c.publish(b)
+	return nil
+}
+
+// Call executes a view function of the token contract
+func (c *Chain) Call(to common.Address, input []byte) ([]byte, error) {
+	if to != c.contract {
+		return nil, nil
+	}
+	if len(input) < 4 {
+		return nil, ErrReverted
+	}
+	method, err := c.abi.MethodById(input[:4])
+	if err != nil {
+		return nil, ErrReverted
+	}
+	if !method.IsConstant() {
+		return nil, fmt.Errorf("%w: %s is not a view function", ErrReverted, method.Name)
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReverted, err)
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	switch method.Name {
+	case "GetSignaturesRequired":
+		return method.Outputs.Pack(c.token.signaturesRequired)
+	case "getSigners":
+		return method.Outputs.Pack(c.token.signers)
+	case "getWithdrawFee":
+		return method.Outputs.Pack(c.token.withdrawFee)
+	case "isWithdrawFeeSet":
+		return method.Outputs.Pack(c.token.withdrawFeeSet)
+	case "implementation":
+		// the token contract is not behind a proxy
+		return method.Outputs.Pack(c.contract)
+	case "isMintID":
+		return method.Outputs.Pack(c.token.mintIDs[args[0].(string)])
+	case "totalSupply":
+		return method.Outputs.Pack(c.token.totalSupply)
+	case "balanceOf":
+		return method.Outputs.Pack(c.balance(args[0].(common.Address)))
+	case "decimals":
+		return method.Outputs.Pack(uint8(7))
+	case "name":
+		return method.Outputs.Pack("TFT")
+	case "symbol":
+		return method.Outputs.Pack("TFT")
+	case "is_owner":
+		return method.Outputs.Pack(args[0].(common.Address) == c.token.owner)
+	}
+	return nil, fmt.Errorf("%w: %s is not supported", ErrReverted, method.Name)
+}
+
+// Code returns the code at an address
+// The code of the token contract only consists of the selectors of its functions, pushed like its dispatcher does.
+func (c *Chain) Code(address common.Address) []byte {
+	if address != c.contract {
+		return nil
+	}
+	names := make([]string, 0, len(c.abi.Methods))
+	for name := range c.abi.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	code := []byte{0x60, 0x80}
+	for _, name := range names {
+		// PUSH4 selector
+		code = append(append(code, 0x63), c.abi.Methods[name].ID...)
+	}
+	return code
+}
+
+// Nonce returns the nonce of the next transaction of an address
+func (c *Chain) Nonce(address common.Address) uint64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.nonces[address]
+}
+
+// Header returns the header of the block with the given number, nil if there is none
+func (c *Chain) Header(number uint64) *types.Header {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if number >= uint64(len(c.blocks)) {
+		return nil
+	}
+	return types.CopyHeader(c.blocks[number].header)
+}
+
+// Receipt returns the receipt of a transaction, nil if it is not mined
+func (c *Chain) Receipt(hash common.Hash) *types.Receipt {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.receipts[hash]
+}
+
+// Logs returns the logs in the blocks from from to to that match the filter
+func (c *Chain) Logs(from, to uint64, filter Filter) []*types.Log {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	logs := make([]*types.Log, 0)
+	for number := from; number <= to && number < uint64(len(c.blocks)); number++ {
+		for _, receipt := range c.blocks[number].receipts {
+			logs = append(logs, filter.match(receipt.Logs)...)
+		}
+	}
+	return logs
+}
+
+// ParseBlockNumber parses a block number in an RPC request: a hex number, latest, pending, safe, finalized or earliest
+func (c *Chain) ParseBlockNumber(number string) (uint64, error) {
+	switch number {
+	case "", "latest", "pending", "safe", "finalized":
+		return c.Head(), nil
+	case "earliest":
+		return 0, nil
+	}
+	return hexutil.DecodeUint64(number)
+}
+
+// Filter selects logs by the address of the contract and the topics
+// The topics are matched by position, an empty position matches any topic.
+type Filter struct {
+	Addresses []common.Address
+	Topics    [][]common.Hash
+}
+
+func (f Filter) match(logs []*types.Log) (matches []*types.Log) {
+	for _, l := range logs {
+		if f.matches(l) {
+			matches = append(matches, l)
+		}
+	}
+	return
+}
+
+func (f Filter) matches(l *types.Log) bool {
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, address := range f.Addresses {
+			if address == l.Address {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, options := range f.Topics {
+		if len(options) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range options {
+			if topic == l.Topics[i] {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscribeHeads sends the header of every new block to ch
+func (c *Chain) SubscribeHeads(ch chan<- *types.Header) event.Subscription {
+	return c.headFeed.Subscribe(ch)
+}
+
+// SubscribeLogs sends the logs of every new block to ch
+func (c *Chain) SubscribeLogs(ch chan<- []*types.Log) event.Subscription {
+	return c.logsFeed.Subscribe(ch)
+}
+
+func (c *Chain) head() block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// mine adds a block with the receipts, the caller holds the lock
+func (c *Chain) mine(receipts []*types.Receipt) block {
+	parent := c.head().header
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Difficulty: new(big.Int),
+		GasLimit:   blockGasLimit,
+		GasUsed:    uint64(len(receipts)) * txGas,
+		Time:       parent.Time + 1,
+	}
+	if now := uint64(time.Now().Unix()); now > header.Time {
+		header.Time = now
+	}
+	header.Bloom = types.CreateBloom(receipts)
+	hash := header.Hash()
+	logIndex := uint(0)
+	for i, receipt := range receipts {
+		receipt.BlockHash = hash
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(i)
+		for _, l := range receipt.Logs {
+			l.BlockHash = hash
+			l.BlockNumber = header.Number.Uint64()
+			l.TxHash = receipt.TxHash
+			l.TxIndex = uint(i)
+			l.Index = logIndex
+			logIndex++
+		}
+		c.receipts[receipt.TxHash] = receipt
+	}
+	b := block{header: header, receipts: receipts}
+	c.blocks = append(c.blocks, b)
+	return b
+}
+
+// publish sends a new block to the subscribers, without holding the lock
+func (c *Chain) publish(b block) {
+	c.headFeed.Send(types.CopyHeader(b.header))
+	var logs []*types.Log
+	for _, receipt := range b.receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	if len(logs) > 0 {
+		c.logsFeed.Send(logs)
+	}
+}
+
+func (c *Chain) balance(address common.Address) *big.Int {
+	if balance, ok := c.token.balances[address]; ok {
+		return balance
+	}
+	return new(big.Int)
+}
+
+// execute executes a transaction to the token contract, the caller holds the lock
+// The state is only changed if the transaction succeeds.
+func (c *Chain) execute(from common.Address, input []byte) ([]*types.Log, error) {
+	if len(input) < 4 {
+		return nil, ErrReverted
+	}
+	method, err := c.abi.MethodById(input[:4])
+	if err != nil {
+		return nil, ErrReverted
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReverted, err)
+	}
+
+	switch method.Name {
+	case "transfer":
+		to, tokens := args[0].(common.Address), args[1].(*big.Int)
+		if c.balance(from).Cmp(tokens) < 0 {
+			return nil, fmt.Errorf("%w: insufficient balance", ErrReverted)
+		}
+		c.token.balances[from] = new(big.Int).Sub(c.balance(from), tokens)
+		c.token.balances[to] = new(big.Int).Add(c.balance(to), tokens)
+		return c.event("Transfer", []common.Hash{common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, tokens)
+	case "withdraw":
+		tokens, blockchainAddress, network := args[0].(*big.Int), args[1].(string), args[2].(string)
+		if c.balance(from).Cmp(tokens) < 0 {
+			return nil, fmt.Errorf("%w: insufficient balance", ErrReverted)
+		}
+		c.token.balances[from] = new(big.Int).Sub(c.balance(from), tokens)
+		c.token.totalSupply = new(big.Int).Sub(c.token.totalSupply, tokens)
+		return c.event("Withdraw", []common.Hash{common.BytesToHash(from.Bytes())}, tokens, blockchainAddress, network)
+	case "mintTokens":
+		receiver, tokens, txid := args[0].(common.Address), args[1].(*big.Int), args[2].(string)
+		signatures := *abi.ConvertType(args[3], new([]tokenv1.Signature)).(*[]tokenv1.Signature)
+		if c.token.mintIDs[txid] {
+			return nil, fmt.Errorf("%w: TFT transacton ID already known", ErrReverted)
+		}
+		if err := c.checkSignatures(receiver, tokens, txid, signatures); err != nil {
+			return nil, err
+		}
+		c.token.mintIDs[txid] = true
+		c.token.balances[receiver] = new(big.Int).Add(c.balance(receiver), tokens)
+		c.token.totalSupply = new(big.Int).Add(c.token.totalSupply, tokens)
+		return c.event("Mint", []common.Hash{common.BytesToHash(receiver.Bytes()), crypto.Keccak256Hash([]byte(txid))}, tokens)
+	case "setSigners":
+		signers, required := args[0].([]common.Address), args[1].(*big.Int)
+		if from != c.token.owner {
+			return nil, fmt.Errorf("%w: not an owner", ErrReverted)
+		}
+		if required.Sign() <= 0 || len(signers) == 0 || required.Cmp(big.NewInt(int64(len(signers)))) > 0 {
+			return nil, fmt.Errorf("%w: invalid signers", ErrReverted)
+		}
+		c.token.signers = signers
+		c.token.signaturesRequired = required
+		return nil, nil
+	case "setWithdrawFee":
+		if from != c.token.owner {
+			return nil, fmt.Errorf("%w: not an owner", ErrReverted)
+		}
+		c.token.withdrawFee = args[0].(*big.Int)
+		c.token.withdrawFeeSet = true
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%w: %s is not supported", ErrReverted, method.Name)
+}
+
+// checkSignatures checks the signatures of a mint like the token contract does:
+// the signatures are in the order of the signers, a signature with v set to 0 is skipped
+// and every other signature has to be valid.
+func (c *Chain) checkSignatures(receiver common.Address, tokens *big.Int, txid string, signatures []tokenv1.Signature) error {
+	if len(signatures) < len(c.token.signers) {
+		return fmt.Errorf("%w: missing signatures", ErrReverted)
+	}
+	payload, err := packMintPayload(receiver, tokens, txid)
+	if err != nil {
+		return err
+	}
+	digest := crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n32"), crypto.Keccak256(payload))
+	valid := int64(0)
+	for i, signer := range c.token.signers {
+		signature := signatures[i]
+		if signature.V == 0 {
+			continue
+		}
+		sig := make([]byte, 65)
+		copy(sig, signature.R[:])
+		copy(sig[32:], signature.S[:])
+		sig[64] = signature.V - 27
+		pubkey, err := crypto.SigToPub(digest, sig)
+		if err != nil || crypto.PubkeyToAddress(*pubkey) != signer {
+			return fmt.Errorf("%w: InvalidSignature()", ErrReverted)
+		}
+		valid++
+		if valid >= c.token.signaturesRequired.Int64() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: InsufficientSignatures(%d, %d)", ErrReverted, valid, c.token.signaturesRequired)
+}
+
+// packMintPayload abi encodes the arguments of a mint like the token contract does before hashing them
+func packMintPayload(receiver common.Address, tokens *big.Int, txid string) ([]byte, error) {
+	addressTy, _ := abi.NewType("address", "", nil)
+	uintTy, _ := abi.NewType("uint256", "", nil)
+	stringTy, _ := abi.NewType("string", "", nil)
+	return abi.Arguments{{Type: addressTy}, {Type: uintTy}, {Type: stringTy}}.Pack(receiver, tokens, txid)
+}
+
+// event creates the log of an event of the token contract
+func (c *Chain) event(name string, indexed []common.Hash, args ...interface{}) ([]*types.Log, error) {
+	e := c.abi.Events[name]
+	data, err := e.Inputs.NonIndexed().Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	return []*types.Log{{
+		Address: c.contract,
+		Topics:  append([]common.Hash{e.ID}, indexed...),
+		Data:    data,
+	}}, nil
+}
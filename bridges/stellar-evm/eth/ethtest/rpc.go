@@ -0,0 +1,208 @@
+package ethtest
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ethBalance is the ether balance of every account
+var ethBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+
+// gasPrice is the gas price the chain suggests
+var gasPrice = big.NewInt(1e9)
+
+// Server serves a chain over the JSON-RPC API of an EVM node
+type Server struct {
+	// URL is the websocket url of the server
+	URL string
+
+	rpc  *rpc.Server
+	http *httptest.Server
+}
+
+// NewServer starts a JSON-RPC server for the chain, the caller closes it
+// Only the part of the eth namespace the bridge uses is served.
+func NewServer(chain *Chain) (*Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &ethAPI{chain: chain}); err != nil {
+		return nil, err
+	}
+	httpServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	return &Server{
+		URL:  "ws" + strings.TrimPrefix(httpServer.URL, "http"),
+		rpc:  server,
+		http: httpServer,
+	}, nil
+}
+
+// Close stops the server and closes the connections
+func (s *Server) Close() {
+	s.rpc.Stop()
+	s.http.Close()
+}
+
+// ethAPI is the eth namespace of the JSON-RPC API
+type ethAPI struct {
+	chain *Chain
+}
+
+// callArgs are the arguments of eth_call and eth_estimateGas
+type callArgs struct {
+	From *common.Address `json:"from"`
+	To   *common.Address `json:"to"`
+	Data hexutil.Bytes   `json:"data"`
+}
+
+// filterQuery are the arguments of eth_getLogs and of log subscriptions
+type filterQuery struct {
+	BlockHash *common.Hash     `json:"blockHash"`
+	FromBlock string           `json:"fromBlock"`
+	ToBlock   string           `json:"toBlock"`
+	Addresses []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+}
+
+func (q filterQuery) filter() Filter {
+	return Filter{Addresses: q.Addresses, Topics: q.Topics}
+}
+
+func (api *ethAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(api.chain.chainID)
+}
+
+func (api *ethAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.Head())
+}
+
+// Syncing returns false, the chain is always synced
+func (api *ethAPI) Syncing() bool {
+	return false
+}
+
+func (api *ethAPI) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(gasPrice)
+}
+
+func (api *ethAPI) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(gasPrice)
+}
+
+func (api *ethAPI) GetBalance(address common.Address, number string) *hexutil.Big {
+	return (*hexutil.Big)(ethBalance)
+}
+
+func (api *ethAPI) GetTransactionCount(address common.Address, number string) hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.Nonce(address))
+}
+
+func (api *ethAPI) GetCode(address common.Address, number string) hexutil.Bytes {
+	return api.chain.Code(address)
+}
+
+func (api *ethAPI) GetBlockByNumber(number string, fullTx bool) (*types.Header, error) {
+	n, err := api.chain.ParseBlockNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.chain.Header(n), nil
+}
+
+func (api *ethAPI) Call(args callArgs, number string) (hexutil.Bytes, error) {
+	if args.To == nil {
+		return nil, errors.New("contract creation is not supported")
+	}
+	return api.chain.Call(*args.To, args.Data)
+}
+
+// EstimateGas returns the gas every transaction uses
+func (api *ethAPI) EstimateGas(args callArgs) hexutil.Uint64 {
+	return txGas
+}
+
+func (api *ethAPI) SendRawTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), api.chain.SendTransaction(tx)
+}
+
+func (api *ethAPI) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	return api.chain.Receipt(hash)
+}
+
+func (api *ethAPI) GetLogs(query filterQuery) ([]*types.Log, error) {
+	if query.BlockHash != nil {
+		return nil, errors.New("filtering logs by block hash is not supported")
+	}
+	from, err := api.chain.ParseBlockNumber(query.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.chain.ParseBlockNumber(query.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	return api.chain.Logs(from, to, query.filter()), nil
+}
+
+// NewHeads sends the header of every new block to the subscriber
+func (api *ethAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	heads := make(chan *types.Header, 16)
+	sub := api.chain.SubscribeHeads(heads)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case head := <-heads:
+				_ = notifier.Notify(subscription.ID, head)
+			case <-subscription.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return subscription, nil
+}
+
+// Logs sends the new logs that match the query to the subscriber
+func (api *ethAPI) Logs(ctx context.Context, query filterQuery) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	filter := query.filter()
+	subscription := notifier.CreateSubscription()
+	logs := make(chan []*types.Log, 16)
+	sub := api.chain.SubscribeLogs(logs)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case batch := <-logs:
+				for _, l := range filter.match(batch) {
+					_ = notifier.Notify(subscription.ID, l)
+				}
+			case <-subscription.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return subscription, nil
+}
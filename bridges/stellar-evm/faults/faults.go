@@ -3,4 +3,20 @@ package faults
 
 import "errors"
 
-var ErrInsufficientDepositAmount = errors.New("deposited amount is <= Fee")
+var (
+	ErrInsufficientDepositAmount = errors.New("deposited amount is <= Fee")
+	// ErrAwaitingApproval is returned for a transfer that is held in the approval queue
+	ErrAwaitingApproval = errors.New("the transfer is awaiting an operator approval")
+	// ErrTransferDeferred is returned for a transfer that exceeds the transfer limits, it is retried until it fits
+	ErrTransferDeferred = errors.New("the transfer exceeds the transfer limits and is deferred")
+	// ErrTransferHandled is returned for a transfer that is refunded or returned already
+	ErrTransferHandled = errors.New("the transfer is handled already")
+	// ErrTransferRejected is returned for a transfer that is rejected by an operator
+	ErrTransferRejected = errors.New("the transfer is rejected by an operator")
+	// ErrBridgePaused is returned while the bridge is paused by an operator
+	ErrBridgePaused = errors.New("the bridge is paused")
+	// ErrBlockedAddress is returned for a mint to a blocked or reserved address
+	ErrBlockedAddress = errors.New("the address is blocked")
+	// ErrUnclaimablePayment is returned for a payment to a Stellar account that does not exist or has no TFT trustline
+	ErrUnclaimablePayment = errors.New("the destination does not exist or has no TFT trustline")
+)
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/routing"
 	"github.com/multiformats/go-multiaddr"
 	flag "github.com/spf13/pflag"
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/api/bridge"
@@ -33,8 +36,18 @@ func main() {
 
 	flag.StringVar(&stellarCfg.StellarSeed, "secret", "", "stellar secret")
 	flag.StringVar(&stellarCfg.StellarNetwork, "network", "testnet", "stellar network, testnet or production")
+	flag.StringVar(&stellarCfg.HorizonURL, "horizon", "", "url of the horizon server to use instead of the public one of the stellar network")
 	// Stellar account where fees are sent to
 	flag.StringVar(&stellarCfg.StellarFeeWallet, "feewallet", "", "stellar fee wallet address")
+	flag.StringVar(&stellarCfg.DepositAccountsFile, "depositAccounts", "", "json file mapping the IDs of muxed vault addresses and ID memos to EVM addresses")
+	// Refunds
+	flag.Int64Var(&stellarCfg.RefundPenalty, "refundPenalty", 0, "penalty in TFT deducted from refunded deposits, 0 uses the withdraw fee")
+	flag.StringVar(&stellarCfg.RefundOverridesFile, "refundOverrides", "", "json file mapping the hashes of deposits an operator decided to refund to the penalty in TFT")
+	flag.StringVar(&stellarCfg.UnrefundableDepositsFile, "unrefundableDeposits", "./unrefundabledeposits.json", "file where deposits that could not be refunded are stored for an operator to follow up")
+	flag.StringVar(&bridgeCfg.BlockedAddressesFile, "blockedAddresses", "", "json file with the EVM addresses deposits are refunded for instead of minted")
+	// Failed withdrawals
+	flag.StringVar(&bridgeCfg.FailedWithdrawalsFile, "failedWithdrawals", "./failedwithdrawals.json", "file where withdrawals that could not be paid out are stored")
+	flag.DurationVar(&bridgeCfg.ReturnFailedWithdrawalsAfter, "returnFailedWithdrawalsAfter", 24*time.Hour, "mint failed withdrawals back to the receiver after this duration, 0 retries them forever")
 
 	flag.BoolVar(&bridgeCfg.RescanBridgeAccount, "rescan", false, "if true is provided, we rescan the bridge stellar account and mint all transactions again")
 
@@ -45,9 +58,34 @@ func main() {
 	flag.StringVar(&bridgeMasterAddress, "master", "", "master stellar public address")
 	flag.Int64Var(&bridgeCfg.DepositFee, "depositFee", 50, "sets the depositfee in TFT")
 
+	// Transfer limits
+	flag.Int64Var(&bridgeCfg.TransferLimits.Hourly, "hourlyLimit", 0, "maximum amount of TFT minted or withdrawn per hour, 0 means no limit")
+	flag.Int64Var(&bridgeCfg.TransferLimits.Daily, "dailyLimit", 0, "maximum amount of TFT minted or withdrawn per day, 0 means no limit")
+	flag.Int64Var(&bridgeCfg.TransferLimits.HourlyPerAddress, "hourlyAddressLimit", 0, "maximum amount of TFT minted or withdrawn per hour to a single address, 0 means no limit")
+	flag.Int64Var(&bridgeCfg.TransferLimits.DailyPerAddress, "dailyAddressLimit", 0, "maximum amount of TFT minted or withdrawn per day to a single address, 0 means no limit")
+	// Approval queue
+	flag.StringVar(&bridgeCfg.Approver, "approver", "", "stellar address of the operator that approves transfers, if not set approvals are disabled")
+	flag.Int64Var(&bridgeCfg.ApprovalThreshold, "approvalThreshold", 0, "transfers of more than this amount of TFT need an operator approval, 0 disables the threshold")
+	flag.StringVar(&bridgeCfg.ApprovalQueueFile, "approvals", "./approvals.json", "file where transfers awaiting an operator approval are stored")
+
+	flag.StringVar(&bridgeCfg.PauseFile, "pausefile", "./pause", "the bridge is paused while this file exists")
+	flag.StringVar(&bridgeCfg.PauseHistoryFile, "pauseHistory", "./pausehistory.json", "file where the periods the bridge was paused are stored")
+	flag.Int64Var(&bridgeCfg.MaxSupplyDivergence, "maxSupplyDivergence", 0, "pause the bridge if the token supply exceeds the vault balance by more than this amount of TFT, 0 disables the check")
+
 	// P2P Configuration
 	flag.StringVar(&bridgeCfg.Psk, "psk", "", "psk for the relay")
 	flag.StringVar(&bridgeCfg.Relay, "relay", "", "relay address")
+	flag.BoolVar(&bridgeCfg.Direct, "direct", false, "connect to the other bridges directly instead of through a relay, requires a psk")
+	flag.StringSliceVar(&bridgeCfg.ListenAddresses, "listen", []string{bridge.DefaultListenAddress}, "multiaddrs to listen on for the other bridges when connecting directly")
+	flag.StringSliceVar(&bridgeCfg.Peers, "peers", nil, "multiaddrs of the other bridges, ending with their peer ID, to connect to when connecting directly")
+	flag.StringSliceVar(&bridgeCfg.AuthorizedMasters, "authorizedMasters", nil, "stellar addresses of the masters a cosigner accepts signing requests from, besides the master address")
+	flag.StringSliceVar(&bridgeCfg.ReadOnlyPeers, "readOnlyPeers", nil, "stellar addresses of the peers that can only request the status of a cosigner")
+	flag.BoolVar(&bridgeCfg.Watchdog, "watchdog", false, "let a follower watch the vault and the token contract and alert when the master does not handle transfers or asks to sign unexpected ones")
+	flag.DurationVar(&bridgeCfg.MasterSilenceTimeout, "masterSilenceTimeout", 30*time.Minute, "how long the master can leave a deposit or withdrawal unhandled before the watchdog alerts")
+	flag.DurationVar(&bridgeCfg.SignTimeout, "signTimeout", bridge.DefaultSignTimeout, "how long the master waits for the signatures of the cosigners")
+	flag.DurationVar(&bridgeCfg.CosignerTimeout, "cosignerTimeout", bridge.DefaultCosignerTimeout, "how long the master waits for a single cosigner to answer before asking it again")
+	flag.StringSliceVar(&bridgeCfg.LeaderCandidates, "leaderCandidates", nil, "stellar addresses of the bridges that can act as the master, in order of priority, enables the leader election")
+	flag.BoolVar(&bridgeCfg.RequireSignedRequests, "requireSignedRequests", false, "only accept signing requests of the signed version 2 protocol, enable once all masters are upgraded")
 
 	var debug bool
 	flag.BoolVar(&debug, "debug", false, "sets debug level log output")
@@ -68,7 +106,17 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	host, router, err := bridge.NewHost(ctx, stellarCfg.StellarSeed, bridgeCfg.Relay, bridgeCfg.Psk)
+	var host host.Host
+	var router routing.PeerRouting
+	var err error
+	switch {
+	case bridgeCfg.Direct && bridgeCfg.Relay != "":
+		err = errors.New("a relay can not be used when connecting directly")
+	case bridgeCfg.Direct:
+		host, err = bridge.NewDirectHost(stellarCfg.StellarSeed, bridgeCfg.ListenAddresses, bridgeCfg.Peers, bridgeCfg.Psk)
+	default:
+		host, router, err = bridge.NewHost(ctx, stellarCfg.StellarSeed, bridgeCfg.Relay, bridgeCfg.Psk)
+	}
 	if err != nil {
 		fmt.Println("failed to create host")
 		panic(err)
@@ -84,24 +132,41 @@ func main() {
 		log.Info("p2p node address", "address", full.String())
 	}
 
-	txStorage := stellar.NewTransactionStorage(stellarCfg.StellarNetwork, bridgeMasterAddress)
+	horizon, err := stellar.NewHorizonClient(stellarCfg.StellarNetwork, stellarCfg.HorizonURL)
+	if err != nil {
+		panic(err)
+	}
+
+	txStorage := stellar.NewTransactionStorage(stellarCfg.StellarNetwork, horizon, bridgeMasterAddress)
 	err = txStorage.ScanBridgeAccount()
 	if err != nil {
 		panic(err)
 	}
 
-	stellarWallet, err := stellar.NewWallet(&stellarCfg, bridgeCfg.DepositFee, bridge.WithdrawFee, txStorage)
+	contract, err := bridge.NewBridgeContract(&ethCfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// The withdraw fee is read from the token contract so all bridges use the same fee
+	stellarWallet, err := stellar.NewWallet(&stellarCfg, bridgeCfg.DepositFee, contract, txStorage, horizon)
 	if err != nil {
 		panic(err)
 	}
 	log.Info(fmt.Sprintf("Stellar wallet %s loaded on Stellar network %s", stellarWallet.GetAddress(), stellarCfg.StellarNetwork))
+	// A follower that is elected as the master signs for the vault as a cosigner
+	stellarWallet.SetVaultAddress(bridgeMasterAddress)
 
-	contract, err := bridge.NewBridgeContract(&ethCfg)
+	pauseSwitch, err := bridge.NewPauseSwitch(bridgeCfg.PauseFile, bridgeCfg.PauseHistoryFile)
 	if err != nil {
 		panic(err)
 	}
+	stellarWallet.SetPauseSwitch(pauseSwitch)
+
+	circuitBreaker := bridge.NewCircuitBreaker(contract, stellarWallet, pauseSwitch, bridgeCfg.MaxSupplyDivergence)
+	go circuitBreaker.Monitor(ctx)
 
-	br, err := bridge.NewBridge(ctx, stellarWallet, contract, &bridgeCfg, host, router)
+	br, err := bridge.NewBridge(ctx, stellarWallet, contract, &bridgeCfg, host, router, pauseSwitch, circuitBreaker)
 	if err != nil {
 		panic(err)
 	}
@@ -113,7 +178,16 @@ func main() {
 
 	// Start the signer server
 	if bridgeCfg.Follower {
-		err := bridge.NewSignerServer(host, bridgeMasterAddress, contract, stellarWallet, bridgeCfg.DepositFee)
+		var watchdog *bridge.Watchdog
+		if bridgeCfg.Watchdog {
+			watchdog = bridge.NewWatchdog(contract, stellarWallet, bridgeMasterAddress, &bridgeCfg)
+			go func() {
+				if err := watchdog.Run(ctx); err != nil {
+					log.Error("Watchdog stopped", "err", err)
+				}
+			}()
+		}
+		err := bridge.NewSignerServer(host, bridgeMasterAddress, contract, stellarWallet, &bridgeCfg, pauseSwitch, circuitBreaker, watchdog)
 		if err != nil {
 			panic(err)
 		}
@@ -1,13 +1,69 @@
 package multisig
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// RequestKind is the kind of transaction a StellarSignRequest asks to sign
+type RequestKind string
+
+const (
+	// KindWithdrawal pays out a withdrawal from the EVM chain, EthTxHash and LogIndex reference the Withdraw event
+	KindWithdrawal RequestKind = "withdrawal"
+	// KindRefund refunds the deposit DepositTxHash
+	KindRefund RequestKind = "refund"
+	// KindDepositFeeTransfer transfers the deposit fee of the deposit DepositTxHash to the fee wallet
+	KindDepositFeeTransfer RequestKind = "deposit-fee-transfer"
+	// KindClaim claims a claimable balance for the vault account
+	KindClaim RequestKind = "claim"
+	// KindSignerRotation replaces the cosigners of the vault account with SignerRotation
+	KindSignerRotation RequestKind = "signer-rotation"
+)
 
 type StellarSignRequest struct {
-	TxnXDR             string
+	// Kind is empty in requests of masters that do not set it yet
+	Kind   RequestKind
+	TxnXDR string
+	// RequiredSignatures is the weight the signatures of the cosigners need to add up to
 	RequiredSignatures int
 	Receiver           common.Address //TODO: How can this be an Ethereum common.Address ?
-	Block              uint64
-	Message            string //Contains the deposit transaction hash in case of a refund
+	Block              uint64         //Height of a withdrawal, only used by older cosigners
+	Message            string         //Contains the deposit transaction hash in case of a refund
+	Approval           string         //Operator approval for a withdrawal that needs one, or for a signer rotation
+	SignerRotation     *SignerRotation
+	// EthTxHash is the EVM transaction of a withdrawal
+	EthTxHash common.Hash
+	// LogIndex is the index in the block of the Withdraw log of a withdrawal
+	LogIndex uint
+	// DepositTxHash is the hex encoded hash of the Stellar deposit of a refund or deposit fee transfer
+	DepositTxHash string
+	// Penalty is the refund penalty in stroops the master deducts from a refund,
+	// cosigners refuse it if it is higher than their own refund penalty
+	Penalty int64
+}
+
+// Key identifies the request across attempts, the transaction of an attempt can differ from the one of the previous attempt
+// It is empty for requests that do not reference what they sign, like claims.
+func (r StellarSignRequest) Key() string {
+	switch r.Kind {
+	case KindWithdrawal:
+		return fmt.Sprintf("%s:%s:%d", r.Kind, r.EthTxHash.Hex(), r.LogIndex)
+	case KindRefund, KindDepositFeeTransfer:
+		if r.DepositTxHash != "" {
+			return fmt.Sprintf("%s:%s", r.Kind, r.DepositTxHash)
+		}
+	case KindSignerRotation:
+		if r.SignerRotation != nil {
+			return fmt.Sprintf("%s:%x", r.Kind, r.SignerRotation.Hash())
+		}
+	}
+	return ""
 }
 
 type StellarSignResponse struct {
@@ -16,3 +72,68 @@ type StellarSignResponse struct {
 	// The account address
 	Address string
 }
+
+// SignerRotation replaces the cosigners of the vault account and the signers of the token contract
+type SignerRotation struct {
+	// StellarSigners are the cosigners of the vault account, the master key of the vault is not changed
+	StellarSigners []string
+	// StellarWeights are the weights of the StellarSigners, a signer without a weight has a weight of 1
+	StellarWeights map[string]uint8
+	// StellarThreshold is the new medium and high threshold of the vault account
+	StellarThreshold uint8
+	EthSigners       []common.Address
+	// EthSignaturesRequired is the number of signatures the token contract requires to mint
+	EthSignaturesRequired int64
+}
+
+// Validate checks if the rotation can be executed
+func (r SignerRotation) Validate() error {
+	if len(r.StellarSigners) == 0 || len(r.EthSigners) == 0 {
+		return errors.New("the signer sets can not be empty")
+	}
+	signers := make(map[string]bool, len(r.StellarSigners))
+	// the master key of the vault also signs
+	totalWeight := 1
+	for _, signer := range r.StellarSigners {
+		signers[signer] = true
+		totalWeight += int(r.StellarWeight(signer))
+	}
+	for signer, weight := range r.StellarWeights {
+		if !signers[signer] {
+			return fmt.Errorf("%s has a weight but is not a Stellar signer", signer)
+		}
+		if weight == 0 {
+			return fmt.Errorf("the weight of %s can not be 0", signer)
+		}
+	}
+	if r.StellarThreshold == 0 || int(r.StellarThreshold) > totalWeight {
+		return fmt.Errorf("the Stellar threshold must be between 1 and %d", totalWeight)
+	}
+	if r.EthSignaturesRequired <= 0 || r.EthSignaturesRequired > int64(len(r.EthSigners)) {
+		return fmt.Errorf("the required EVM signatures must be between 1 and %d", len(r.EthSigners))
+	}
+	return nil
+}
+
+// StellarWeight returns the weight of a Stellar signer of the rotation
+func (r SignerRotation) StellarWeight(signer string) uint8 {
+	if weight, ok := r.StellarWeights[signer]; ok {
+		return weight
+	}
+	return 1
+}
+
+// Hash identifies the rotation, the order of the signers does not matter
+func (r SignerRotation) Hash() [32]byte {
+	stellarSigners := make([]string, 0, len(r.StellarSigners))
+	for _, signer := range r.StellarSigners {
+		stellarSigners = append(stellarSigners, fmt.Sprintf("%s=%d", signer, r.StellarWeight(signer)))
+	}
+	sort.Strings(stellarSigners)
+	ethSigners := make([]string, 0, len(r.EthSigners))
+	for _, signer := range r.EthSigners {
+		ethSigners = append(ethSigners, signer.Hex())
+	}
+	sort.Strings(ethSigners)
+	return sha256.Sum256([]byte(fmt.Sprintf("stellar:%s:%d:evm:%s:%d", strings.Join(stellarSigners, ","), r.StellarThreshold, strings.Join(ethSigners, ","), r.EthSignaturesRequired)))
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FailedWithdrawal is a withdrawal that could not be paid out on Stellar
+// because the destination does not exist or has no TFT trustline
+type FailedWithdrawal struct {
+	TxHash      string    `json:"txHash"`
+	Receiver    string    `json:"receiver"`
+	Destination string    `json:"destination"`
+	Amount      int64     `json:"amount"`
+	BlockHeight uint64    `json:"blockHeight"`
+	LogIndex    uint      `json:"logIndex"`
+	Failed      time.Time `json:"failed"`
+	// Rejected is set if an operator rejected the withdrawal, it is returned without trying to pay it out
+	Rejected bool `json:"rejected,omitempty"`
+	// Rejection is the operator rejection of a rejected withdrawal, the cosigners need it to return a payable withdrawal
+	Rejection string `json:"rejection,omitempty"`
+}
+
+// FailedWithdrawals stores the failed withdrawals in a file until they are paid out or returned
+type FailedWithdrawals struct {
+	location string
+	mut      sync.Mutex
+}
+
+// NewFailedWithdrawals creates new FailedWithdrawals object and returns a reference to it.
+func NewFailedWithdrawals(location string) *FailedWithdrawals {
+	return &FailedWithdrawals{
+		location: location,
+	}
+}
+
+// Add stores a failed withdrawal, a withdrawal that is already stored is not modified
+func (f *FailedWithdrawals) Add(withdrawal FailedWithdrawal) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	withdrawals, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := withdrawals[withdrawal.TxHash]; ok {
+		return nil
+	}
+	withdrawals[withdrawal.TxHash] = withdrawal
+	return f.save(withdrawals)
+}
+
+// Remove removes a failed withdrawal
+func (f *FailedWithdrawals) Remove(txHash string) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	withdrawals, err := f.load()
+	if err != nil {
+		return err
+	}
+	delete(withdrawals, txHash)
+	return f.save(withdrawals)
+}
+
+// List returns the failed withdrawals, oldest first
+func (f *FailedWithdrawals) List() ([]FailedWithdrawal, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	withdrawals, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]FailedWithdrawal, 0, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		list = append(list, withdrawal)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Failed.Before(list[j].Failed) })
+	return list, nil
+}
+
+func (f *FailedWithdrawals) load() (map[string]FailedWithdrawal, error) {
+	withdrawals := make(map[string]FailedWithdrawal)
+	file, err := os.ReadFile(f.location)
+	if os.IsNotExist(err) {
+		return withdrawals, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(file, &withdrawals)
+	return withdrawals, err
+}
+
+func (f *FailedWithdrawals) save(withdrawals map[string]FailedWithdrawal) error {
+	content, err := json.Marshal(withdrawals)
+	if err != nil {
+		return err
+	}
+	return writeFile(f.location, content)
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedWithdrawals(t *testing.T) {
+	f := NewFailedWithdrawals(filepath.Join(t.TempDir(), "failedwithdrawals.json"))
+
+	now := time.Now()
+	assert.NoError(t, f.Add(FailedWithdrawal{TxHash: "b", Amount: 100, Failed: now}))
+	assert.NoError(t, f.Add(FailedWithdrawal{TxHash: "a", Amount: 200, Failed: now.Add(-time.Hour)}))
+	// Adding an existing withdrawal does not modify it
+	assert.NoError(t, f.Add(FailedWithdrawal{TxHash: "b", Amount: 300, Failed: now}))
+
+	withdrawals, err := f.List()
+	assert.NoError(t, err)
+	assert.Len(t, withdrawals, 2)
+	assert.Equal(t, "a", withdrawals[0].TxHash)
+	assert.Equal(t, int64(100), withdrawals[1].Amount)
+
+	assert.NoError(t, f.Remove("a"))
+	withdrawals, err = f.List()
+	assert.NoError(t, err)
+	assert.Len(t, withdrawals, 1)
+
+	// The file is replaced as a whole, no temporary file is left behind
+	_, err = os.Stat(f.location + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUnrefundableDeposits(t *testing.T) {
+	u := NewUnrefundableDeposits(filepath.Join(t.TempDir(), "unrefundabledeposits.json"))
+
+	assert.NoError(t, u.Add(UnrefundableDeposit{TxHash: "a", Sender: "sender", Amount: 100, Failed: time.Now()}))
+	assert.NoError(t, u.Add(UnrefundableDeposit{TxHash: "a", Sender: "sender", Amount: 200, Failed: time.Now()}))
+
+	deposits, err := u.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []UnrefundableDeposit{{TxHash: "a", Sender: "sender", Amount: 100, Failed: deposits[0].Failed}}, deposits)
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// PausePeriod is a period the bridge was paused, End is zero while the bridge is still paused
+type PausePeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// PauseHistory stores the periods the bridge was paused in a file
+// so deposits made while paused are known after a restart.
+type PauseHistory struct {
+	location string
+	mut      sync.Mutex
+}
+
+// NewPauseHistory creates new PauseHistory object and returns a reference to it.
+func NewPauseHistory(location string) *PauseHistory {
+	return &PauseHistory{
+		location: location,
+	}
+}
+
+// List returns the stored pause periods, oldest first
+func (h *PauseHistory) List() ([]PausePeriod, error) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	var periods []PausePeriod
+	file, err := os.ReadFile(h.location)
+	if os.IsNotExist(err) {
+		return periods, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(file, &periods)
+	return periods, err
+}
+
+// Save replaces the stored pause periods
+func (h *PauseHistory) Save(periods []PausePeriod) error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	content, err := json.Marshal(periods)
+	if err != nil {
+		return err
+	}
+	return writeFile(h.location, content)
+}
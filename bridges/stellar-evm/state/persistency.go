@@ -64,5 +64,15 @@ func (b *ChainPersistency) Save(blockheight *Blockheight) error {
 		return err
 	}
 
-	return os.WriteFile(b.location, updatedPersistency, 0644)
+	return writeFile(b.location, updatedPersistency)
+}
+
+// writeFile writes the content to a temporary file first and renames it,
+// so a crash while writing does not leave a partial file behind
+func writeFile(location string, content []byte) error {
+	tmp := location + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, location)
 }
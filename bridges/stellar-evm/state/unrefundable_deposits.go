@@ -0,0 +1,81 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UnrefundableDeposit is a deposit that is not minted and could not be refunded
+// because the sender does not exist anymore or has no trustline for the refunded assets.
+// The funds stay in the vault account until an operator handles it.
+type UnrefundableDeposit struct {
+	TxHash string `json:"txHash"`
+	Sender string `json:"sender"`
+	// Amount of TFT in stroops that should have been refunded, the refund penalty deducted
+	Amount int64     `json:"amount"`
+	Failed time.Time `json:"failed"`
+}
+
+// UnrefundableDeposits stores the unrefundable deposits in a file for an operator to follow up
+type UnrefundableDeposits struct {
+	location string
+	mut      sync.Mutex
+}
+
+// NewUnrefundableDeposits creates new UnrefundableDeposits object and returns a reference to it.
+func NewUnrefundableDeposits(location string) *UnrefundableDeposits {
+	return &UnrefundableDeposits{
+		location: location,
+	}
+}
+
+// Add stores an unrefundable deposit, a deposit that is already stored is not modified
+func (u *UnrefundableDeposits) Add(deposit UnrefundableDeposit) error {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	deposits, err := u.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := deposits[deposit.TxHash]; ok {
+		return nil
+	}
+	deposits[deposit.TxHash] = deposit
+	content, err := json.Marshal(deposits)
+	if err != nil {
+		return err
+	}
+	return writeFile(u.location, content)
+}
+
+// List returns the unrefundable deposits, oldest first
+func (u *UnrefundableDeposits) List() ([]UnrefundableDeposit, error) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	deposits, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]UnrefundableDeposit, 0, len(deposits))
+	for _, deposit := range deposits {
+		list = append(list, deposit)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Failed.Before(list[j].Failed) })
+	return list, nil
+}
+
+func (u *UnrefundableDeposits) load() (map[string]UnrefundableDeposit, error) {
+	deposits := make(map[string]UnrefundableDeposit)
+	file, err := os.ReadFile(u.location)
+	if os.IsNotExist(err) {
+		return deposits, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(file, &deposits)
+	return deposits, err
+}
@@ -0,0 +1,330 @@
+package stellar
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stellar/go/clients/horizonclient"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+// NativeAsset is the representation of XLM in AssetAmount
+const NativeAsset = "native"
+
+// AssetAmount is an amount in stroops of a Stellar asset
+type AssetAmount struct {
+	// Asset is either NativeAsset or CODE:ISSUER
+	Asset  string
+	Amount int64
+}
+
+// ClaimableDeposit is a TFT claimable balance only the vault account can claim, unconditionally
+type ClaimableDeposit struct {
+	BalanceID string
+	Amount    int64
+}
+
+// DepositDetails is what the vault account received in a deposit transaction
+type DepositDetails struct {
+	// Sender is the account that made the deposit
+	Sender string
+	// TFTAmount in stroops that is paid to the vault account, including TFT received through path payments
+	TFTAmount int64
+	// ClaimableBalances are the TFT claimable balances created for the vault account
+	ClaimableBalances []ClaimableDeposit
+	// OtherAssets are the non TFT assets paid to the vault account, these are refunded
+	OtherAssets []AssetAmount
+}
+
+// TotalTFT returns the amount of TFT in stroops deposited through payments and claimable balances
+func (d DepositDetails) TotalTFT() (total int64) {
+	total = d.TFTAmount
+	for _, cb := range d.ClaimableBalances {
+		total += cb.Amount
+	}
+	return
+}
+
+func parseAsset(asset string) (txnbuild.Asset, error) {
+	if asset == NativeAsset {
+		return txnbuild.NativeAsset{}, nil
+	}
+	codeAndIssuer := strings.Split(asset, ":")
+	if len(codeAndIssuer) != 2 {
+		return nil, errors.Errorf("invalid asset %s", asset)
+	}
+	return txnbuild.CreditAsset{Code: codeAndIssuer[0], Issuer: codeAndIssuer[1]}, nil
+}
+
+// GetTFTAsset returns the TFT asset as CODE:ISSUER
+func (w *Wallet) GetTFTAsset() string {
+	assetCode, issuer := w.GetAssetCodeAndIssuer()
+	return assetCode + ":" + issuer
+}
+
+// Deposit is a payment to the vault account
+type Deposit struct {
+	// Sender is the account the deposit is paid from
+	Sender string
+	// Amount in stroops received by the vault account
+	Amount int64
+	// Asset is either NativeAsset or CODE:ISSUER
+	Asset string
+	// Memo of the transaction containing the deposit
+	Memo xdr.Memo
+	// ClaimableBalanceID is set if the deposit is a claimable balance the vault account can claim unconditionally
+	ClaimableBalanceID string
+}
+
+// ParseDeposits decodes the deposits to the vault account from the envelope and the result of a transaction
+// Payments, path payments and claimable balances with the vault as unconditional claimant are deposits.
+func ParseDeposits(tx hProtocol.Transaction, vault string) (deposits []Deposit, err error) {
+	var envelope xdr.TransactionEnvelope
+	if err = xdr.SafeUnmarshalBase64(tx.EnvelopeXdr, &envelope); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the transaction envelope")
+	}
+	var result xdr.TransactionResult
+	if err = xdr.SafeUnmarshalBase64(tx.ResultXdr, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the transaction result")
+	}
+	if !result.Successful() {
+		return
+	}
+	opResults, ok := result.OperationResults()
+	if !ok {
+		return nil, errors.New("the transaction result has no operation results")
+	}
+	operations := envelope.Operations()
+	if len(opResults) != len(operations) {
+		return nil, errors.New("the number of operation results does not match the number of operations")
+	}
+
+	txSource := envelope.SourceAccount()
+	for i, op := range operations {
+		sender := txSource.ToAccountId().Address()
+		if op.SourceAccount != nil {
+			sender = op.SourceAccount.ToAccountId().Address()
+		}
+		deposit := Deposit{Sender: sender, Memo: envelope.Memo()}
+
+		switch op.Body.Type {
+		case xdr.OperationTypePayment:
+			payment := op.Body.MustPaymentOp()
+			if payment.Destination.ToAccountId().Address() != vault {
+				continue
+			}
+			deposit.Asset = payment.Asset.StringCanonical()
+			deposit.Amount = int64(payment.Amount)
+		case xdr.OperationTypePathPaymentStrictReceive:
+			payment := op.Body.MustPathPaymentStrictReceiveOp()
+			if payment.Destination.ToAccountId().Address() != vault {
+				continue
+			}
+			deposit.Asset = payment.DestAsset.StringCanonical()
+			deposit.Amount = int64(payment.DestAmount)
+		case xdr.OperationTypePathPaymentStrictSend:
+			payment := op.Body.MustPathPaymentStrictSendOp()
+			if payment.Destination.ToAccountId().Address() != vault {
+				continue
+			}
+			// The received amount is only known from the result
+			success, ok := pathPaymentStrictSendSuccess(opResults[i])
+			if !ok {
+				return nil, errors.Errorf("operation %d has no path payment result", i)
+			}
+			deposit.Asset = payment.DestAsset.StringCanonical()
+			deposit.Amount = int64(success.Last.Amount)
+		case xdr.OperationTypeCreateClaimableBalance:
+			cb := op.Body.MustCreateClaimableBalanceOp()
+			if !isOnlyUnconditionalClaimant(cb.Claimants, vault) {
+				continue
+			}
+			balanceID, err := claimableBalanceID(opResults[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "operation %d", i)
+			}
+			deposit.Asset = cb.Asset.StringCanonical()
+			deposit.Amount = int64(cb.Amount)
+			deposit.ClaimableBalanceID = balanceID
+		default:
+			continue
+		}
+		deposits = append(deposits, deposit)
+	}
+	return
+}
+
+func pathPaymentStrictSendSuccess(result xdr.OperationResult) (success xdr.PathPaymentStrictSendResultSuccess, ok bool) {
+	tr, ok := result.GetTr()
+	if !ok {
+		return
+	}
+	pathPaymentResult, ok := tr.GetPathPaymentStrictSendResult()
+	if !ok {
+		return
+	}
+	return pathPaymentResult.GetSuccess()
+}
+
+func claimableBalanceID(result xdr.OperationResult) (string, error) {
+	tr, ok := result.GetTr()
+	if !ok {
+		return "", errors.New("no operation result")
+	}
+	cbResult, ok := tr.GetCreateClaimableBalanceResult()
+	if !ok || cbResult.BalanceId == nil {
+		return "", errors.New("no claimable balance result")
+	}
+	return xdr.MarshalHex(cbResult.BalanceId)
+}
+
+// isOnlyUnconditionalClaimant checks if account is the only claimant and can claim unconditionally,
+// otherwise the sender or someone else can claim the balance before the vault does
+func isOnlyUnconditionalClaimant(claimants []xdr.Claimant, account string) bool {
+	if len(claimants) != 1 {
+		return false
+	}
+	v0, ok := claimants[0].GetV0()
+	if !ok {
+		return false
+	}
+	return v0.Destination.Address() == account && v0.Predicate.Type == xdr.ClaimPredicateTypeClaimPredicateUnconditional
+}
+
+// GetDepositDetails returns what the vault account received in a transaction
+// The deposits are parsed from the transaction itself, no horizon calls are made.
+func (w *Wallet) GetDepositDetails(tx hProtocol.Transaction, vault string) (details DepositDetails, err error) {
+	deposits, err := ParseDeposits(tx, vault)
+	if err != nil {
+		return
+	}
+	tft := w.GetTFTAsset()
+	for _, deposit := range deposits {
+		if details.Sender == "" {
+			details.Sender = deposit.Sender
+		}
+		switch {
+		case deposit.ClaimableBalanceID != "":
+			if deposit.Asset != tft {
+				log.Warn("Ignoring a claimable balance of another asset than TFT", "tx", tx.Hash, "balance", deposit.ClaimableBalanceID, "asset", deposit.Asset)
+				continue
+			}
+			details.ClaimableBalances = append(details.ClaimableBalances, ClaimableDeposit{BalanceID: deposit.ClaimableBalanceID, Amount: deposit.Amount})
+		case deposit.Asset == tft:
+			details.TFTAmount += deposit.Amount
+		default:
+			details.OtherAssets = append(details.OtherAssets, AssetAmount{Asset: deposit.Asset, Amount: deposit.Amount})
+		}
+	}
+	return
+}
+
+// claimBalances claims the claimable balances of a deposit that are not claimed yet
+// and returns the deposit without the balances that do not exist anymore, they can never be claimed.
+func (w *Wallet) claimBalances(ctx context.Context, deposit DepositDetails) (DepositDetails, error) {
+	claimable := make([]ClaimableDeposit, 0, len(deposit.ClaimableBalances))
+	for _, cb := range deposit.ClaimableBalances {
+		claimed, err := w.TransactionStorage.ClaimableBalanceClaimed(cb.BalanceID)
+		if err != nil {
+			return deposit, err
+		}
+		if !claimed {
+			exists, err := w.claimableBalanceExists(cb.BalanceID)
+			if err != nil {
+				return deposit, err
+			}
+			if !exists {
+				log.Warn("Claimable balance of the deposit does not exist anymore, ignoring it", "balance", cb.BalanceID, "amount", StroopsToDecimal(cb.Amount))
+				continue
+			}
+			log.Info("Claiming claimable balance", "balance", cb.BalanceID, "amount", StroopsToDecimal(cb.Amount))
+			if err = w.CreateAndSubmitClaim(ctx, cb.BalanceID); err != nil {
+				return deposit, err
+			}
+		}
+		claimable = append(claimable, cb)
+	}
+	deposit.ClaimableBalances = claimable
+	return deposit, nil
+}
+
+// ClaimedDeposit returns the deposit with only the claimable balances claimed by the vault account
+// Balances that do not exist anymore without being claimed by the vault account are left out,
+// it returns an error if a balance is not claimed yet.
+func (w *Wallet) ClaimedDeposit(deposit DepositDetails) (DepositDetails, error) {
+	claimed := make([]ClaimableDeposit, 0, len(deposit.ClaimableBalances))
+	for _, cb := range deposit.ClaimableBalances {
+		ok, err := w.TransactionStorage.ClaimableBalanceClaimed(cb.BalanceID)
+		if err != nil {
+			return deposit, err
+		}
+		if ok {
+			claimed = append(claimed, cb)
+			continue
+		}
+		exists, err := w.claimableBalanceExists(cb.BalanceID)
+		if err != nil {
+			return deposit, err
+		}
+		if exists {
+			return deposit, errors.Errorf("claimable balance %s is not claimed yet", cb.BalanceID)
+		}
+	}
+	deposit.ClaimableBalances = claimed
+	return deposit, nil
+}
+
+// claimableBalanceExists checks if a claimable balance is not claimed yet by anyone
+func (w *Wallet) claimableBalanceExists(balanceID string) (bool, error) {
+	_, err := w.horizon.ClaimableBalance(balanceID)
+	if err != nil {
+		if horizonclient.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get claimable balance %s", balanceID)
+	}
+	return true, nil
+}
+
+// CreateAndSubmitClaim claims a claimable balance for the vault account
+func (w *Wallet) CreateAndSubmitClaim(ctx context.Context, balanceID string) error {
+	sourceAccount, err := w.getAccountDetails()
+	if err != nil {
+		return errors.Wrap(err, "failed to get source account")
+	}
+
+	txnBuild := txnbuild.TransactionParams{
+		Operations:           []txnbuild.Operation{&txnbuild.ClaimClaimableBalance{BalanceID: balanceID}},
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+		SourceAccount:        &sourceAccount,
+		BaseFee:              Precision,
+		IncrementSequenceNum: true,
+	}
+
+	signReq := multisig.StellarSignRequest{
+		Kind: multisig.KindClaim,
+	}
+
+	return w.signAndSubmitTransaction(ctx, txnBuild, signReq)
+}
+
+// IsClaimableDeposit checks if a claimable balance is a TFT claimable balance only the vault account can claim, unconditionally
+func (w *Wallet) IsClaimableDeposit(balanceID string, vault string) (bool, error) {
+	balance, err := w.horizon.ClaimableBalance(balanceID)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get claimable balance %s", balanceID)
+	}
+	if balance.Asset != w.GetTFTAsset() {
+		return false, nil
+	}
+	if len(balance.Claimants) != 1 {
+		return false, nil
+	}
+	claimant := balance.Claimants[0]
+	return claimant.Destination == vault && claimant.Predicate.Type == xdr.ClaimPredicateTypeClaimPredicateUnconditional, nil
+}
@@ -0,0 +1,136 @@
+package stellar
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
+)
+
+var ErrDepositAccountNotFound = errors.New("no EVM address registered for this ID")
+
+// DepositAccounts maps the IDs of muxed vault addresses and ID memos to EVM addresses
+// The mapping is a json object in a file, like {"1": "0x65e491D7b985f77e60c85105834A0332fF3002CE"},
+// so IDs can be registered without restarting the bridge.
+type DepositAccounts struct {
+	// file is empty if no IDs are registered
+	file string
+}
+
+// NewDepositAccounts creates a new DepositAccounts for the given file
+func NewDepositAccounts(file string) *DepositAccounts {
+	return &DepositAccounts{file: file}
+}
+
+// Get returns the EVM address registered for the ID
+func (d *DepositAccounts) Get(id uint64) (address eth.ERC20Address, err error) {
+	if d.file == "" {
+		err = ErrDepositAccountNotFound
+		return
+	}
+	content, err := os.ReadFile(d.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrDepositAccountNotFound
+		}
+		return
+	}
+	var accounts map[string]string
+	if err = json.Unmarshal(content, &accounts); err != nil {
+		err = errors.Wrapf(err, "failed to decode the deposit accounts in %s", d.file)
+		return
+	}
+	hexAddress, ok := accounts[strconv.FormatUint(id, 10)]
+	if !ok || !common.IsHexAddress(hexAddress) {
+		err = ErrDepositAccountNotFound
+		return
+	}
+	return eth.ERC20Address(common.HexToAddress(hexAddress)), nil
+}
+
+// GetDepositReceiver returns the EVM address a deposit to the vault account has to be minted to
+// The address is taken from, in order of precedence:
+//   - the ID of a muxed vault address the deposit is paid to, looked up in the deposit accounts
+//   - a text memo containing the base64 encoding of the address
+//   - a hash memo containing the address, right aligned
+//   - an ID memo, looked up in the deposit accounts
+func GetDepositReceiver(tx hProtocol.Transaction, vault string, accounts *DepositAccounts) (address eth.ERC20Address, err error) {
+	id, muxed, err := getMuxedDepositID(tx, vault)
+	if err != nil {
+		return
+	}
+	if muxed {
+		return accounts.Get(id)
+	}
+
+	switch tx.MemoType {
+	case "text":
+		return eth.GetErc20AddressFromB64(tx.Memo)
+	case "hash":
+		hash, decodeErr := base64.StdEncoding.DecodeString(tx.Memo)
+		if decodeErr != nil {
+			err = errors.Wrap(decodeErr, "failed to decode the hash memo")
+			return
+		}
+		return eth.GetErc20AddressFromHash(hash)
+	case "id":
+		id, err = strconv.ParseUint(tx.Memo, 10, 64)
+		if err != nil {
+			err = errors.Wrap(err, "failed to parse the ID memo")
+			return
+		}
+		return accounts.Get(id)
+	default:
+		err = errors.Errorf("memo type %s does not contain an EVM address", tx.MemoType)
+		return
+	}
+}
+
+// getMuxedDepositID returns the ID of the muxed vault address the payments and path payments in the transaction are made to
+func getMuxedDepositID(tx hProtocol.Transaction, vault string) (id uint64, muxed bool, err error) {
+	var envelope xdr.TransactionEnvelope
+	if err = xdr.SafeUnmarshalBase64(tx.EnvelopeXdr, &envelope); err != nil {
+		err = errors.Wrap(err, "failed to decode the transaction envelope")
+		return
+	}
+	for _, op := range envelope.Operations() {
+		destination, ok := paymentDestination(op)
+		if !ok || destination.Type != xdr.CryptoKeyTypeKeyTypeMuxedEd25519 {
+			continue
+		}
+		if destination.ToAccountId().Address() != vault {
+			continue
+		}
+		paymentID, idErr := destination.GetId()
+		if idErr != nil {
+			err = idErr
+			return
+		}
+		if muxed && paymentID != id {
+			err = errors.New("the transaction pays to multiple muxed vault addresses")
+			return
+		}
+		id, muxed = paymentID, true
+	}
+	return
+}
+
+// paymentDestination returns the destination of a payment or path payment operation
+func paymentDestination(op xdr.Operation) (destination xdr.MuxedAccount, ok bool) {
+	switch op.Body.Type {
+	case xdr.OperationTypePayment:
+		return op.Body.MustPaymentOp().Destination, true
+	case xdr.OperationTypePathPaymentStrictReceive:
+		return op.Body.MustPathPaymentStrictReceiveOp().Destination, true
+	case xdr.OperationTypePathPaymentStrictSend:
+		return op.Body.MustPathPaymentStrictSendOp().Destination, true
+	default:
+		return
+	}
+}
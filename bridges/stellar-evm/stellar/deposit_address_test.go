@@ -0,0 +1,109 @@
+package stellar
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/eth"
+)
+
+const testAddress = "0x65e491D7b985f77e60c85105834A0332fF3002CE"
+
+var testVault = keypair.MustRandom().Address()
+
+func depositTransaction(t *testing.T, destination string, memoType string, memo string) hProtocol.Transaction {
+	return depositOperationTransaction(t, &txnbuild.Payment{
+		Destination: destination,
+		Amount:      "100",
+		Asset:       txnbuild.NativeAsset{},
+	}, memoType, memo)
+}
+
+func depositOperationTransaction(t *testing.T, op txnbuild.Operation, memoType string, memo string) hProtocol.Transaction {
+	source := txnbuild.NewSimpleAccount(keypair.MustRandom().Address(), 1)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &source,
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{op},
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+	})
+	assert.NoError(t, err)
+	envelope, err := tx.Base64()
+	assert.NoError(t, err)
+	return hProtocol.Transaction{EnvelopeXdr: envelope, MemoType: memoType, Memo: memo}
+}
+
+func TestGetDepositReceiver(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"7": "`+testAddress+`"}`), 0644))
+	accounts := NewDepositAccounts(file)
+	expected := eth.ERC20Address(common.HexToAddress(testAddress))
+
+	// base64 encoded address in a text memo
+	tx := depositTransaction(t, testVault, "text", "ZeSR17mF935gyFEFg0oDMv8wAs4=")
+	address, err := GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	// right aligned address in a hash memo
+	hash, _ := hex.DecodeString("00000000000000000000000065e491d7b985f77e60c85105834a0332ff3002ce")
+	tx = depositTransaction(t, testVault, "hash", base64.StdEncoding.EncodeToString(hash))
+	address, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	// registered ID memo
+	tx = depositTransaction(t, testVault, "id", "7")
+	address, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	tx = depositTransaction(t, testVault, "id", "8")
+	_, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.Equal(t, ErrDepositAccountNotFound, err)
+
+	// muxed vault address with a registered ID, the memo is ignored
+	muxed, err := xdr.MuxedAccountFromAccountId(testVault, 7)
+	assert.NoError(t, err)
+	tx = depositTransaction(t, muxed.Address(), "none", "")
+	address, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	// path payments to a muxed vault address
+	tx = depositOperationTransaction(t, &txnbuild.PathPaymentStrictSend{
+		SendAsset:   txnbuild.NativeAsset{},
+		SendAmount:  "100",
+		Destination: muxed.Address(),
+		DestAsset:   txnbuild.NativeAsset{},
+		DestMin:     "1",
+	}, "none", "")
+	address, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	tx = depositOperationTransaction(t, &txnbuild.PathPaymentStrictReceive{
+		SendAsset:   txnbuild.NativeAsset{},
+		SendMax:     "100",
+		Destination: muxed.Address(),
+		DestAsset:   txnbuild.NativeAsset{},
+		DestAmount:  "1",
+	}, "none", "")
+	address, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, address)
+
+	tx = depositTransaction(t, testVault, "none", "")
+	_, err = GetDepositReceiver(tx, testVault, accounts)
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package stellar
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAsset(t *testing.T) {
+	asset, err := parseAsset(NativeAsset)
+	assert.NoError(t, err)
+	assert.Equal(t, txnbuild.NativeAsset{}, asset)
+
+	asset, err = parseAsset(TFTTest)
+	assert.NoError(t, err)
+	assert.Equal(t, "TFT", asset.GetCode())
+
+	_, err = parseAsset("TFT")
+	assert.Error(t, err)
+}
+
+func TestDepositTotalTFT(t *testing.T) {
+	deposit := DepositDetails{
+		TFTAmount:         100,
+		ClaimableBalances: []ClaimableDeposit{{BalanceID: "a", Amount: 20}, {BalanceID: "b", Amount: 5}},
+		OtherAssets:       []AssetAmount{{Asset: NativeAsset, Amount: 1000}},
+	}
+	assert.Equal(t, int64(125), deposit.TotalTFT())
+}
+
+func TestParseDeposits(t *testing.T) {
+	tft, err := parseAsset(TFTTest)
+	assert.NoError(t, err)
+	tftXDR, err := tft.ToXDR()
+	assert.NoError(t, err)
+	sender := keypair.MustRandom().Address()
+	other := keypair.MustRandom().Address()
+
+	source := txnbuild.NewSimpleAccount(sender, 1)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &source,
+		IncrementSequenceNum: true,
+		Operations: []txnbuild.Operation{
+			&txnbuild.Payment{Destination: testVault, Amount: "10", Asset: tft},
+			&txnbuild.Payment{Destination: other, Amount: "10", Asset: tft},
+			&txnbuild.PathPaymentStrictSend{SendAsset: txnbuild.NativeAsset{}, SendAmount: "100", Destination: testVault, DestAsset: tft, DestMin: "1"},
+			&txnbuild.CreateClaimableBalance{Amount: "20", Asset: tft, Destinations: []txnbuild.Claimant{txnbuild.NewClaimant(testVault, nil)}},
+			&txnbuild.Payment{Destination: testVault, Amount: "1", Asset: txnbuild.NativeAsset{}, SourceAccount: other},
+		},
+		BaseFee:       txnbuild.MinBaseFee,
+		Memo:          txnbuild.MemoText("ZeSR17mF935gyFEFg0oDMv8wAs4="),
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+	})
+	assert.NoError(t, err)
+	envelope, err := tx.Base64()
+	assert.NoError(t, err)
+
+	paymentResult := xdr.OperationResult{Code: xdr.OperationResultCodeOpInner, Tr: &xdr.OperationResultTr{
+		Type:          xdr.OperationTypePayment,
+		PaymentResult: &xdr.PaymentResult{Code: xdr.PaymentResultCodePaymentSuccess},
+	}}
+	opResults := []xdr.OperationResult{
+		paymentResult,
+		paymentResult,
+		{Code: xdr.OperationResultCodeOpInner, Tr: &xdr.OperationResultTr{
+			Type: xdr.OperationTypePathPaymentStrictSend,
+			PathPaymentStrictSendResult: &xdr.PathPaymentStrictSendResult{
+				Code:    xdr.PathPaymentStrictSendResultCodePathPaymentStrictSendSuccess,
+				Success: &xdr.PathPaymentStrictSendResultSuccess{Last: xdr.SimplePaymentResult{Destination: xdr.MustAddress(testVault), Asset: tftXDR, Amount: 50}},
+			},
+		}},
+		{Code: xdr.OperationResultCodeOpInner, Tr: &xdr.OperationResultTr{
+			Type: xdr.OperationTypeCreateClaimableBalance,
+			CreateClaimableBalanceResult: &xdr.CreateClaimableBalanceResult{
+				Code:      xdr.CreateClaimableBalanceResultCodeCreateClaimableBalanceSuccess,
+				BalanceId: &xdr.ClaimableBalanceId{Type: xdr.ClaimableBalanceIdTypeClaimableBalanceIdTypeV0, V0: &xdr.Hash{1}},
+			},
+		}},
+		paymentResult,
+	}
+	result, err := xdr.MarshalBase64(xdr.TransactionResult{
+		Result: xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxSuccess, Results: &opResults},
+	})
+	assert.NoError(t, err)
+
+	deposits, err := ParseDeposits(hProtocol.Transaction{EnvelopeXdr: envelope, ResultXdr: result}, testVault)
+	assert.NoError(t, err)
+	if !assert.Len(t, deposits, 4) {
+		return
+	}
+	assert.Equal(t, Deposit{Sender: sender, Amount: 100000000, Asset: TFTTest, Memo: deposits[0].Memo}, deposits[0])
+	assert.Equal(t, xdr.MemoTypeMemoText, deposits[0].Memo.Type)
+	assert.Equal(t, int64(50), deposits[1].Amount)
+	assert.Equal(t, TFTTest, deposits[1].Asset)
+	assert.Equal(t, int64(200000000), deposits[2].Amount)
+	assert.Equal(t, "000000000100000000000000000000000000000000000000000000000000000000000000", deposits[2].ClaimableBalanceID)
+	assert.Equal(t, other, deposits[3].Sender)
+	assert.Equal(t, NativeAsset, deposits[3].Asset)
+
+	w := &Wallet{Config: &StellarConfig{StellarNetwork: "testnet"}}
+	details, err := w.GetDepositDetails(hProtocol.Transaction{EnvelopeXdr: envelope, ResultXdr: result}, testVault)
+	assert.NoError(t, err)
+	assert.Equal(t, sender, details.Sender)
+	assert.Equal(t, int64(100000050), details.TFTAmount)
+	assert.Equal(t, int64(300000050), details.TotalTFT())
+	assert.Equal(t, []AssetAmount{{Asset: NativeAsset, Amount: 10000000}}, details.OtherAssets)
+}
+
+func TestIsOnlyUnconditionalClaimant(t *testing.T) {
+	other := keypair.MustRandom().Address()
+	claimant := func(destination string, predicate xdr.ClaimPredicate) xdr.Claimant {
+		return xdr.Claimant{Type: xdr.ClaimantTypeClaimantTypeV0, V0: &xdr.ClaimantV0{Destination: xdr.MustAddress(destination), Predicate: predicate}}
+	}
+	unconditional := xdr.ClaimPredicate{Type: xdr.ClaimPredicateTypeClaimPredicateUnconditional}
+	before := xdr.Int64(1)
+	conditional := xdr.ClaimPredicate{Type: xdr.ClaimPredicateTypeClaimPredicateBeforeAbsoluteTime, AbsBefore: &before}
+
+	assert.True(t, isOnlyUnconditionalClaimant([]xdr.Claimant{claimant(testVault, unconditional)}, testVault))
+	assert.False(t, isOnlyUnconditionalClaimant([]xdr.Claimant{claimant(testVault, conditional)}, testVault))
+	// the sender can reclaim the balance before the vault claims it
+	assert.False(t, isOnlyUnconditionalClaimant([]xdr.Claimant{claimant(testVault, unconditional), claimant(other, unconditional)}, testVault))
+}
+
+func TestClaimedDeposit(t *testing.T) {
+	w, _, _ := newTestWallet(t)
+	deposit := DepositDetails{TFTAmount: 10, ClaimableBalances: []ClaimableDeposit{{BalanceID: "a", Amount: 20}}}
+
+	// A balance that does not exist and is not claimed by the vault can never be claimed
+	claimed, err := w.ClaimedDeposit(deposit)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed.ClaimableBalances)
+	assert.Equal(t, int64(10), claimed.TotalTFT())
+
+	claimed, err = w.claimBalances(context.Background(), deposit)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), claimed.TotalTFT())
+}
@@ -0,0 +1,35 @@
+package stellar
+
+import (
+	"net/http"
+
+	"github.com/stellar/go/clients/horizonclient"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/effects"
+	"github.com/stellar/go/txnbuild"
+)
+
+// HorizonClient is the part of the Horizon API the bridge uses
+// It is implemented by *horizonclient.Client, the horizontest package has an in-memory implementation for tests.
+type HorizonClient interface {
+	AccountDetail(request horizonclient.AccountRequest) (hProtocol.Account, error)
+	Transactions(request horizonclient.TransactionRequest) (hProtocol.TransactionsPage, error)
+	Effects(request horizonclient.EffectRequest) (effects.EffectsPage, error)
+	SubmitTransaction(transaction *txnbuild.Transaction) (hProtocol.Transaction, error)
+	ClaimableBalance(id string) (hProtocol.ClaimableBalance, error)
+}
+
+var _ HorizonClient = (*horizonclient.Client)(nil)
+
+// NewHorizonClient creates a client for the Horizon server at horizonURL
+// or for the public Horizon server of the network if horizonURL is empty
+func NewHorizonClient(network string, horizonURL string) (HorizonClient, error) {
+	if horizonURL == "" {
+		client, err := GetHorizonClient(network)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+	return &horizonclient.Client{HorizonURL: horizonURL, HTTP: http.DefaultClient}, nil
+}
@@ -0,0 +1,148 @@
+package horizontest
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/stellar/go/clients/horizonclient"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/effects"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stellar/go/txnbuild"
+)
+
+// Endpoint is a Horizon endpoint the requests of a Client can be made to fail for
+type Endpoint string
+
+const (
+	EndpointAccounts          Endpoint = "accounts"
+	EndpointTransactions      Endpoint = "transactions"
+	EndpointEffects           Endpoint = "effects"
+	EndpointSubmit            Endpoint = "submit"
+	EndpointClaimableBalances Endpoint = "claimable_balances"
+)
+
+// ErrTimeout is the error of a request to a Horizon server that does not answer in time
+var ErrTimeout error = &url.Error{Op: "Get", URL: "https://horizon.test", Err: os.ErrDeadlineExceeded}
+
+// GatewayTimeout returns the error of a request Horizon could not answer in time,
+// like when its database is overloaded
+func GatewayTimeout() *horizonclient.Error {
+	return newError(problem.P{
+		Type:   "https://stellar.org/horizon-errors/timeout",
+		Title:  "Timeout",
+		Status: http.StatusGatewayTimeout,
+		Detail: "Your request timed out before completing.",
+	})
+}
+
+// Client is an in-memory Horizon client for a ledger
+// It is deterministic: requests only fail when a fault is queued for their endpoint with Fail.
+type Client struct {
+	ledger *Ledger
+
+	mut    sync.Mutex
+	faults map[Endpoint][]error
+	// transactionRequests are the requests for transactions in the order they were made
+	transactionRequests []horizonclient.TransactionRequest
+}
+
+// NewClient creates a Horizon client for the ledger
+func NewClient(ledger *Ledger) *Client {
+	return &Client{
+		ledger: ledger,
+		faults: make(map[Endpoint][]error),
+	}
+}
+
+// Fail makes the next requests to the endpoint fail, the first request with the first error and so on
+func (c *Client) Fail(endpoint Endpoint, errs ...error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.faults[endpoint] = append(c.faults[endpoint], errs...)
+}
+
+// TransactionRequests returns the requests for transactions the client received, the failed ones included
+func (c *Client) TransactionRequests() []horizonclient.TransactionRequest {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]horizonclient.TransactionRequest(nil), c.transactionRequests...)
+}
+
+// fault returns the next queued fault of the endpoint, nil if there is none
+func (c *Client) fault(endpoint Endpoint) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	faults := c.faults[endpoint]
+	if len(faults) == 0 {
+		return nil
+	}
+	c.faults[endpoint] = faults[1:]
+	return faults[0]
+}
+
+// AccountDetail returns the details of an account
+func (c *Client) AccountDetail(request horizonclient.AccountRequest) (hProtocol.Account, error) {
+	if err := c.fault(EndpointAccounts); err != nil {
+		return hProtocol.Account{}, err
+	}
+	return c.ledger.Account(request.AccountID)
+}
+
+// Transactions returns a page of the transactions of an account in ascending order
+// Only requests for the transactions of an account are supported.
+func (c *Client) Transactions(request horizonclient.TransactionRequest) (page hProtocol.TransactionsPage, err error) {
+	c.mut.Lock()
+	c.transactionRequests = append(c.transactionRequests, request)
+	c.mut.Unlock()
+	if err = c.fault(EndpointTransactions); err != nil {
+		return
+	}
+	if request.ForAccount == "" || request.Order == horizonclient.OrderDesc {
+		return page, badRequest("only the transactions of an account in ascending order are supported")
+	}
+	page.Embedded.Records, err = c.ledger.AccountTransactions(request.ForAccount, request.Cursor, pageLimit(request.Limit))
+	return
+}
+
+// Effects returns a page of the effects of an account or a transaction in ascending order
+func (c *Client) Effects(request horizonclient.EffectRequest) (page effects.EffectsPage, err error) {
+	if err = c.fault(EndpointEffects); err != nil {
+		return
+	}
+	if request.ForLedger != "" || request.ForLiquidityPool != "" || request.ForOperation != "" || request.Order == horizonclient.OrderDesc {
+		return page, badRequest("only the effects of an account or a transaction in ascending order are supported")
+	}
+	page.Embedded.Records, err = c.ledger.Effects(request.ForAccount, request.ForTransaction, request.Cursor, pageLimit(request.Limit))
+	return
+}
+
+// SubmitTransaction applies a transaction to the ledger
+func (c *Client) SubmitTransaction(transaction *txnbuild.Transaction) (hProtocol.Transaction, error) {
+	if err := c.fault(EndpointSubmit); err != nil {
+		return hProtocol.Transaction{}, err
+	}
+	envelopeXDR, err := transaction.Base64()
+	if err != nil {
+		return hProtocol.Transaction{}, err
+	}
+	return c.ledger.Submit(envelopeXDR)
+}
+
+// ClaimableBalance returns a claimable balance, the ledger has none
+func (c *Client) ClaimableBalance(id string) (hProtocol.ClaimableBalance, error) {
+	if err := c.fault(EndpointClaimableBalances); err != nil {
+		return hProtocol.ClaimableBalance{}, err
+	}
+	return hProtocol.ClaimableBalance{}, notFound()
+}
+
+// pageLimit returns the number of records in a page, Horizon returns defaultPageLimit records without a limit
+func pageLimit(limit uint) int {
+	if limit == 0 {
+		return defaultPageLimit
+	}
+	return int(limit)
+}
@@ -0,0 +1,536 @@
+// Package horizontest provides an in-memory Stellar ledger that is served over the Horizon API,
+// so the bridge can be tested without access to the Stellar network.
+package horizontest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/protocols/horizon/effects"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// NativeAsset is XLM, other assets are CODE:ISSUER
+const NativeAsset = "native"
+
+// account is the state of a Stellar account
+type account struct {
+	sequence int64
+	// balances in stroops per asset, an account has a trustline for the assets it has a balance for
+	balances map[string]int64
+	// signers with their weight, including the master key
+	signers    map[string]int32
+	thresholds hProtocol.AccountThresholds
+}
+
+// effect is an effect with the hash of the transaction that caused it
+type effect struct {
+	transaction string
+	record      effects.Effect
+}
+
+// transfer is an applied payment operation
+type transfer struct {
+	from, to, asset string
+	amount          int64
+}
+
+// Ledger is an in-memory Stellar ledger with accounts that only support payments
+// Submitted transactions are checked like on the Stellar network: the sequence numbers, the signatures
+// against the signers and thresholds of the accounts, the trustlines and the balances.
+type Ledger struct {
+	passphrase string
+	now        func() time.Time
+
+	mut      sync.Mutex
+	accounts map[string]*account
+	// transactions in the order they were applied, the paging token of a transaction is its index + 1
+	transactions []hProtocol.Transaction
+	// participants are the indexes of the transactions an account is involved in
+	participants map[string][]int
+	// effects of the transactions in the order they were applied, the paging token of an effect is its index + 1
+	effects []effect
+}
+
+// NewLedger creates an empty ledger for the network with the given passphrase
+func NewLedger(passphrase string) *Ledger {
+	return &Ledger{
+		passphrase:   passphrase,
+		now:          time.Now,
+		accounts:     make(map[string]*account),
+		participants: make(map[string][]int),
+	}
+}
+
+// CreateAccount creates an account with only the master key as signer
+func (l *Ledger) CreateAccount(address string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.accounts[address] = &account{
+		// the sequence number of a new account starts at the ledger number shifted by 32 bits
+		sequence: int64(len(l.transactions)+1) << 32,
+		balances: map[string]int64{NativeAsset: 10000 * 1e7},
+		signers:  map[string]int32{address: 1},
+	}
+}
+
+// AddTrustline lets an account hold an asset
+func (l *Ledger) AddTrustline(address string, asset string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if a, ok := l.accounts[address]; ok {
+		if _, ok := a.balances[asset]; !ok {
+			a.balances[asset] = 0
+		}
+	}
+}
+
+// Fund adds amount stroops of an asset to the balance of an account, without a transaction
+func (l *Ledger) Fund(address string, asset string, amount int64) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if a, ok := l.accounts[address]; ok {
+		a.balances[asset] += amount
+	}
+}
+
+// SetSigners replaces the signers and the thresholds of an account
+// The master key is a signer like the others, it is removed if it is not in signers.
+func (l *Ledger) SetSigners(address string, signers map[string]int32, thresholds hProtocol.AccountThresholds) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if a, ok := l.accounts[address]; ok {
+		a.signers = make(map[string]int32, len(signers))
+		for key, weight := range signers {
+			a.signers[key] = weight
+		}
+		a.thresholds = thresholds
+	}
+}
+
+// Balance returns the balance in stroops of an asset of an account
+func (l *Ledger) Balance(address string, asset string) int64 {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if a, ok := l.accounts[address]; ok {
+		return a.balances[asset]
+	}
+	return 0
+}
+
+// Account returns the details of an account like Horizon does
+func (l *Ledger) Account(address string) (hProtocol.Account, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	a, ok := l.accounts[address]
+	if !ok {
+		return hProtocol.Account{}, notFound()
+	}
+	details := hProtocol.Account{
+		ID:         address,
+		AccountID:  address,
+		Sequence:   a.sequence,
+		Thresholds: a.thresholds,
+		Data:       map[string]string{},
+	}
+	assets := make([]string, 0, len(a.balances))
+	for asset := range a.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		details.Balances = append(details.Balances, hProtocol.Balance{
+			Balance: amount.StringFromInt64(a.balances[asset]),
+			Asset:   horizonAsset(asset),
+		})
+	}
+	keys := make([]string, 0, len(a.signers))
+	for key := range a.signers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		details.Signers = append(details.Signers, hProtocol.Signer{Key: key, Weight: a.signers[key], Type: "ed25519_public_key"})
+	}
+	return details, nil
+}
+
+// AccountTransactions returns at most limit transactions an account is involved in, after the cursor, oldest first
+func (l *Ledger) AccountTransactions(address string, cursor string, limit int) ([]hProtocol.Transaction, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if _, ok := l.accounts[address]; !ok {
+		return nil, notFound()
+	}
+	records := make([]hProtocol.Transaction, 0)
+	for _, index := range l.participants[address] {
+		if index+1 <= after {
+			continue
+		}
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		records = append(records, l.transactions[index])
+	}
+	return records, nil
+}
+
+// Effects returns at most limit effects after the cursor, oldest first,
+// of the account and of the transaction with the given hash unless they are empty
+func (l *Ledger) Effects(address string, transaction string, cursor string, limit int) ([]effects.Effect, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if _, ok := l.accounts[address]; address != "" && !ok {
+		return nil, notFound()
+	}
+	records := make([]effects.Effect, 0)
+	for _, e := range l.effects[min(after, len(l.effects)):] {
+		if (address != "" && e.record.GetAccount() != address) || (transaction != "" && e.transaction != transaction) {
+			continue
+		}
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		records = append(records, e.record)
+	}
+	return records, nil
+}
+
+// Transaction returns the transaction with the given hash
+func (l *Ledger) Transaction(hash string) (hProtocol.Transaction, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for _, tx := range l.transactions {
+		if tx.Hash == hash {
+			return tx, true
+		}
+	}
+	return hProtocol.Transaction{}, false
+}
+
+// Submit applies a transaction in base64 encoded XDR to the ledger
+// A transaction that can not be applied is rejected with the result codes like Horizon does.
+func (l *Ledger) Submit(envelopeXDR string) (hProtocol.Transaction, error) {
+	loaded, err := txnbuild.TransactionFromXDR(envelopeXDR)
+	if err != nil {
+		return hProtocol.Transaction{}, malformed(err)
+	}
+	tx, ok := loaded.Transaction()
+	if !ok {
+		return hProtocol.Transaction{}, malformed(fmt.Errorf("fee bump transactions are not supported"))
+	}
+	envelope := tx.ToXDR()
+	hash, err := tx.Hash(l.passphrase)
+	if err != nil {
+		return hProtocol.Transaction{}, malformed(err)
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	source := envelope.SourceAccount().ToAccountId().Address()
+	sourceAccount, ok := l.accounts[source]
+	if !ok {
+		return hProtocol.Transaction{}, failed(envelopeXDR, "tx_no_source_account", nil)
+	}
+	if int64(envelope.SeqNum()) != sourceAccount.sequence+1 {
+		return hProtocol.Transaction{}, failed(envelopeXDR, "tx_bad_seq", nil)
+	}
+	if bounds := tx.Timebounds(); bounds.MaxTime != 0 && l.now().Unix() > bounds.MaxTime {
+		return hProtocol.Transaction{}, failed(envelopeXDR, "tx_too_late", nil)
+	}
+
+	// Every operation needs the signatures of its source account to reach the threshold of the operation
+	operations := envelope.Operations()
+	participants := map[string]bool{source: true}
+	for _, op := range operations {
+		opSource := source
+		if op.SourceAccount != nil {
+			opSource = op.SourceAccount.ToAccountId().Address()
+		}
+		participants[opSource] = true
+		a, ok := l.accounts[opSource]
+		if !ok || l.signatureWeight(a, hash, envelope.Signatures()) < requiredWeight(a, op) {
+			return hProtocol.Transaction{}, failed(envelopeXDR, "tx_bad_auth", nil)
+		}
+	}
+
+	// The operations are applied to a copy of the balances so a failing operation leaves the ledger unchanged
+	balances := make(map[string]map[string]int64)
+	balance := func(address string) map[string]int64 {
+		if b, ok := balances[address]; ok {
+			return b
+		}
+		b := make(map[string]int64, len(l.accounts[address].balances))
+		for asset, amount := range l.accounts[address].balances {
+			b[asset] = amount
+		}
+		balances[address] = b
+		return b
+	}
+	codes := make([]string, len(operations))
+	results := make([]xdr.OperationResult, len(operations))
+	failedOp := false
+	var transfers []transfer
+	for i, op := range operations {
+		opSource := source
+		if op.SourceAccount != nil {
+			opSource = op.SourceAccount.ToAccountId().Address()
+		}
+		codes[i], results[i] = "op_success", paymentResult(xdr.PaymentResultCodePaymentSuccess)
+		if op.Body.Type != xdr.OperationTypePayment {
+			codes[i], results[i] = "op_not_supported", xdr.OperationResult{Code: xdr.OperationResultCodeOpNotSupported}
+			failedOp = true
+			continue
+		}
+		payment := op.Body.MustPaymentOp()
+		destination := payment.Destination.ToAccountId().Address()
+		participants[destination] = true
+		asset := payment.Asset.StringCanonical()
+		if _, ok := l.accounts[destination]; !ok {
+			codes[i], results[i] = "op_no_destination", paymentResult(xdr.PaymentResultCodePaymentNoDestination)
+			failedOp = true
+			continue
+		}
+		from, to := balance(opSource), balance(destination)
+		if _, ok := from[asset]; !ok {
+			codes[i], results[i] = "op_src_no_trust", paymentResult(xdr.PaymentResultCodePaymentSrcNoTrust)
+			failedOp = true
+			continue
+		}
+		if _, ok := to[asset]; !ok {
+			codes[i], results[i] = "op_no_trust", paymentResult(xdr.PaymentResultCodePaymentNoTrust)
+			failedOp = true
+			continue
+		}
+		if from[asset] < int64(payment.Amount) {
+			codes[i], results[i] = "op_underfunded", paymentResult(xdr.PaymentResultCodePaymentUnderfunded)
+			failedOp = true
+			continue
+		}
+		from[asset] -= int64(payment.Amount)
+		to[asset] += int64(payment.Amount)
+		transfers = append(transfers, transfer{from: opSource, to: destination, asset: asset, amount: int64(payment.Amount)})
+	}
+	if failedOp {
+		return hProtocol.Transaction{}, failed(envelopeXDR, "tx_failed", codes)
+	}
+
+	resultXDR, err := xdr.MarshalBase64(xdr.TransactionResult{
+		FeeCharged: xdr.Int64(tx.BaseFee() * int64(len(operations))),
+		Result:     xdr.TransactionResultResult{Code: xdr.TransactionResultCodeTxSuccess, Results: &results},
+	})
+	if err != nil {
+		return hProtocol.Transaction{}, malformed(err)
+	}
+	for address, b := range balances {
+		l.accounts[address].balances = b
+	}
+	sourceAccount.sequence = int64(envelope.SeqNum())
+
+	index := len(l.transactions)
+	record := hProtocol.Transaction{
+		ID:              fmt.Sprintf("%x", hash),
+		PT:              strconv.Itoa(index + 1),
+		Successful:      true,
+		Hash:            fmt.Sprintf("%x", hash),
+		Ledger:          int32(index + 1),
+		LedgerCloseTime: l.now().UTC(),
+		Account:         source,
+		AccountSequence: int64(envelope.SeqNum()),
+		FeeAccount:      source,
+		FeeCharged:      tx.BaseFee() * int64(len(operations)),
+		MaxFee:          tx.MaxFee(),
+		OperationCount:  int32(len(operations)),
+		EnvelopeXdr:     envelopeXDR,
+		ResultXdr:       resultXDR,
+	}
+	for _, signature := range envelope.Signatures() {
+		record.Signatures = append(record.Signatures, base64.StdEncoding.EncodeToString(signature.Signature))
+	}
+	record.MemoType, record.Memo = memo(envelope.Memo())
+	l.transactions = append(l.transactions, record)
+	for address := range participants {
+		l.participants[address] = append(l.participants[address], index)
+	}
+	for _, p := range transfers {
+		l.addEffect(record, p.from, effects.EffectAccountDebited, p)
+		l.addEffect(record, p.to, effects.EffectAccountCredited, p)
+	}
+	return record, nil
+}
+
+// addEffect records that a payment debited or credited an account
+func (l *Ledger) addEffect(tx hProtocol.Transaction, address string, effectType effects.EffectType, p transfer) {
+	pt := strconv.Itoa(len(l.effects) + 1)
+	b := effects.Base{
+		ID:              pt,
+		PT:              pt,
+		Account:         address,
+		Type:            effects.EffectTypeNames[effectType],
+		TypeI:           int32(effectType),
+		LedgerCloseTime: tx.LedgerCloseTime,
+	}
+	var record effects.Effect = effects.AccountCredited{Base: b, Asset: horizonAsset(p.asset), Amount: amount.StringFromInt64(p.amount)}
+	if effectType == effects.EffectAccountDebited {
+		record = effects.AccountDebited{Base: b, Asset: horizonAsset(p.asset), Amount: amount.StringFromInt64(p.amount)}
+	}
+	l.effects = append(l.effects, effect{transaction: tx.Hash, record: record})
+}
+
+// parseCursor parses a paging token of the ledger, an empty cursor starts from the first record
+func parseCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	after, err := strconv.Atoi(cursor)
+	if err != nil || after < 0 {
+		return 0, badRequest(fmt.Sprintf("invalid cursor %s", cursor))
+	}
+	return after, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// signatureWeight returns the weight of the signers of an account that signed the transaction hash
+func (l *Ledger) signatureWeight(a *account, hash [32]byte, signatures []xdr.DecoratedSignature) (weight int32) {
+	for key, signerWeight := range a.signers {
+		kp, err := keypair.ParseAddress(key)
+		if err != nil {
+			continue
+		}
+		for _, signature := range signatures {
+			if signature.Hint == xdr.SignatureHint(kp.Hint()) && kp.Verify(hash[:], signature.Signature) == nil {
+				weight += signerWeight
+				break
+			}
+		}
+	}
+	return
+}
+
+// requiredWeight returns the weight the signatures of the source account of an operation need to reach
+// Changing the signers needs the high threshold, the other operations the medium threshold.
+// A threshold of 0 still needs a signature.
+func requiredWeight(a *account, op xdr.Operation) int32 {
+	threshold := a.thresholds.MedThreshold
+	if op.Body.Type == xdr.OperationTypeSetOptions {
+		threshold = a.thresholds.HighThreshold
+	}
+	if threshold == 0 {
+		return 1
+	}
+	return int32(threshold)
+}
+
+func paymentResult(code xdr.PaymentResultCode) xdr.OperationResult {
+	return xdr.OperationResult{Code: xdr.OperationResultCodeOpInner, Tr: &xdr.OperationResultTr{
+		Type:          xdr.OperationTypePayment,
+		PaymentResult: &xdr.PaymentResult{Code: code},
+	}}
+}
+
+// memo returns the memo type and the memo like Horizon shows them
+func memo(m xdr.Memo) (memoType string, value string) {
+	switch m.Type {
+	case xdr.MemoTypeMemoText:
+		return "text", m.MustText()
+	case xdr.MemoTypeMemoId:
+		return "id", strconv.FormatUint(uint64(m.MustId()), 10)
+	case xdr.MemoTypeMemoHash:
+		hash := m.MustHash()
+		return "hash", base64.StdEncoding.EncodeToString(hash[:])
+	case xdr.MemoTypeMemoReturn:
+		hash := m.MustRetHash()
+		return "return", base64.StdEncoding.EncodeToString(hash[:])
+	}
+	return "none", ""
+}
+
+func horizonAsset(asset string) base.Asset {
+	if asset == NativeAsset {
+		return base.Asset{Type: "native"}
+	}
+	codeAndIssuer := strings.SplitN(asset, ":", 2)
+	assetType := "credit_alphanum4"
+	if len(codeAndIssuer[0]) > 4 {
+		assetType = "credit_alphanum12"
+	}
+	return base.Asset{Type: assetType, Code: codeAndIssuer[0], Issuer: codeAndIssuer[1]}
+}
+
+// newError creates the error the Horizon client returns for a Horizon error response
+func newError(p problem.P) *horizonclient.Error {
+	return &horizonclient.Error{
+		Response: &http.Response{StatusCode: p.Status, Status: http.StatusText(p.Status)},
+		Problem:  p,
+	}
+}
+
+func notFound() *horizonclient.Error {
+	return newError(problem.P{
+		Type:   "https://stellar.org/horizon-errors/not_found",
+		Title:  "Resource Missing",
+		Status: http.StatusNotFound,
+		Detail: "The resource at the url requested was not found.",
+	})
+}
+
+func badRequest(detail string) *horizonclient.Error {
+	return newError(problem.P{
+		Type:   "https://stellar.org/horizon-errors/bad_request",
+		Title:  "Bad Request",
+		Status: http.StatusBadRequest,
+		Detail: detail,
+	})
+}
+
+func malformed(err error) *horizonclient.Error {
+	return newError(problem.P{
+		Type:   "https://stellar.org/horizon-errors/transaction_malformed",
+		Title:  "Transaction Malformed",
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	})
+}
+
+func failed(envelopeXDR string, transactionCode string, operationCodes []string) *horizonclient.Error {
+	return newError(problem.P{
+		Type:   "https://stellar.org/horizon-errors/transaction_failed",
+		Title:  "Transaction Failed",
+		Status: http.StatusBadRequest,
+		Detail: "The transaction failed when submitted to the stellar network.",
+		Extras: map[string]interface{}{
+			"envelope_xdr": envelopeXDR,
+			"result_codes": hProtocol.TransactionResultCodes{
+				TransactionCode: transactionCode,
+				OperationCodes:  operationCodes,
+			},
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package horizontest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/stellar/go/clients/horizonclient"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+)
+
+// defaultPageLimit is the number of records Horizon returns if the request has no limit
+const defaultPageLimit = 10
+
+// NewServer starts a Horizon server for the ledger, the caller closes it
+// Only the account details, the transactions of an account and the submission of transactions are served.
+func NewServer(ledger *Ledger) *httptest.Server {
+	return httptest.NewServer(Handler(ledger))
+}
+
+// Handler serves the ledger over the Horizon API
+func Handler(ledger *Ledger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == http.MethodPost && len(path) == 1 && path[0] == "transactions":
+			if err := r.ParseForm(); err != nil {
+				writeError(w, badRequest(err.Error()))
+				return
+			}
+			tx, err := ledger.Submit(r.PostForm.Get("tx"))
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, tx)
+		case r.Method == http.MethodGet && len(path) == 2 && path[0] == "accounts":
+			account, err := ledger.Account(path[1])
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, account)
+		case r.Method == http.MethodGet && len(path) == 3 && path[0] == "accounts" && path[2] == "transactions":
+			query := r.URL.Query()
+			limit := defaultPageLimit
+			if query.Get("limit") != "" {
+				var err error
+				if limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+					writeError(w, badRequest("invalid limit"))
+					return
+				}
+			}
+			records, err := ledger.AccountTransactions(path[1], query.Get("cursor"), limit)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			var page hProtocol.TransactionsPage
+			page.Embedded.Records = records
+			writeJSON(w, page)
+		default:
+			writeError(w, notFound())
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	herr, ok := err.(*horizonclient.Error)
+	if !ok {
+		herr = badRequest(err.Error())
+	}
+	w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+	w.WriteHeader(herr.Problem.Status)
+	_ = json.NewEncoder(w).Encode(herr.Problem)
+}
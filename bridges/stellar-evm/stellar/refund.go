@@ -0,0 +1,133 @@
+package stellar
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/errors"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/state"
+)
+
+// refundOverrides are the deposits an operator decided to refund, with the penalty in TFT units to deduct
+// The overrides are a json object in a file, like {"<deposit transaction hash>": 0},
+// so deposits can be added without restarting the bridge.
+type refundOverrides struct {
+	// file is empty if there are no overrides
+	file string
+}
+
+// get returns the penalty in stroops for a deposit in the override list
+func (r refundOverrides) get(depositHash string) (penalty int64, found bool, err error) {
+	if r.file == "" {
+		return
+	}
+	content, err := os.ReadFile(r.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	var overrides map[string]int64
+	if err = json.Unmarshal(content, &overrides); err != nil {
+		err = errors.Wrapf(err, "failed to decode the refund overrides in %s", r.file)
+		return
+	}
+	penalty, found = overrides[depositHash]
+	return IntToStroops(penalty), found, nil
+}
+
+// IsRefundOverride checks if an operator decided to refund the deposit
+func (w *Wallet) IsRefundOverride(depositHash string) (bool, error) {
+	_, found, err := w.refundOverrides.get(depositHash)
+	return found, err
+}
+
+// RefundPenalty returns the penalty in stroops that is deducted from the TFT of a refunded deposit
+// The penalty is paid to the fee wallet and is, in order of precedence:
+//   - the penalty in the refund override list for the deposit
+//   - the configured refund penalty
+//   - the withdraw fee
+func (w *Wallet) RefundPenalty(depositHash string) (int64, error) {
+	penalty, found, err := w.refundOverrides.get(depositHash)
+	if err != nil || found {
+		return penalty, err
+	}
+	if w.Config.RefundPenalty > 0 {
+		return IntToStroops(w.Config.RefundPenalty), nil
+	}
+	// A refund is not related to an EVM block, the latest fee is used
+	return w.withdrawFees.GetWithdrawFee(nil)
+}
+
+// refundDeposit refunds totalAmount TFT minus the refund penalty and the non TFT assets of a deposit to the sender
+func (w *Wallet) refundDeposit(ctx context.Context, totalAmount uint64, deposit DepositDetails, tx hProtocol.Transaction) {
+	penalty, err := w.RefundPenalty(tx.Hash)
+	for err != nil {
+		log.Error("error while getting the refund penalty", "err", err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+			penalty, err = w.RefundPenalty(tx.Hash)
+		}
+	}
+	w.refundDepositWithPenalty(ctx, totalAmount, penalty, deposit, tx)
+}
+
+// refundDepositWithPenalty refunds totalAmount TFT minus penalty and the non TFT assets of a deposit to the sender
+// The cosigners accept a penalty up to their own refund penalty.
+func (w *Wallet) refundDepositWithPenalty(ctx context.Context, totalAmount uint64, penalty int64, deposit DepositDetails, tx hProtocol.Transaction) {
+	var err error
+	var amount uint64
+	if totalAmount > uint64(penalty) {
+		amount = totalAmount - uint64(penalty)
+	} else {
+		penalty = 0
+		if totalAmount > 0 {
+			log.Warn("Deposited amount is less than the refund penalty, not refunding the TFT", "tx", tx.Hash)
+		}
+	}
+	if amount == 0 && len(deposit.OtherAssets) == 0 {
+		return
+	}
+	log.Info("Calling refund")
+
+	err = w.CreateAndSubmitRefund(ctx, deposit.Sender, amount, tx.Hash, penalty, deposit.OtherAssets)
+	for err != nil {
+		if err == faults.ErrUnclaimablePayment {
+			log.Warn("The sender of the deposit can not receive the refund, recording it", "tx", tx.Hash, "sender", deposit.Sender)
+			w.recordUnrefundableDeposit(tx.Hash, deposit.Sender, amount)
+			return
+		}
+		log.Error("error while refunding", "err", err.Error(), "amount", StroopsToDecimal(int64(totalAmount)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+			err = w.CreateAndSubmitRefund(ctx, deposit.Sender, amount, tx.Hash, penalty, deposit.OtherAssets)
+		}
+	}
+
+}
+
+// recordUnrefundableDeposit stores a deposit that can not be refunded so an operator can follow up
+func (w *Wallet) recordUnrefundableDeposit(txHash string, sender string, amount uint64) {
+	if w.unrefundableDeposits == nil {
+		return
+	}
+	err := w.unrefundableDeposits.Add(state.UnrefundableDeposit{
+		TxHash: txHash,
+		Sender: sender,
+		Amount: int64(amount),
+		Failed: time.Now(),
+	})
+	if err != nil {
+		log.Error("Failed to record the unrefundable deposit", "tx", txHash, "err", err)
+	}
+}
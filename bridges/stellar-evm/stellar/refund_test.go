@@ -0,0 +1,29 @@
+package stellar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefundOverrides(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "overrides.json")
+	overrides := refundOverrides{file: file}
+
+	_, found, err := overrides.get("txhash")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"txhash": 5}`), 0644))
+	penalty, found, err := overrides.get("txhash")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, IntToStroops(5), penalty)
+
+	penalty, found, err = (refundOverrides{}).get("txhash")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, int64(0), penalty)
+}
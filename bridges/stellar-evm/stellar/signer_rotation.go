@@ -0,0 +1,118 @@
+package stellar
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+// ErrSignerRotationExecuted is returned for a signer rotation that is executed already,
+// an approval of a rotation can not be used again to go back to an earlier signer set
+var ErrSignerRotationExecuted = errors.New("the signer rotation is executed already")
+
+// SignerRotationOperations returns the operations that replace the cosigners, their weights and the thresholds of the vault account.
+// The operations are sorted so the master and the cosigners create the same transaction for a rotation.
+func SignerRotationOperations(vault hProtocol.Account, rotation multisig.SignerRotation) []txnbuild.Operation {
+	newSigners := make(map[string]bool, len(rotation.StellarSigners))
+	for _, signer := range rotation.StellarSigners {
+		newSigners[signer] = true
+	}
+	weights := make(map[string]int32, len(vault.Signers))
+	for _, signer := range vault.Signers {
+		weights[signer.Key] = signer.Weight
+	}
+
+	var changed []string
+	for _, signer := range vault.Signers {
+		if signer.Key != vault.AccountID && !newSigners[signer.Key] {
+			changed = append(changed, signer.Key)
+		}
+	}
+	for signer := range newSigners {
+		if weights[signer] != int32(rotation.StellarWeight(signer)) {
+			changed = append(changed, signer)
+		}
+	}
+	sort.Strings(changed)
+
+	operations := make([]txnbuild.Operation, 0, len(changed)+1)
+	for _, signer := range changed {
+		var weight txnbuild.Threshold
+		if newSigners[signer] {
+			weight = txnbuild.Threshold(rotation.StellarWeight(signer))
+		}
+		operations = append(operations, &txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: signer, Weight: weight}})
+	}
+	operations = append(operations, &txnbuild.SetOptions{
+		MediumThreshold: txnbuild.NewThreshold(txnbuild.Threshold(rotation.StellarThreshold)),
+		HighThreshold:   txnbuild.NewThreshold(txnbuild.Threshold(rotation.StellarThreshold)),
+	})
+	return operations
+}
+
+// CreateAndSubmitSignerRotation replaces the cosigners and thresholds of the vault account
+// The approval is the operator approval of the rotation, the cosigners refuse to sign without it.
+func (w *Wallet) CreateAndSubmitSignerRotation(ctx context.Context, rotation multisig.SignerRotation, approval string) error {
+	hash := rotation.Hash()
+	executed, err := w.TransactionStorage.TransactionWithMemoExists(hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+	if executed {
+		return ErrSignerRotationExecuted
+	}
+	account, err := w.getAccountDetails()
+	if err != nil {
+		return err
+	}
+
+	txnBuild := txnbuild.TransactionParams{
+		Operations:           SignerRotationOperations(account, rotation),
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+		SourceAccount:        &account,
+		BaseFee:              Precision,
+		IncrementSequenceNum: true,
+		// The memo makes sure a rotation is only executed once
+		Memo: txnbuild.MemoHash(hash),
+	}
+
+	signReq := multisig.StellarSignRequest{
+		Kind: multisig.KindSignerRotation,
+		// Changing the signers needs the high threshold, the master signature is added by the wallet
+		RequiredSignatures: newSigningRequirements(account, account.Thresholds.HighThreshold).RequiredWeight(),
+		SignerRotation:     &rotation,
+		Approval:           approval,
+	}
+
+	return w.signAndSubmitTransaction(ctx, txnBuild, signReq)
+}
+
+// isSignerChange checks if a transaction of the vault account changes its signers or thresholds
+func isSignerChange(tx hProtocol.Transaction, vault string) bool {
+	if !tx.Successful {
+		return false
+	}
+	var envelope xdr.TransactionEnvelope
+	if err := xdr.SafeUnmarshalBase64(tx.EnvelopeXdr, &envelope); err != nil {
+		return false
+	}
+	for _, op := range envelope.Operations() {
+		if op.Body.Type != xdr.OperationTypeSetOptions {
+			continue
+		}
+		source := tx.Account
+		if op.SourceAccount != nil {
+			source = op.SourceAccount.ToAccountId().Address()
+		}
+		if source == vault {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package stellar
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+func TestSignerRotationOperations(t *testing.T) {
+	vault := keypair.MustRandom().Address()
+	kept := keypair.MustRandom().Address()
+	removed := keypair.MustRandom().Address()
+	added := keypair.MustRandom().Address()
+	account := hProtocol.Account{
+		AccountID: vault,
+		Signers: []hProtocol.Signer{
+			{Key: vault, Weight: 1},
+			{Key: kept, Weight: 1},
+			{Key: removed, Weight: 1},
+		},
+	}
+	rotation := multisig.SignerRotation{
+		StellarSigners:        []string{added, kept},
+		StellarThreshold:      2,
+		EthSigners:            []common.Address{common.HexToAddress("0x01")},
+		EthSignaturesRequired: 1,
+	}
+	assert.NoError(t, rotation.Validate())
+
+	operations := SignerRotationOperations(account, rotation)
+	assert.Len(t, operations, 3)
+	weights := make(map[string]txnbuild.Threshold)
+	for _, op := range operations[:2] {
+		signer := op.(*txnbuild.SetOptions).Signer
+		weights[signer.Address] = signer.Weight
+	}
+	assert.Equal(t, map[string]txnbuild.Threshold{added: 1, removed: 0}, weights)
+	assert.Equal(t, txnbuild.Threshold(2), *operations[2].(*txnbuild.SetOptions).HighThreshold)
+
+	// The order of the signers does not change the rotation
+	reordered := rotation
+	reordered.StellarSigners = []string{kept, added}
+	assert.Equal(t, rotation.Hash(), reordered.Hash())
+	assert.Equal(t, operations, SignerRotationOperations(account, reordered))
+
+	// The configured weights are set, also for signers that are kept
+	weighted := rotation
+	weighted.StellarWeights = map[string]uint8{kept: 2}
+	assert.NoError(t, weighted.Validate())
+	assert.NotEqual(t, rotation.Hash(), weighted.Hash())
+	operations = SignerRotationOperations(account, weighted)
+	assert.Len(t, operations, 4)
+	weights = make(map[string]txnbuild.Threshold)
+	for _, op := range operations[:3] {
+		signer := op.(*txnbuild.SetOptions).Signer
+		weights[signer.Address] = signer.Weight
+	}
+	assert.Equal(t, map[string]txnbuild.Threshold{added: 1, kept: 2, removed: 0}, weights)
+	weighted.StellarThreshold = 4
+	assert.NoError(t, weighted.Validate())
+	weighted.StellarWeights = map[string]uint8{removed: 2}
+	assert.Error(t, weighted.Validate())
+
+	rotation.StellarThreshold = 4
+	assert.Error(t, rotation.Validate())
+}
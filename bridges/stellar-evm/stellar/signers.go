@@ -0,0 +1,99 @@
+package stellar
+
+import (
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+// Signer is a cosigner of the vault account
+type Signer struct {
+	Address string
+	Weight  int
+}
+
+// SigningRequirements are the cosigners of the vault account and its medium threshold
+type SigningRequirements struct {
+	Cosigners []Signer
+	// Threshold is the weight the signatures of a transaction need to add up to
+	Threshold int
+	// MasterWeight is the weight of the master key of the vault account
+	MasterWeight int
+}
+
+func newSigningRequirements(account hProtocol.Account, threshold byte) SigningRequirements {
+	requirements := SigningRequirements{
+		Cosigners: make([]Signer, 0, len(account.Signers)),
+		Threshold: int(threshold),
+	}
+	for _, signer := range account.Signers {
+		if signer.Key == account.AccountID {
+			requirements.MasterWeight = int(signer.Weight)
+			continue
+		}
+		if signer.Weight == 0 {
+			continue
+		}
+		requirements.Cosigners = append(requirements.Cosigners, Signer{Address: signer.Key, Weight: int(signer.Weight)})
+	}
+	return requirements
+}
+
+// RequiredWeight is the weight the signatures of the cosigners need to add up to
+func (r SigningRequirements) RequiredWeight() int {
+	if r.Threshold <= r.MasterWeight {
+		return 0
+	}
+	return r.Threshold - r.MasterWeight
+}
+
+// SignedBy returns the requirements when the cosigner with the given address signs instead of the master key of the vault account
+// The cosigner is no longer asked for a signature and its weight counts like the weight of the master key.
+func (r SigningRequirements) SignedBy(address string) SigningRequirements {
+	signed := SigningRequirements{
+		Cosigners: make([]Signer, 0, len(r.Cosigners)),
+		Threshold: r.Threshold,
+	}
+	for _, cosigner := range r.Cosigners {
+		if cosigner.Address == address {
+			signed.MasterWeight = cosigner.Weight
+			continue
+		}
+		signed.Cosigners = append(signed.Cosigners, cosigner)
+	}
+	return signed
+}
+
+// Weighted returns true if not all signers have a weight of 1
+func (r SigningRequirements) Weighted() bool {
+	if r.MasterWeight != 1 {
+		return true
+	}
+	for _, cosigner := range r.Cosigners {
+		if cosigner.Weight != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Addresses returns the addresses of the cosigners
+func (r SigningRequirements) Addresses() []string {
+	addresses := make([]string, 0, len(r.Cosigners))
+	for _, cosigner := range r.Cosigners {
+		addresses = append(addresses, cosigner.Address)
+	}
+	return addresses
+}
+
+// signatureWeight returns the weight of the signatures of known cosigners, every cosigner is counted once
+func signatureWeight(signatures []multisig.StellarSignResponse, cosigners []Signer) (weight int) {
+	weights := make(map[string]int, len(cosigners))
+	for _, cosigner := range cosigners {
+		weights[cosigner.Address] = cosigner.Weight
+	}
+	for _, signature := range signatures {
+		weight += weights[signature.Address]
+		delete(weights, signature.Address)
+	}
+	return
+}
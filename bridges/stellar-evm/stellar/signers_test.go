@@ -0,0 +1,42 @@
+package stellar
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+)
+
+func TestSigningRequirements(t *testing.T) {
+	vault := keypair.MustRandom().Address()
+	heavy := keypair.MustRandom().Address()
+	light := keypair.MustRandom().Address()
+	removed := keypair.MustRandom().Address()
+	account := hProtocol.Account{
+		AccountID: vault,
+		Signers: []hProtocol.Signer{
+			{Key: vault, Weight: 1},
+			{Key: heavy, Weight: 2},
+			{Key: light, Weight: 1},
+			{Key: removed, Weight: 0},
+		},
+	}
+
+	requirements := newSigningRequirements(account, 3)
+	assert.Equal(t, []Signer{{Address: heavy, Weight: 2}, {Address: light, Weight: 1}}, requirements.Cosigners)
+	assert.Equal(t, 2, requirements.RequiredWeight())
+	assert.True(t, requirements.Weighted())
+
+	// A cosigner is only counted once, unknown signers are not counted
+	signatures := []multisig.StellarSignResponse{{Address: light}, {Address: light}, {Address: removed}}
+	assert.Equal(t, 1, signatureWeight(signatures, requirements.Cosigners))
+	signatures = append(signatures, multisig.StellarSignResponse{Address: heavy})
+	assert.Equal(t, 3, signatureWeight(signatures, requirements.Cosigners))
+
+	// A cosigner that takes over as the master only needs the signatures of the others
+	signed := requirements.SignedBy(heavy)
+	assert.Equal(t, []Signer{{Address: light, Weight: 1}}, signed.Cosigners)
+	assert.Equal(t, 1, signed.RequiredWeight())
+}
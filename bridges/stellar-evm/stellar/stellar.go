@@ -28,6 +28,9 @@ const (
 	PageLimit       = 100 // TODO: should this be public?
 )
 
+// horizonRetryDelay is how long to wait before retrying a failed Horizon request
+var horizonRetryDelay = 5 * time.Second
+
 // GetHorizonClient gets an horizon client for a specific network
 func GetHorizonClient(network string) (*horizonclient.Client, error) {
 	switch network {
@@ -69,7 +72,31 @@ func StroopsToDecimal(stroops int64) decimal.Decimal {
 	return decimalStroops.Div(decimal.NewFromInt(Precision))
 }
 
-func fetchTransactions(ctx context.Context, client *horizonclient.Client, address string, cursor string, handler func(op hProtocol.Transaction)) error {
+// streamTransactions calls the handler for the transactions of an account from the cursor on until the context is canceled
+func streamTransactions(ctx context.Context, client HorizonClient, address string, cursor string, handler func(op hProtocol.Transaction)) (err error) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		internalHandler := func(tx hProtocol.Transaction) {
+			handler(tx)
+			cursor = tx.PagingToken()
+		}
+		err = fetchTransactions(ctx, client, address, cursor, internalHandler)
+		if err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+
+	}
+}
+
+func fetchTransactions(ctx context.Context, client HorizonClient, address string, cursor string, handler func(op hProtocol.Transaction)) error {
 	timeouts := 0
 	opRequest := horizonclient.TransactionRequest{
 		ForAccount:    address,
@@ -101,7 +128,7 @@ func fetchTransactions(ctx context.Context, client *horizonclient.Client, addres
 			select {
 			case <-ctx.Done():
 				return nil
-			case <-time.After(5 * time.Second):
+			case <-time.After(horizonRetryDelay):
 				continue
 			}
 
@@ -9,6 +9,16 @@ type StellarConfig struct {
 	StellarSeed string
 	// stellar fee wallet address
 	StellarFeeWallet string
+	// file mapping the IDs of muxed vault addresses and ID memos to EVM addresses
+	DepositAccountsFile string
+	// penalty in TFT units deducted from refunded deposits, 0 uses the withdraw fee
+	RefundPenalty int64
+	// file with the deposits an operator decided to refund
+	RefundOverridesFile string
+	// file where deposits that could not be refunded are stored
+	UnrefundableDepositsFile string
+	// url of the Horizon server to use instead of the public one of the network
+	HorizonURL string
 }
 
 func (c *StellarConfig) Validate() (err error) {
@@ -6,31 +6,36 @@ import (
 	"encoding/hex"
 
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/stellar/go/clients/horizonclient"
 	hProtocol "github.com/stellar/go/protocols/horizon"
 	"github.com/stellar/go/support/errors"
 	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
 )
 
 type TransactionStorage struct {
 	network       string
 	addressToScan string
+	horizon       HorizonClient
 	// transactions is an in-memory cache of the transactions of the addressToScan account
 	transactions map[string]hProtocol.Transaction
 	// sentTransactionMemos keeps the memo's of outgoing transactions of the addressToScan account
 	// this is used to check if a withdraw, refund or feetransfer for a deposit has already occurred
 	sentTransactionMemos map[string]bool
-	stellarCursor        string
+	// claimedBalances keeps the ids of the claimable balances claimed by the addressToScan account
+	claimedBalances map[string]bool
+	stellarCursor   string
 }
 
 var ErrTransactionNotFound = errors.New("transaction not found")
 
-func NewTransactionStorage(network, addressToScan string) *TransactionStorage {
+func NewTransactionStorage(network string, horizon HorizonClient, addressToScan string) *TransactionStorage {
 	return &TransactionStorage{
 		network:              network,
+		horizon:              horizon,
 		addressToScan:        addressToScan,
 		transactions:         make(map[string]hProtocol.Transaction),
 		sentTransactionMemos: make(map[string]bool),
+		claimedBalances:      make(map[string]bool),
 	}
 }
 
@@ -85,6 +90,16 @@ func (s *TransactionStorage) TransactionWithMemoExists(memo string) (exists bool
 	return
 }
 
+// ClaimableBalanceClaimed checks if the claimable balance with the given id is claimed by the account being watched
+func (s *TransactionStorage) ClaimableBalanceClaimed(balanceID string) (claimed bool, err error) {
+	err = s.ScanBridgeAccount()
+	if err != nil {
+		return
+	}
+	_, claimed = s.claimedBalances[balanceID]
+	return
+}
+
 // StoreTransaction stores a transaction in the cache
 // If there is a memo of type hash or return
 // and the transaction is created by the account being watched ( the bridge vault account),
@@ -107,11 +122,34 @@ func (s *TransactionStorage) StoreTransaction(tx hProtocol.Transaction) {
 				}
 
 			}
+			s.storeClaimedBalances(tx)
 		}
 
 	}
 }
 
+// storeClaimedBalances remembers the claimable balances claimed in a transaction
+func (s *TransactionStorage) storeClaimedBalances(tx hProtocol.Transaction) {
+	var envelope xdr.TransactionEnvelope
+	if err := xdr.SafeUnmarshalBase64(tx.EnvelopeXdr, &envelope); err != nil {
+		log.Error("Unable to decode a transaction envelope", "tx", tx.Hash, "err", err)
+		return
+	}
+	for _, op := range envelope.Operations() {
+		claim, ok := op.Body.GetClaimClaimableBalanceOp()
+		if !ok {
+			continue
+		}
+		balanceID, err := xdr.MarshalHex(claim.BalanceId)
+		if err != nil {
+			log.Error("Unable to encode a claimable balance id", "tx", tx.Hash, "err", err)
+			continue
+		}
+		log.Debug("Remembering claimed balance", "tx", tx.Hash, "balance", balanceID)
+		s.claimedBalances[balanceID] = true
+	}
+}
+
 func (s *TransactionStorage) ScanBridgeAccount() error {
 	if s.addressToScan == "" {
 		return errors.New("no account set, aborting now")
@@ -122,17 +160,14 @@ func (s *TransactionStorage) ScanBridgeAccount() error {
 		s.stellarCursor = tx.PagingToken()
 	}
 
-	client, err := s.getHorizonClient()
-	if err != nil {
-		return err
-	}
-
 	log.Debug("start fetching stellar transactions", "account", s.addressToScan, "cursor", s.stellarCursor)
 	//TODO: we should not use the background context here
-	return fetchTransactions(context.Background(), client, s.addressToScan, s.stellarCursor, transactionHandler)
+	return fetchTransactions(context.Background(), s.horizon, s.addressToScan, s.stellarCursor, transactionHandler)
 }
 
-// GetHorizonClient gets the horizon client based on the transaction storage's network
-func (s *TransactionStorage) getHorizonClient() (*horizonclient.Client, error) {
-	return GetHorizonClient(s.network)
+// StreamTransactions calls the handler for the transactions of the scanned account from the cursor on
+// until the context is canceled. The transactions are not stored.
+func (s *TransactionStorage) StreamTransactions(ctx context.Context, cursor string, handler func(tx hProtocol.Transaction)) error {
+	log.Info("Start watching stellar account transactions", "account", s.addressToScan, "cursor", cursor)
+	return streamTransactions(ctx, s.horizon, s.addressToScan, cursor, handler)
 }
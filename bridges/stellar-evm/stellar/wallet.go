@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -20,7 +21,6 @@ import (
 
 	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
 
-	"github.com/stellar/go/protocols/horizon/effects"
 	"github.com/stellar/go/support/errors"
 	"github.com/stellar/go/txnbuild"
 )
@@ -31,19 +31,86 @@ type Wallet struct {
 	keypair            *keypair.Full
 	Config             *StellarConfig //TODO: should this be public?
 	TransactionStorage *TransactionStorage
+	horizon            HorizonClient
 	depositFee         int64
-	withdrawFee        int64
+	withdrawFees       withdrawFeeSource
+	pauseSwitch        pauseSwitch
+	depositAccounts    *DepositAccounts
+	refundOverrides    refundOverrides
+	// unrefundableDeposits is nil if no file is configured to store them
+	unrefundableDeposits *state.UnrefundableDeposits
+	// vault is the address of the bridge vault account, the address of the keypair unless a cosigner acts as the master
+	vault string
 	signerWallet
 }
+
+// withdrawFeeSource provides the withdraw fee in stroops at a block, or at the latest block if blockNumber is nil
+type withdrawFeeSource interface {
+	GetWithdrawFee(blockNumber *big.Int) (int64, error)
+}
+
+// pauseSwitch returns faults.ErrBridgePaused while the bridge is paused
+type pauseSwitch interface {
+	Check() error
+	// PausedAt returns true if the bridge was paused at the given time
+	PausedAt(t time.Time) bool
+}
+
 type signersClient interface {
 	Sign(ctx context.Context, signRequest multisig.StellarSignRequest) ([]multisig.StellarSignResponse, error)
+	// SetCosigners replaces the cosigners
+	SetCosigners(cosigners []Signer) error
 }
 type signerWallet struct {
-	client         signersClient
-	signatureCount int
+	client    signersClient
+	cosigners []Signer
+	// requiredWeight is the weight the signatures of the cosigners need to add up to
+	requiredWeight int
+	// signersMut makes sure the cosigners of the client and requiredWeight are read and updated together
+	signersMut sync.RWMutex
+	// onSignersChanged is called when the signers of the vault account change
+	onSignersChanged func()
+	// pendingTimeBounds are the time bounds of the transactions of signing requests that did not get enough signatures
+	// The next attempt builds the same transaction, unless the vault sequence changed, so the signatures stay valid.
+	pendingTimeBounds map[string]txnbuild.TimeBounds
+	pendingMut        sync.Mutex
 }
 
-func NewWallet(config *StellarConfig, depositFee int64, withdrawFee int64, stellarTransactionStorage *TransactionStorage) (*Wallet, error) {
+// pendingTimeBoundsMargin is how long the time bounds of a previous attempt need to remain valid to be reused
+const pendingTimeBoundsMargin = time.Minute
+
+// reuseTimeBounds sets the time bounds of the previous attempt of a signing request if they are still valid
+func (w *signerWallet) reuseTimeBounds(key string, txn *txnbuild.TransactionParams) {
+	w.pendingMut.Lock()
+	defer w.pendingMut.Unlock()
+	bounds, ok := w.pendingTimeBounds[key]
+	if !ok {
+		return
+	}
+	if time.Until(time.Unix(bounds.MaxTime, 0)) < pendingTimeBoundsMargin {
+		delete(w.pendingTimeBounds, key)
+		return
+	}
+	txn.Preconditions.TimeBounds = bounds
+}
+
+// keepTimeBounds stores the time bounds of an attempt that did not get enough signatures, forgetTimeBounds removes them
+func (w *signerWallet) keepTimeBounds(key string, bounds txnbuild.TimeBounds) {
+	w.pendingMut.Lock()
+	defer w.pendingMut.Unlock()
+	if w.pendingTimeBounds == nil {
+		w.pendingTimeBounds = make(map[string]txnbuild.TimeBounds)
+	}
+	w.pendingTimeBounds[key] = bounds
+}
+
+func (w *signerWallet) forgetTimeBounds(key string) {
+	w.pendingMut.Lock()
+	defer w.pendingMut.Unlock()
+	delete(w.pendingTimeBounds, key)
+}
+
+func NewWallet(config *StellarConfig, depositFee int64, withdrawFees withdrawFeeSource, stellarTransactionStorage *TransactionStorage, horizon HorizonClient) (*Wallet, error) {
 	kp, err := keypair.ParseFull(config.StellarSeed)
 
 	if err != nil {
@@ -52,10 +119,17 @@ func NewWallet(config *StellarConfig, depositFee int64, withdrawFee int64, stell
 
 	w := &Wallet{
 		keypair:            kp,
+		vault:              kp.Address(),
 		Config:             config,
 		TransactionStorage: stellarTransactionStorage,
+		horizon:            horizon,
 		depositFee:         depositFee,
-		withdrawFee:        withdrawFee,
+		withdrawFees:       withdrawFees,
+		depositAccounts:    NewDepositAccounts(config.DepositAccountsFile),
+		refundOverrides:    refundOverrides{file: config.RefundOverridesFile},
+	}
+	if config.UnrefundableDepositsFile != "" {
+		w.unrefundableDeposits = state.NewUnrefundableDeposits(config.UnrefundableDepositsFile)
 	}
 
 	return w, nil
@@ -65,42 +139,110 @@ func (w *Wallet) GetAddress() string {
 	return w.keypair.Address()
 }
 
-func (w *Wallet) GetSigningRequirements() (cosigners []string, requiredSignatures int, err error) {
+// GetVaultAddress returns the address of the bridge vault account
+func (w *Wallet) GetVaultAddress() string {
+	return w.vault
+}
+
+// SetVaultAddress sets the address of the bridge vault account if it differs from the address of the wallet,
+// like for a cosigner that takes over as the master.
+// The signature of the wallet then counts with its weight as a cosigner of the vault account.
+func (w *Wallet) SetVaultAddress(address string) {
+	w.vault = address
+}
+
+// GetSigningRequirements returns the cosigners of the vault account with their weights and the medium threshold
+func (w *Wallet) GetSigningRequirements() (requirements SigningRequirements, err error) {
 	account, err := w.getAccountDetails()
 	if err != nil {
 		return
 	}
-	cosigners = make([]string, 0, len(account.Signers))
-	for _, signer := range account.Signers {
-		if signer.Key == w.GetAddress() {
-			continue
+	return newSigningRequirements(account, account.Thresholds.MedThreshold), nil
+}
+
+// SetSigners updates the cosigners of the signer client and the required signature weight together
+// Signing rounds that are in progress finish with the previous signers.
+func (w *Wallet) SetSigners(requirements SigningRequirements) error {
+	w.signersMut.Lock()
+	defer w.signersMut.Unlock()
+	if w.vault != w.GetAddress() {
+		requirements = requirements.SignedBy(w.GetAddress())
+	}
+	if w.client != nil {
+		if err := w.client.SetCosigners(requirements.Cosigners); err != nil {
+			return err
 		}
-		cosigners = append(cosigners, signer.Key)
 	}
-	requiredSignatures = int(account.Thresholds.MedThreshold)
-
-	return
-}
-func (w *Wallet) SetRequiredSignatures(requiredSignatures int) {
-	w.signatureCount = requiredSignatures - 1
+	w.cosigners = requirements.Cosigners
+	w.requiredWeight = requirements.RequiredWeight()
+	return nil
 }
 func (w *Wallet) SetSignerClient(client signersClient) {
 
 	w.client = client
 }
 
+// SetSignersChangedHandler sets a function that is called when the signers of the vault account change
+func (w *Wallet) SetSignersChangedHandler(handler func()) {
+	w.onSignersChanged = handler
+}
+
+// SetPauseSwitch makes the wallet stop processing deposits and submitting transactions while the bridge is paused
+func (w *Wallet) SetPauseSwitch(p pauseSwitch) {
+	w.pauseSwitch = p
+}
+
+func (w *Wallet) checkPaused() error {
+	if w.pauseSwitch == nil {
+		return nil
+	}
+	return w.pauseSwitch.Check()
+}
+
+// waitUntilResumed blocks while the bridge is paused
+// It returns false if the context is cancelled before the bridge is resumed.
+func (w *Wallet) waitUntilResumed(ctx context.Context) bool {
+	for w.checkPaused() != nil {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Second):
+		}
+	}
+	return true
+}
+
+// SignMessage signs an arbitrary message with the key of the wallet
+func (w *Wallet) SignMessage(message []byte) ([]byte, error) {
+	return w.keypair.Sign(message)
+}
+
 // Sign returns a new Transaction instance which extends the current instance
 // with a signature from this wallet.
 func (w *Wallet) Sign(tx *txnbuild.Transaction) (*txnbuild.Transaction, error) {
 	return tx.Sign(w.GetNetworkPassPhrase(), w.keypair)
 }
 
-func (w *Wallet) CreateAndSubmitPayment(ctx context.Context, target string, amount uint64, receiver common.Address, blockheight uint64, txHash common.Hash, message string, includeWithdrawFee bool) (err error) {
-	if !IsValidStellarAddress(target) {
-		log.Warn("Invalid address, skipping payment", "address", target)
+// CreateAndSubmitPayment pays out a withdrawal
+// If withdrawFee is larger than 0, it is paid to the fee wallet in the same transaction.
+// The approval is passed to the cosigners if the withdrawal needed an operator approval.
+// The target is the blockchain address of the withdrawal, see ParseWithdrawalDestination.
+// txHash and logIndex reference the Withdraw event on the EVM chain.
+// faults.ErrUnclaimablePayment is returned if the target can not receive TFT.
+func (w *Wallet) CreateAndSubmitPayment(ctx context.Context, target string, amount uint64, receiver common.Address, blockheight uint64, txHash common.Hash, logIndex uint, withdrawFee int64, approval string) (err error) {
+	payable, err := w.IsPayable(target)
+	if err != nil {
+		return
+	}
+	if !payable {
+		log.Warn("The destination can not receive TFT, skipping payment", "address", target)
+		return faults.ErrUnclaimablePayment
+	}
+	destination, _, err := ParseWithdrawalDestination(target)
+	if err != nil {
 		return
 	}
-	txnBuild, err := w.generatePaymentOperation(amount, target, includeWithdrawFee)
+	txnBuild, err := w.generatePaymentOperation(amount, destination, withdrawFee)
 	if err != nil {
 		return
 	}
@@ -108,18 +250,30 @@ func (w *Wallet) CreateAndSubmitPayment(ctx context.Context, target string, amou
 	txnBuild.Memo = txnbuild.MemoHash(txHash)
 
 	signReq := multisig.StellarSignRequest{
-		RequiredSignatures: w.signatureCount,
-		Receiver:           receiver,
-		Block:              blockheight,
-		Message:            message,
+		Kind:      multisig.KindWithdrawal,
+		Receiver:  receiver,
+		Block:     blockheight,
+		Approval:  approval,
+		EthTxHash: txHash,
+		LogIndex:  logIndex,
 	}
 
 	return w.signAndSubmitTransaction(ctx, txnBuild, signReq)
 }
 
 // CreateAndSubmitRefund refunds a deposit for the transaction txToRefund ( hexadecimal representation of the transaction hash)
-func (w *Wallet) CreateAndSubmitRefund(ctx context.Context, target string, amount uint64, txToRefund string, includeWithdrawFee bool) (err error) {
-	txnBuild, err := w.generatePaymentOperation(amount, target, includeWithdrawFee)
+// amount is the TFT to refund, otherAssets are the non TFT assets to refund in the same transaction.
+// If penalty is larger than 0, it is paid to the fee wallet in the same transaction.
+func (w *Wallet) CreateAndSubmitRefund(ctx context.Context, target string, amount uint64, txToRefund string, penalty int64, otherAssets []AssetAmount) (err error) {
+	var payments []AssetAmount
+	if amount > 0 {
+		payments = append(payments, AssetAmount{Asset: w.GetTFTAsset(), Amount: int64(amount)})
+	}
+	payments = append(payments, otherAssets...)
+	if len(payments) == 0 {
+		return errors.New("nothing to refund")
+	}
+	txnBuild, err := w.generatePaymentOperations(target, payments, penalty)
 	if err != nil {
 		return
 	}
@@ -135,37 +289,48 @@ func (w *Wallet) CreateAndSubmitRefund(ctx context.Context, target string, amoun
 	txnBuild.Memo = txnbuild.MemoReturn([32]byte(txToRefundAsBytes))
 
 	signReq := multisig.StellarSignRequest{
-		RequiredSignatures: w.signatureCount,
-		Message:            txToRefund,
+		Kind:          multisig.KindRefund,
+		Message:       txToRefund,
+		DepositTxHash: txToRefund,
+		Penalty:       penalty,
 	}
 
 	return w.signAndSubmitTransaction(ctx, txnBuild, signReq)
 }
 
-// CreateAndSubmitFeepayment creates and submites a payment to the fee wallet
-// only an amount and hash needs to be specified
-func (w *Wallet) CreateAndSubmitFeepayment(ctx context.Context, amount uint64, txHash [32]byte) error {
-
-	txnBuild, err := w.generatePaymentOperation(amount, w.Config.StellarFeeWallet, false)
+// CreateAndSubmitFeepayment creates and submites a payment to the fee wallet for the deposit txHash
+// The otherAssets of the deposit are refunded to sender in the same transaction,
+// so they are not mistaken for each other through their memo.
+func (w *Wallet) CreateAndSubmitFeepayment(ctx context.Context, amount uint64, txHash [32]byte, sender string, otherAssets []AssetAmount) error {
+	if amount == 0 {
+		return errors.New("invalid amount")
+	}
+	txnBuild, err := w.generatePaymentOperations(sender, otherAssets, int64(amount))
 	if err != nil {
-		return errors.Wrap(err, "failed to generate payment operation")
+		return errors.Wrap(err, "failed to generate payment operations")
 	}
 
 	txnBuild.Memo = txnbuild.MemoHash(txHash)
 
 	signReq := multisig.StellarSignRequest{
-		RequiredSignatures: w.signatureCount,
+		Kind:          multisig.KindDepositFeeTransfer,
+		DepositTxHash: hex.EncodeToString(txHash[:]),
 	}
 
 	return w.signAndSubmitTransaction(ctx, txnBuild, signReq)
 }
 
-func (w *Wallet) generatePaymentOperation(amount uint64, destination string, includeWithdrawFee bool) (txnbuild.TransactionParams, error) {
+func (w *Wallet) generatePaymentOperation(amount uint64, destination string, withdrawFee int64) (txnbuild.TransactionParams, error) {
 	// if amount is zero, do nothing
 	if amount == 0 {
 		return txnbuild.TransactionParams{}, errors.New("invalid amount")
 	}
+	return w.generatePaymentOperations(destination, []AssetAmount{{Asset: w.GetTFTAsset(), Amount: int64(amount)}}, withdrawFee)
+}
 
+// generatePaymentOperations creates a transaction with a payment to destination for every asset amount
+// If withdrawFee is larger than 0, it is paid in TFT to the fee wallet in the same transaction.
+func (w *Wallet) generatePaymentOperations(destination string, payments []AssetAmount, withdrawFee int64) (txnbuild.TransactionParams, error) {
 	sourceAccount, err := w.getAccountDetails()
 	if err != nil {
 		return txnbuild.TransactionParams{}, errors.Wrap(err, "failed to get source account")
@@ -174,21 +339,24 @@ func (w *Wallet) generatePaymentOperation(amount uint64, destination string, inc
 	assetCode, issuer := w.GetAssetCodeAndIssuer()
 
 	var paymentOperations []txnbuild.Operation
-	paymentOP := txnbuild.Payment{
-		Destination: destination,
-		Amount:      big.NewRat(int64(amount), Precision).FloatString(PrecisionDigits),
-		Asset: txnbuild.CreditAsset{
-			Code:   assetCode,
-			Issuer: issuer,
-		},
-		SourceAccount: sourceAccount.AccountID,
-	}
-	paymentOperations = append(paymentOperations, &paymentOP)
-
-	if includeWithdrawFee {
+	for _, payment := range payments {
+		asset, err := parseAsset(payment.Asset)
+		if err != nil {
+			return txnbuild.TransactionParams{}, err
+		}
+		paymentOP := txnbuild.Payment{
+			Destination:   destination,
+			Amount:        big.NewRat(payment.Amount, Precision).FloatString(PrecisionDigits),
+			Asset:         asset,
+			SourceAccount: sourceAccount.AccountID,
+		}
+		paymentOperations = append(paymentOperations, &paymentOP)
+	}
+
+	if withdrawFee > 0 {
 		feePaymentOP := txnbuild.Payment{
 			Destination: w.Config.StellarFeeWallet,
-			Amount:      big.NewRat(w.withdrawFee, Precision).FloatString(PrecisionDigits),
+			Amount:      big.NewRat(withdrawFee, Precision).FloatString(PrecisionDigits),
 			Asset: txnbuild.CreditAsset{
 				Code:   assetCode,
 				Issuer: issuer,
@@ -212,6 +380,14 @@ func (w *Wallet) generatePaymentOperation(amount uint64, destination string, inc
 // signAndSubmitTransaction gathers signatures from cosigners if required and submits the transaction to the Stellar network
 // If there already is a transaction with the same memo hash, no new transaction is created and submitted.
 func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.TransactionParams, signReq multisig.StellarSignRequest) (err error) {
+	if err = w.checkPaused(); err != nil {
+		return
+	}
+	// a retry signs the same transaction as the previous attempt
+	key := signReq.Key()
+	if key != "" {
+		w.reuseTimeBounds(key, &txn)
+	}
 	tx, err := txnbuild.NewTransaction(txn)
 	if err != nil {
 		return errors.Wrap(err, "failed to build transaction")
@@ -230,11 +406,19 @@ func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.Tran
 
 	if exists {
 		log.Info("Transaction with this memo already executed, skipping")
+		w.forgetTimeBounds(key)
 		return
 	}
 
+	w.signersMut.RLock()
+	defer w.signersMut.RUnlock()
+	// A signer rotation needs the high threshold, other transactions the medium threshold
+	if signReq.Kind != multisig.KindSignerRotation {
+		signReq.RequiredSignatures = w.requiredWeight
+	}
+
 	// Only try to request signatures if there are signatures required
-	if w.signatureCount > 0 {
+	if signReq.RequiredSignatures > 0 {
 		xdr, err := tx.Base64()
 		if err != nil {
 			return errors.Wrap(err, "failed to serialize transaction")
@@ -243,11 +427,15 @@ func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.Tran
 
 		signatures, err := w.client.Sign(ctx, signReq)
 		if err != nil {
+			if key != "" {
+				w.keepTimeBounds(key, txn.Preconditions.TimeBounds)
+			}
 			return err
 		}
+		w.forgetTimeBounds(key)
 
-		if len(signatures) < w.signatureCount {
-			return fmt.Errorf("received %d signatures, need %d", len(signatures), w.signatureCount)
+		if weight := signatureWeight(signatures, w.cosigners); weight < signReq.RequiredSignatures {
+			return fmt.Errorf("received signatures with a weight of %d, need %d", weight, signReq.RequiredSignatures)
 		}
 
 		for _, signature := range signatures {
@@ -267,11 +455,7 @@ func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.Tran
 
 	// Submit the transaction
 
-	client, err := w.GetHorizonClient()
-	if err != nil {
-		return errors.Wrap(err, "failed to get horizon client")
-	}
-	txResult, err := client.SubmitTransaction(tx)
+	txResult, err := w.horizon.SubmitTransaction(tx)
 	if err != nil {
 		if hError, ok := err.(*horizonclient.Error); ok {
 			resultcodes, err := hError.ResultCodes()
@@ -282,11 +466,11 @@ func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.Tran
 				for _, resultcode := range resultcodes.OperationCodes {
 					if resultcode == "op_no_destination" {
 						log.Warn("Invalid address, skipping")
-						return nil
+						return faults.ErrUnclaimablePayment
 					}
 					if resultcode == "op_no_trust" {
 						log.Warn("Destination address has no TFT trustline, skipping")
-						return nil
+						return faults.ErrUnclaimablePayment
 					}
 				}
 			}
@@ -302,28 +486,6 @@ func (w *Wallet) signAndSubmitTransaction(ctx context.Context, txn txnbuild.Tran
 	return
 }
 
-// sender is the account that made the deposit
-func (w *Wallet) refundDeposit(ctx context.Context, totalAmount uint64, sender string, tx hProtocol.Transaction) {
-	if totalAmount <= uint64(w.withdrawFee) {
-		log.Warn("Deposited amount is less than the withdraw fee, not refunding", "tx", tx.Hash)
-		return
-	}
-	amount := totalAmount - uint64(w.withdrawFee)
-	log.Info("Calling refund")
-
-	err := w.CreateAndSubmitRefund(ctx, sender, amount, tx.Hash, true)
-	for err != nil {
-		log.Error("error while refunding", "err", err.Error(), "amount", StroopsToDecimal(int64(totalAmount)))
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(10 * time.Second):
-			err = w.CreateAndSubmitRefund(ctx, tx.Account, amount, tx.Hash, true)
-		}
-	}
-
-}
-
 // mint handler
 type mint func(eth.ERC20Address, *big.Int, string) error
 
@@ -332,80 +494,23 @@ type mint func(eth.ERC20Address, *big.Int, string) error
 // mint function when a deposit is made
 func (w *Wallet) MonitorBridgeAccountAndMint(ctx context.Context, mintFn mint, persistency *state.ChainPersistency) error {
 	transactionHandler := func(tx hProtocol.Transaction) {
-		if !tx.Successful {
-			return
-		}
-		log.Info("Received transaction on bridge stellar account", "hash", tx.Hash)
-
-		//TODO: this does an horizon call while we have the transaction here
-		totalAmount, sender, err := w.GetDepositAmountAndSender(tx.Hash, w.GetAddress())
-		if err != nil || totalAmount == 0 {
+		// Block the stream while the bridge is paused so the cursor does not advance
+		if !w.waitUntilResumed(ctx) {
 			return
 		}
-
-		if totalAmount <= IntToStroops(w.depositFee) {
-			log.Warn("Deposited amount is less than the depositfee, refunding")
-			w.refundDeposit(ctx, uint64(totalAmount), sender, tx)
-			return
+		if w.onSignersChanged != nil && isSignerChange(tx, w.vault) {
+			log.Info("The signers of the vault account changed", "tx", tx.Hash)
+			w.onSignersChanged()
 		}
-
-		log.Info("deposited amount", "a", StroopsToDecimal(totalAmount))
-		depositedAmount := big.NewInt(totalAmount)
-		log.Info("memo", "m", tx.Memo)
-
-		ethAddress, err := eth.GetErc20AddressFromB64(tx.Memo)
-		if err != nil {
-			log.Warn("error converting transaction memo to an Ethereum address, refunding", "error", err.Error())
-			w.refundDeposit(ctx, uint64(totalAmount), sender, tx)
+		if !w.processDeposit(ctx, tx, mintFn) {
 			return
 		}
 
-		err = mintFn(ethAddress, depositedAmount, tx.Hash)
-		for err != nil {
-			log.Error(fmt.Sprintf("Error occured while minting: %s", err.Error()))
-			//TODO: we already checked this above
-			if err == faults.ErrInsufficientDepositAmount {
-				log.Warn("User is trying to swap less than the fee amount, refunding", "amount", totalAmount)
-				w.refundDeposit(ctx, uint64(totalAmount), sender, tx)
-				return
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(10 * time.Second):
-				err = mintFn(ethAddress, depositedAmount, tx.Hash)
-			}
-		}
-
-		log.Info("Transferring the fee to the fee wallet", "address", w.Config.StellarFeeWallet)
-
-		// convert tx hash string to bytes
-		parsedMessage, err := hex.DecodeString(tx.Hash)
-		if err != nil {
-			log.Error("Error hex decoding transaction hash", "err", err)
-			return
-		}
-		var memo [32]byte
-		copy(memo[:], parsedMessage)
-
-		//TODO: a context is there for a reason
-		err = w.CreateAndSubmitFeepayment(context.Background(), uint64(IntToStroops(w.depositFee)), memo)
-		for err != nil {
-			log.Error("error sending fee to the fee wallet", "err", err.Error())
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(10 * time.Second):
-				err = w.CreateAndSubmitFeepayment(context.Background(), uint64(IntToStroops(w.depositFee)), memo)
-			}
-		}
-
 		log.Info("Mint succesfull, saving cursor now")
 
 		// save cursor
 		cursor := tx.PagingToken()
-		err = persistency.SaveStellarCursor(cursor)
+		err := persistency.SaveStellarCursor(cursor)
 		if err != nil {
 			log.Error("error while saving cursor:", err.Error())
 			return
@@ -428,120 +533,242 @@ func (w *Wallet) MonitorBridgeAccountAndMint(ctx context.Context, mintFn mint, p
 	return w.StreamBridgeStellarTransactions(ctx, blockHeight.StellarCursor, transactionHandler)
 }
 
-// GetDepositAmountAndSender returns the amount of TFT received by the bridge account in stroops
-// and the account that sent it.
-// TODO: is this called from a place where we really only have the transaction hash
-// instead of the entire transaction
-// If the entire transaction is available, there is no need to call horizon
-func (w *Wallet) GetDepositAmountAndSender(txHash string, bridgeAccount string) (depositedAmount int64, sender string, err error) {
-	transactionEffects, err := w.GetTransactionEffects(txHash)
+// ProcessDeposit handles a deposit transaction on the bridge account that was left unhandled while monitoring,
+// like a deposit that was held in the approval queue
+func (w *Wallet) ProcessDeposit(ctx context.Context, txHash string, mintFn mint) error {
+	tx, err := w.TransactionStorage.GetTransactionWithId(txHash)
 	if err != nil {
-		log.Error("error while fetching transaction effects:", err.Error())
-		return
+		return err
 	}
-	assetCode, issuer := w.GetAssetCodeAndIssuer()
-
-	for _, effect := range transactionEffects.Embedded.Records {
+	w.processDeposit(ctx, *tx, mintFn)
+	return nil
+}
 
-		if effect.GetType() == effects.EffectTypeNames[effects.EffectAccountDebited] {
-			// Only TFT payments matter, Assume normal payments
+// processDeposit mints or refunds a deposit and transfers the deposit fee to the fee wallet
+// It returns true if the deposit is minted.
+func (w *Wallet) processDeposit(ctx context.Context, tx hProtocol.Transaction, mintFn mint) bool {
+	if !tx.Successful {
+		return false
+	}
+	log.Info("Received transaction on bridge stellar account", "hash", tx.Hash)
 
-			debitedEffect := effect.(effects.AccountDebited)
-			if debitedEffect.Asset.Code != assetCode && debitedEffect.Asset.Issuer != issuer {
-				continue
-			}
-			//Normally a payment to the feebump service and the deposit payment are done by the same account
-			sender = effect.GetAccount()
-		}
-		if effect.GetType() == effects.EffectTypeNames[effects.EffectAccountCredited] {
+	// A deposit that is refunded or minted and for which the deposit fee is transferred is handled already
+	handled, err := w.TransactionStorage.TransactionWithMemoExists(tx.Hash)
+	if err != nil {
+		log.Error("error while checking if the deposit is handled already", "err", err.Error(), "tx", tx.Hash)
+		return false
+	}
+	if handled {
+		log.Info("Deposit is handled already", "tx", tx.Hash)
+		return true
+	}
 
-			if effect.GetAccount() != bridgeAccount {
-				// only payments to the bridgeaccount matter
-				continue
-			}
-			creditedEffect := effect.(effects.AccountCredited)
-			if creditedEffect.Asset.Code != assetCode && creditedEffect.Asset.Issuer != issuer {
-				continue
-			}
-			parsedAmount, err := amount.ParseInt64(creditedEffect.Amount)
-			if err != nil {
-				continue
-			}
+	deposit, err := w.GetDepositDetails(tx, w.vault)
+	if err != nil {
+		log.Error("error while parsing the deposit", "err", err.Error(), "tx", tx.Hash)
+		return false
+	}
 
-			depositedAmount += parsedAmount
+	// A balance that does not exist anymore is left out, so this only retries while it can still be claimed
+	deposit, err = w.claimBalances(ctx, deposit)
+	for err != nil {
+		log.Error("error while claiming claimable balances", "err", err.Error(), "tx", tx.Hash)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Second):
+			deposit, err = w.claimBalances(ctx, deposit)
 		}
 	}
 
-	return
-}
+	totalAmount := deposit.TotalTFT()
+	if totalAmount == 0 {
+		if len(deposit.OtherAssets) > 0 {
+			log.Warn("Deposit does not contain TFT, refunding", "tx", tx.Hash)
+			w.refundDeposit(ctx, 0, deposit, tx)
+		}
+		return false
+	}
 
-// getAccountDetails gets theaccount details of the account being scanned
-func (w *Wallet) getAccountDetails() (account hProtocol.Account, err error) {
-	client, err := w.GetHorizonClient()
+	override, err := w.IsRefundOverride(tx.Hash)
 	if err != nil {
-		return hProtocol.Account{}, err
+		log.Error("error while reading the refund overrides", "err", err.Error())
+		return false
 	}
-	ar := horizonclient.AccountRequest{AccountID: w.GetAddress()}
-	account, err = client.AccountDetail(ar)
-	if err != nil {
-		return hProtocol.Account{}, errors.Wrapf(err, "failed to get account details for account: %s", w.GetAddress())
+	if override {
+		log.Warn("Deposit is in the refund override list, refunding", "tx", tx.Hash)
+		w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+		return false
+	}
+	if w.pauseSwitch != nil && w.pauseSwitch.PausedAt(tx.LedgerCloseTime) {
+		// The depositor could not know the bridge was paused, the deposit is refunded without a penalty
+		log.Warn("Deposit was made while the bridge was paused, refunding", "tx", tx.Hash)
+		w.refundDepositWithPenalty(ctx, uint64(totalAmount), 0, deposit, tx)
+		return false
 	}
-	return account, nil
-}
 
-func (w *Wallet) StreamBridgeStellarTransactions(ctx context.Context, cursor string, handler func(op hProtocol.Transaction)) (err error) {
-	client, err := w.GetHorizonClient()
-	if err != nil {
-		return
+	if totalAmount <= IntToStroops(w.depositFee) {
+		log.Warn("Deposited amount is less than the depositfee, refunding")
+		w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+		return false
 	}
 
-	log.Info("Start watching stellar account transactions", "horizon", client.HorizonURL, "account", w.keypair.Address(), "cursor", cursor)
+	log.Info("deposited amount", "a", StroopsToDecimal(totalAmount))
+	depositedAmount := big.NewInt(totalAmount)
+	log.Info("memo", "m", tx.Memo)
 
-	for {
-		if ctx.Err() != nil {
-			return
-		}
+	ethAddress, err := w.GetDepositReceiver(tx, w.vault)
+	if err != nil {
+		log.Warn("error getting the Ethereum address from the deposit, refunding", "error", err.Error())
+		w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+		return false
+	}
 
-		internalHandler := func(tx hProtocol.Transaction) {
-			handler(tx)
-			cursor = tx.PagingToken()
+	err = mintFn(ethAddress, depositedAmount, tx.Hash)
+	for err != nil {
+		log.Error(fmt.Sprintf("Error occured while minting: %s", err.Error()))
+		//TODO: we already checked this above
+		if err == faults.ErrInsufficientDepositAmount {
+			log.Warn("User is trying to swap less than the fee amount, refunding", "amount", totalAmount)
+			w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+			return false
 		}
-		err = fetchTransactions(ctx, client, w.GetAddress(), cursor, internalHandler)
-		if err != nil {
-			return
+		if err == faults.ErrBlockedAddress {
+			log.Warn("Deposit is made to a blocked address, refunding", "tx", tx.Hash, "address", hex.EncodeToString(ethAddress[:]))
+			w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+			return false
+		}
+		if err == faults.ErrAwaitingApproval {
+			log.Warn("Deposit is held in the approval queue", "tx", tx.Hash)
+			return false
 		}
+		if err == faults.ErrTransferHandled {
+			log.Info("Deposit is refunded already", "tx", tx.Hash)
+			return true
+		}
+		if err == faults.ErrTransferDeferred {
+			log.Warn("Deposit exceeds the transfer limits, it is retried from the approval queue", "tx", tx.Hash)
+			return false
+		}
+		if err == faults.ErrTransferRejected {
+			log.Warn("Deposit is rejected by an operator, refunding", "tx", tx.Hash)
+			w.refundDeposit(ctx, uint64(totalAmount), deposit, tx)
+			return false
+		}
+
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		case <-time.After(10 * time.Second):
+			err = mintFn(ethAddress, depositedAmount, tx.Hash)
 		}
+	}
 
+	otherAssets := deposit.OtherAssets
+	if len(otherAssets) > 0 {
+		log.Warn("Deposit contains other assets than TFT, refunding them with the fee transfer", "tx", tx.Hash)
+	}
+	log.Info("Transferring the fee to the fee wallet", "address", w.Config.StellarFeeWallet)
+
+	// convert tx hash string to bytes
+	parsedMessage, err := hex.DecodeString(tx.Hash)
+	if err != nil {
+		log.Error("Error hex decoding transaction hash", "err", err)
+		return false
+	}
+	var memo [32]byte
+	copy(memo[:], parsedMessage)
+
+	//TODO: a context is there for a reason
+	err = w.CreateAndSubmitFeepayment(context.Background(), uint64(IntToStroops(w.depositFee)), memo, deposit.Sender, otherAssets)
+	for err != nil {
+		if err == faults.ErrUnclaimablePayment {
+			if len(otherAssets) > 0 {
+				log.Warn("The sender of the deposit or the fee wallet can not receive the payment, transferring only the fee", "tx", tx.Hash, "sender", deposit.Sender)
+				w.recordUnrefundableDeposit(tx.Hash, deposit.Sender, 0)
+				otherAssets = nil
+				err = w.CreateAndSubmitFeepayment(context.Background(), uint64(IntToStroops(w.depositFee)), memo, deposit.Sender, otherAssets)
+				continue
+			}
+			log.Warn("The fee wallet can not receive TFT, skipping the fee transfer", "tx", tx.Hash)
+			break
+		}
+		log.Error("error sending fee to the fee wallet", "err", err.Error())
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Second):
+			err = w.CreateAndSubmitFeepayment(context.Background(), uint64(IntToStroops(w.depositFee)), memo, deposit.Sender, otherAssets)
+		}
 	}
 
+	return true
 }
 
-func (w *Wallet) ScanBridgeAccount() error {
-	return w.TransactionStorage.ScanBridgeAccount()
+// GetDepositReceiver returns the EVM address a deposit to the vault account has to be minted to
+func (w *Wallet) GetDepositReceiver(tx hProtocol.Transaction, vault string) (eth.ERC20Address, error) {
+	return GetDepositReceiver(tx, vault, w.depositAccounts)
+}
+
+// IsPayable checks if the account of a withdrawal destination exists and has a TFT trustline
+func (w *Wallet) IsPayable(destination string) (bool, error) {
+	_, address, err := ParseWithdrawalDestination(destination)
+	if err != nil {
+		return false, nil
+	}
+	account, err := w.horizon.AccountDetail(horizonclient.AccountRequest{AccountID: address})
+	if err != nil {
+		if horizonclient.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get account details for account: %s", address)
+	}
+	assetCode, issuer := w.GetAssetCodeAndIssuer()
+	for _, b := range account.Balances {
+		if b.Code == assetCode && b.Issuer == issuer {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-// TODO: is this function really needed?
-// It does an horizon call while the place where this is called from might have the entire transaction present
-func (w *Wallet) GetTransactionEffects(txHash string) (transactionEffects effects.EffectsPage, err error) {
-	client, err := w.GetHorizonClient()
+// GetTFTBalance returns the TFT balance of the bridge account in stroops
+func (w *Wallet) GetTFTBalance() (balance int64, err error) {
+	account, err := w.getAccountDetails()
 	if err != nil {
 		return
 	}
+	assetCode, issuer := w.GetAssetCodeAndIssuer()
+	for _, b := range account.Balances {
+		if b.Code == assetCode && b.Issuer == issuer {
+			return amount.ParseInt64(b.Balance)
+		}
+	}
+	return 0, errors.New("the bridge account has no TFT trustline")
+}
 
-	effectsReq := horizonclient.EffectRequest{
-		ForTransaction: txHash,
+// getAccountDetails gets theaccount details of the account being scanned
+func (w *Wallet) getAccountDetails() (account hProtocol.Account, err error) {
+	return w.GetAccountDetails(w.vault)
+}
+
+// GetAccountDetails returns the details of a Stellar account
+func (w *Wallet) GetAccountDetails(address string) (account hProtocol.Account, err error) {
+	ar := horizonclient.AccountRequest{AccountID: address}
+	account, err = w.horizon.AccountDetail(ar)
+	if err != nil {
+		return hProtocol.Account{}, errors.Wrapf(err, "failed to get account details for account: %s", address)
 	}
-	transactionEffects, err = client.Effects(effectsReq)
-	return
+	return account, nil
+}
+
+func (w *Wallet) StreamBridgeStellarTransactions(ctx context.Context, cursor string, handler func(op hProtocol.Transaction)) (err error) {
+	log.Info("Start watching stellar account transactions", "account", w.vault, "cursor", cursor)
+	return streamTransactions(ctx, w.horizon, w.vault, cursor, handler)
 }
 
-// GetHorizonClient gets the horizon client based on the wallet's network
-func (w *Wallet) GetHorizonClient() (*horizonclient.Client, error) {
-	return GetHorizonClient(w.Config.StellarNetwork)
+func (w *Wallet) ScanBridgeAccount() error {
+	return w.TransactionStorage.ScanBridgeAccount()
 }
 
 // GetNetworkPassPhrase gets the Stellar network passphrase based on the wallet's network
@@ -0,0 +1,160 @@
+package stellar
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/faults"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/multisig"
+	"github.com/threefoldfoundation/tft/bridges/stellar-evm/stellar/horizontest"
+)
+
+// newTestWallet creates a wallet for a vault account with 100 TFT on an in-memory ledger
+func newTestWallet(t *testing.T) (*Wallet, *horizontest.Ledger, *horizontest.Client) {
+	ledger := horizontest.NewLedger(GetNetworkPassPhrase("testnet"))
+	client := horizontest.NewClient(ledger)
+	kp := keypair.MustRandom()
+	ledger.CreateAccount(kp.Address())
+	ledger.AddTrustline(kp.Address(), TFTTest)
+	ledger.Fund(kp.Address(), TFTTest, IntToStroops(100))
+	w, err := NewWallet(&StellarConfig{StellarNetwork: "testnet", StellarSeed: kp.Seed()}, 0, nil, NewTransactionStorage("testnet", client, kp.Address()), client)
+	assert.NoError(t, err)
+	return w, ledger, client
+}
+
+// pay submits a payment of amount TFT from an account to another one
+func pay(t *testing.T, client *horizontest.Client, from *keypair.Full, to string, amount string) hProtocol.Transaction {
+	source, err := client.AccountDetail(horizonclient.AccountRequest{AccountID: from.Address()})
+	assert.NoError(t, err)
+	asset, err := parseAsset(TFTTest)
+	assert.NoError(t, err)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &source,
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{&txnbuild.Payment{Destination: to, Amount: amount, Asset: asset}},
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+	})
+	assert.NoError(t, err)
+	tx, err = tx.Sign(GetNetworkPassPhrase("testnet"), from)
+	assert.NoError(t, err)
+	result, err := client.SubmitTransaction(tx)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestSubmitTransactionFaults(t *testing.T) {
+	w, ledger, client := newTestWallet(t)
+	ctx := context.Background()
+	sender := keypair.MustRandom().Address()
+	ledger.CreateAccount(sender)
+	deposit := strings.Repeat("ab", 32)
+
+	// A sender without a TFT trustline can not be refunded
+	err := w.CreateAndSubmitRefund(ctx, sender, uint64(IntToStroops(10)), deposit, 0, nil)
+	assert.Equal(t, faults.ErrUnclaimablePayment, err)
+
+	// A timeout of Horizon is an error that is retried
+	ledger.AddTrustline(sender, TFTTest)
+	client.Fail(horizontest.EndpointSubmit, horizontest.GatewayTimeout())
+	err = w.CreateAndSubmitRefund(ctx, sender, uint64(IntToStroops(10)), deposit, 0, nil)
+	assert.Error(t, err)
+	assert.NotEqual(t, faults.ErrUnclaimablePayment, err)
+	assert.Equal(t, int64(0), ledger.Balance(sender, TFTTest))
+
+	assert.NoError(t, w.CreateAndSubmitRefund(ctx, sender, uint64(IntToStroops(10)), deposit, 0, nil))
+	assert.Equal(t, IntToStroops(10), ledger.Balance(sender, TFTTest))
+
+	// The refund is found by its memo and not submitted again
+	assert.NoError(t, w.CreateAndSubmitRefund(ctx, sender, uint64(IntToStroops(10)), deposit, 0, nil))
+	assert.Equal(t, IntToStroops(10), ledger.Balance(sender, TFTTest))
+}
+
+func TestFetchTransactionsFaults(t *testing.T) {
+	defer func(delay time.Duration) { horizonRetryDelay = delay }(horizonRetryDelay)
+	horizonRetryDelay = 0
+
+	w, ledger, client := newTestWallet(t)
+	vault := w.GetAddress()
+	payer := keypair.MustRandom()
+	ledger.CreateAccount(payer.Address())
+	ledger.AddTrustline(payer.Address(), TFTTest)
+	ledger.Fund(payer.Address(), TFTTest, IntToStroops(100))
+	var hashes []string
+	for i := 0; i < 12; i++ {
+		hashes = append(hashes, pay(t, client, payer, vault, "1").Hash)
+	}
+
+	// A 504 lowers the page limit until a page is fetched, other errors are retried with the same limit
+	client.Fail(horizontest.EndpointTransactions, horizontest.GatewayTimeout(), horizontest.ErrTimeout)
+	var fetched []string
+	err := fetchTransactions(context.Background(), client, vault, "", func(tx hProtocol.Transaction) {
+		fetched = append(fetched, tx.Hash)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, fetched)
+
+	var limits []uint
+	var cursors []string
+	for _, request := range client.TransactionRequests() {
+		limits = append(limits, request.Limit)
+		cursors = append(cursors, request.Cursor)
+	}
+	assert.Equal(t, []uint{PageLimit, 5, 5, PageLimit, PageLimit}, limits)
+	assert.Equal(t, []string{"", "", "", "5", "12"}, cursors)
+
+	// The effects are paged like the transactions
+	page, err := client.Effects(horizonclient.EffectRequest{ForAccount: vault, Limit: 5})
+	assert.NoError(t, err)
+	assert.Len(t, page.Embedded.Records, 5)
+	assert.Equal(t, "account_credited", page.Embedded.Records[0].GetType())
+	page, err = client.Effects(horizonclient.EffectRequest{ForAccount: vault, Cursor: page.Embedded.Records[4].PagingToken()})
+	assert.NoError(t, err)
+	assert.Len(t, page.Embedded.Records, 7)
+}
+
+// recordingSigners fails to collect the signatures and records the transactions it was asked to sign
+type recordingSigners struct {
+	transactions []string
+	err          error
+}
+
+func (r *recordingSigners) Sign(ctx context.Context, signRequest multisig.StellarSignRequest) ([]multisig.StellarSignResponse, error) {
+	r.transactions = append(r.transactions, signRequest.TxnXDR)
+	return nil, r.err
+}
+
+func (r *recordingSigners) SetCosigners(cosigners []Signer) error {
+	return nil
+}
+
+func TestSigningRetrySignsTheSameTransaction(t *testing.T) {
+	w, ledger, _ := newTestWallet(t)
+	signers := &recordingSigners{err: errors.New("required signature weight is not met")}
+	w.client = signers
+	w.requiredWeight = 1
+	sender := keypair.MustRandom().Address()
+	ledger.CreateAccount(sender)
+	ledger.AddTrustline(sender, TFTTest)
+	deposit := strings.Repeat("ab", 32)
+
+	assert.Error(t, w.CreateAndSubmitRefund(context.Background(), sender, uint64(IntToStroops(10)), deposit, 0, nil))
+	// a new transaction would have other time bounds
+	time.Sleep(time.Second)
+	assert.Error(t, w.CreateAndSubmitRefund(context.Background(), sender, uint64(IntToStroops(10)), deposit, 0, nil))
+	assert.Len(t, signers.transactions, 2)
+	assert.Equal(t, signers.transactions[0], signers.transactions[1])
+
+	// the time bounds are forgotten once the signatures are collected
+	signers.err = nil
+	assert.Error(t, w.CreateAndSubmitRefund(context.Background(), sender, uint64(IntToStroops(10)), deposit, 0, nil))
+	assert.Empty(t, w.pendingTimeBounds)
+}
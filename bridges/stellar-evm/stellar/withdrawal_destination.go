@@ -0,0 +1,33 @@
+package stellar
+
+import (
+	"strings"
+
+	"github.com/stellar/go/support/errors"
+	"github.com/stellar/go/xdr"
+)
+
+var ErrInvalidWithdrawalDestination = errors.New("invalid withdrawal destination")
+
+// ParseWithdrawalDestination returns the destination of the payment for the blockchain address of a withdrawal
+// and the Stellar account that receives it.
+// The blockchain address is a Stellar address or a muxed address.
+// A memo for the destination (G...:1234) is refused: the memo of the transaction identifies the withdrawal
+// and a muxed address is not credited by accounts that require a memo and do not support muxed addresses.
+// The returned destination is the canonical encoding, so the cosigners can compare it with the payment.
+func ParseWithdrawalDestination(blockchainAddress string) (destination string, account string, err error) {
+	if strings.Contains(blockchainAddress, ":") {
+		err = errors.Wrap(ErrInvalidWithdrawalDestination, "a memo for the destination is not supported, use a muxed address")
+		return
+	}
+	muxedAccount, err := xdr.AddressToMuxedAccount(blockchainAddress)
+	if err != nil {
+		err = ErrInvalidWithdrawalDestination
+		return
+	}
+
+	destination = muxedAccount.Address()
+	accountID := muxedAccount.ToAccountId()
+	account = accountID.Address()
+	return
+}
@@ -0,0 +1,31 @@
+package stellar
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWithdrawalDestination(t *testing.T) {
+	account := keypair.MustRandom().Address()
+	muxed, err := xdr.MuxedAccountFromAccountId(account, 1234)
+	assert.NoError(t, err)
+
+	destination, destinationAccount, err := ParseWithdrawalDestination(account)
+	assert.NoError(t, err)
+	assert.Equal(t, account, destination)
+	assert.Equal(t, account, destinationAccount)
+
+	destination, destinationAccount, err = ParseWithdrawalDestination(muxed.Address())
+	assert.NoError(t, err)
+	assert.Equal(t, muxed.Address(), destination)
+	assert.Equal(t, account, destinationAccount)
+
+	// The memo of the transaction identifies the withdrawal, there can not be a memo for the destination
+	for _, invalid := range []string{"", "GABC", account + ":1234", account + ":text", account + ":", muxed.Address() + ":1234"} {
+		_, _, err = ParseWithdrawalDestination(invalid)
+		assert.ErrorIs(t, err, ErrInvalidWithdrawalDestination, invalid)
+	}
+}
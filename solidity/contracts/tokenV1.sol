@@ -188,6 +188,30 @@ contract TFT is OwnedUpgradeableTokenStorage {
         return getUint(keccak256(abi.encode("signaturesRequired"))) ;
     }
 
+    // --------------------------------------------------------------------
+    // setWithdrawFee sets the fee the bridges deduct from a withdrawal
+    // @param fee the withdraw fee in the smallest token unit
+    // --------------------------------------------------------------------
+    function setWithdrawFee(uint fee) external onlyOwner {
+        setUint(keccak256(abi.encode("withdrawFee")), fee);
+        setBool(keccak256(abi.encode("withdrawFeeSet")), true);
+    }
+
+    // --------------------------------------------------------------------
+    // isWithdrawFeeSet returns true once an owner set the withdraw fee,
+    // the bridges use their default fee before that
+    // --------------------------------------------------------------------
+    function isWithdrawFeeSet() public view returns (bool) {
+        return getBool(keccak256(abi.encode("withdrawFeeSet")));
+    }
+
+    // --------------------------------------------------------------------
+    // getWithdrawFee returns the fee the bridges deduct from a withdrawal
+    // --------------------------------------------------------------------
+    function getWithdrawFee() public view returns (uint) {
+        return getUint(keccak256(abi.encode("withdrawFee")));
+    }
+
 
     // Utility function to verify geth style signatures
 	function verifySig(
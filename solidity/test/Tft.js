@@ -50,6 +50,25 @@ describe("Token contract", function () {
     await tftToken.mintTokens(addr3.address, 100, "sometxid", [sig1, sig2, sig3]);
     expect(await tftToken.balanceOf(addr3.address)).to.equal(100);
   });
+
+  it("Should be able to set the withdraw fee", async function() {
+    expect(await tftToken.getWithdrawFee()).to.equal(0);
+    expect(await tftToken.isWithdrawFeeSet()).to.equal(false);
+
+    await tftToken.setWithdrawFee(10000000);
+    expect(await tftToken.getWithdrawFee()).to.equal(10000000);
+    expect(await tftToken.isWithdrawFeeSet()).to.equal(true);
+
+    await tftToken.setWithdrawFee(0);
+    expect(await tftToken.getWithdrawFee()).to.equal(0);
+    expect(await tftToken.isWithdrawFeeSet()).to.equal(true);
+  });
+
+  it("Should not be able to set the withdraw fee if not an owner", async function() {
+    const [owner, addr1] = await ethers.getSigners();
+
+    await expect(tftToken.connect(addr1).setWithdrawFee(1)).to.be.reverted;
+  });
 });
 
     // // Transfer 50 tokens from owner to addr1